@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
+	"outDrinkMeAPI/middleware"
+	"outDrinkMeAPI/services"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type QuestionPackHandler struct {
+	packService *services.QuestionPackService
+}
+
+func NewQuestionPackHandler(packService *services.QuestionPackService) *QuestionPackHandler {
+	return &QuestionPackHandler{packService: packService}
+}
+
+type questionPackRequest struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsPremium   bool   `json:"isPremium"`
+	IsActive    *bool  `json:"isActive"` // new packs are active unless this says otherwise
+}
+
+func (req questionPackRequest) toPack() (*drinkinggame.QuestionPack, string) {
+	pack := &drinkinggame.QuestionPack{
+		Slug:        strings.TrimSpace(req.Slug),
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		IsPremium:   req.IsPremium,
+		IsActive:    true,
+	}
+	if req.IsActive != nil {
+		pack.IsActive = *req.IsActive
+	}
+
+	if pack.Slug == "" || pack.Name == "" {
+		return nil, "slug and name are required"
+	}
+	return pack, ""
+}
+
+// GetPacks lists the BurnBook packs a host can pick, with premium ones locked for users without premium
+func (h *QuestionPackHandler) GetPacks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	packs, err := h.packService.ListPacks(ctx, clerkID)
+	if err != nil {
+		log.Printf("Failed to get question packs: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get question packs")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, packs)
+}
+
+// --- Admin ---
+
+func (h *QuestionPackHandler) AdminGetPacks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	packs, err := h.packService.ListAllPacks(ctx)
+	if err != nil {
+		log.Printf("Failed to get question packs: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get question packs")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, packs)
+}
+
+func (h *QuestionPackHandler) AdminCreatePack(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req questionPackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	pack, problem := req.toPack()
+	if problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem)
+		return
+	}
+
+	if err := h.packService.CreatePack(ctx, pack); err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, pack)
+}
+
+func (h *QuestionPackHandler) AdminUpdatePack(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req questionPackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	pack, problem := req.toPack()
+	if problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem)
+		return
+	}
+	packID, ok := pathUUID(w, r, "packId")
+	if !ok {
+		return
+	}
+
+	if err := h.packService.UpdatePack(ctx, packID, pack); err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, pack)
+}
+
+func (h *QuestionPackHandler) AdminDeletePack(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	packID, ok := pathUUID(w, r, "packId")
+	if !ok {
+		return
+	}
+
+	if err := h.packService.DeletePack(ctx, packID); err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (h *QuestionPackHandler) AdminGetQuestions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	packID, ok := pathUUID(w, r, "packId")
+	if !ok {
+		return
+	}
+
+	questions, err := h.packService.GetQuestions(ctx, packID)
+	if err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, questions)
+}
+
+// AdminAddQuestions takes {"questions": ["...", "..."]} so a whole pack can be pasted in at once
+func (h *QuestionPackHandler) AdminAddQuestions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	packID, ok := pathUUID(w, r, "packId")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Questions []string `json:"questions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Questions) == 0 {
+		respondWithError(w, http.StatusBadRequest, "questions are required")
+		return
+	}
+
+	added, err := h.packService.AddQuestions(ctx, packID, req.Questions)
+	if err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, added)
+}
+
+func (h *QuestionPackHandler) AdminDeleteQuestion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	packID, ok := pathUUID(w, r, "packId")
+	if !ok {
+		return
+	}
+	questionID, ok := pathUUID(w, r, "questionId")
+	if !ok {
+		return
+	}
+
+	if err := h.packService.DeleteQuestion(ctx, packID, questionID); err != nil {
+		h.respondWithPackError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// pathUUID reads a UUID from the route, answering 400 when it isn't one
+func pathUUID(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)[name])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid "+name)
+		return uuid.UUID{}, false
+	}
+	return id, true
+}
+
+func (h *QuestionPackHandler) respondWithPackError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrPackNotFound), errors.Is(err, services.ErrQuestionNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrPackSlugTaken):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("Question pack request failed: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	}
+}
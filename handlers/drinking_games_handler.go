@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"outDrinkMeAPI/middleware"
@@ -14,8 +16,13 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// gamePasswordProtocol is offered in the subprotocol list before the game password, base64url encoded
+// without padding, e.g. "game-password, c2VjcmV0". It stays out of the URL so it doesn't end up in access logs.
+const gamePasswordProtocol = "game-password"
+
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{middleware.WebSocketAuthProtocol, gamePasswordProtocol},
 }
 
 func handleConnections(w http.ResponseWriter, r *http.Request) {
@@ -29,14 +36,16 @@ func handleConnections(w http.ResponseWriter, r *http.Request) {
 }
 
 type DrinkingGamesHandler struct {
-	gameManager *services.DrinnkingGameManager
-	userService *services.UserService
+	gameManager   *services.DrinnkingGameManager
+	userService   *services.UserService
+	resultService *services.GameResultService
 }
 
-func NewDrinkingGamesHandler(gameManager *services.DrinnkingGameManager, userService *services.UserService) *DrinkingGamesHandler {
+func NewDrinkingGamesHandler(gameManager *services.DrinnkingGameManager, userService *services.UserService, resultService *services.GameResultService) *DrinkingGamesHandler {
 	return &DrinkingGamesHandler{
-		gameManager: gameManager,
-		userService: userService,
+		gameManager:   gameManager,
+		userService:   userService,
+		resultService: resultService,
 	}
 }
 
@@ -57,7 +66,10 @@ func (h *DrinkingGamesHandler) CreateDrinkingGame(w http.ResponseWriter, r *http
 	}
 
 	var req struct {
-		GameType string `json:"game_type"`
+		GameType   string `json:"game_type"`
+		IsPublic   *bool  `json:"is_public"`
+		Password   string `json:"password"`
+		MaxPlayers int    `json:"max_players"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -65,57 +77,204 @@ func (h *DrinkingGamesHandler) CreateDrinkingGame(w http.ResponseWriter, r *http
 		return
 	}
 
+	if req.MaxPlayers < 0 {
+		respondWithError(w, http.StatusBadRequest, "max_players can't be negative")
+		return
+	}
+
+	// Games stay public unless the host says otherwise, older app versions don't send settings
+	isPublic := true
+	if req.IsPublic != nil {
+		isPublic = *req.IsPublic
+	}
+
 	sessionID := uuid.New().String()
 
-	h.gameManager.CreateSession(ctx, sessionID, req.GameType, clerkID, user.Username)
+	session := h.gameManager.CreateSession(ctx, sessionID, req.GameType, clerkID, user.Username, services.NewSessionSettings(isPublic, req.Password, req.MaxPlayers))
 
-	response := map[string]string{
+	response := map[string]interface{}{
 		"sessionId": sessionID,
-		"wsUrl":     "/api/v1/games/ws/" + sessionID,
+		"wsUrl":     drinkingGameWsURL(sessionID),
+		"joinCode":  session.JoinCode,
+		"settings":  session.Settings,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func drinkingGameWsURL(sessionID string) string {
+	return "/api/v1/drinking-games/ws/" + sessionID
+}
+
+// ResolveJoinCode turns a short join code into the session to connect to
+func (h *DrinkingGamesHandler) ResolveJoinCode(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	code := mux.Vars(r)["code"]
+
+	session, ok := h.gameManager.ResolveJoinCode(ctx, code)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "No game with that code")
+		return
+	}
+
+	response := map[string]interface{}{
+		"sessionId":   session.ID,
+		"wsUrl":       drinkingGameWsURL(session.ID),
+		"gameType":    session.GameType,
+		"hasPassword": session.Settings.HasPassword,
+		"maxPlayers":  session.Settings.MaxPlayers,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// How long a matchmaking request waits for a seat before the app is told to queue again
+const matchmakingWait = 25 * time.Second
+
+// Matchmake queues the player for a public game of the type they asked for and answers once they have a seat.
+// If nothing turns up in matchmakingWait the answer is 202 with matched false, and the app queues again.
+func (h *DrinkingGamesHandler) Matchmake(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), matchmakingWait)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		GameType string `json:"game_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.GetUserByClerkID(ctx, clerkID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	match, err := h.gameManager.Matchmake(ctx, req.GameType, clerkID, user.Username)
+	switch {
+	case errors.Is(err, services.ErrUnknownGameType):
+		respondWithError(w, http.StatusBadRequest, "Unknown game type")
+		return
+	case errors.Is(err, services.ErrMatchReplaced):
+		respondWithError(w, http.StatusConflict, "You queued again from somewhere else")
+		return
+	case err != nil:
+		respondWithJSON(w, http.StatusAccepted, map[string]interface{}{"matched": false})
+		return
+	}
+
+	response := map[string]interface{}{
+		"matched":   true,
+		"sessionId": match.SessionID,
+		"wsUrl":     drinkingGameWsURL(match.SessionID),
+		"gameType":  match.GameType,
+		"created":   match.Created,
 	}
 
 	respondWithJSON(w, http.StatusOK, response)
 }
 
 func (h *DrinkingGamesHandler) GetPublicDrinkingGames(w http.ResponseWriter, r *http.Request) {
-	games := h.gameManager.GetPublicSessions()
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	games := h.gameManager.GetPublicSessions(ctx)
 
 	respondWithJSON(w, http.StatusOK, games)
 }
 
+// GetGameHistory lists the drinking games the user has finished, newest first
+func (h *DrinkingGamesHandler) GetGameHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clerkID, ok := middleware.GetClerkID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, limit := getPaginationParams(r)
+
+	history, err := h.resultService.GetUserGameHistory(ctx, clerkID, page, limit)
+	if err != nil {
+		log.Printf("Failed to get game history: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get game history")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, history)
+}
+
 func (h *DrinkingGamesHandler) JoinDrinkingGame(w http.ResponseWriter, r *http.Request) {
-	// ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	// defer cancel()
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	// token := r.URL.Query().Get("token")
-	// if token == "" {
-	// 	http.Error(w, "Unauthorized", http.StatusUnauthorized)
-	// 	return
-	// }
+	// The WS route sits outside the protected router, so the Clerk session is checked here
+	clerkID, err := middleware.VerifyWebSocketToken(r)
+	if err != nil {
+		log.Printf("Drinking game join rejected: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	vars := mux.Vars(r)
 	sessionID := vars["sessionID"]
 
-	session, exists := h.gameManager.GetSession(sessionID)
+	// The session may be running on another instance, Attach relays to it
+	session, exists := h.gameManager.FindSession(ctx, sessionID)
 	if !exists {
 		http.Error(w, "Game session not found", http.StatusNotFound)
 		return
 	}
 
+	user, err := h.userService.GetUserByClerkID(ctx, clerkID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Hosts never need their own password. A resuming player may skip it, but only if the resume works.
+	password, err := base64.RawURLEncoding.DecodeString(middleware.WebSocketProtocolValue(r, gamePasswordProtocol))
+	if err != nil {
+		http.Error(w, "Game password must be base64url encoded", http.StatusBadRequest)
+		return
+	}
+	passwordOK := clerkID == session.HostID || session.Settings.CheckPassword(string(password))
+	resumeToken := r.URL.Query().Get("resumeToken")
+	if !passwordOK && resumeToken == "" {
+		http.Error(w, "Wrong game password", http.StatusForbidden)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	client := &services.Client{
-		Session: session,
-		Conn:    conn,
-		Send:    make(chan []byte, 256),
+	req := services.JoinRequest{
+		UserID:      clerkID,
+		Username:    user.Username,
+		Spectator:   r.URL.Query().Get("spectate") == "true",
+		ResumeToken: resumeToken,
+		PasswordOK:  passwordOK,
 	}
 
-	client.Session.Register <- client
-	go client.WritePump()
-	go client.ReadPump()
-
+	if reason := h.gameManager.Attach(session, req, conn); reason != "" {
+		conn.WriteJSON(map[string]string{
+			"action": "join_rejected",
+			"reason": reason,
+		})
+		conn.Close()
+	}
 }
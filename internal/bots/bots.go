@@ -0,0 +1,253 @@
+// Package bots plays drinking games without a WebSocket. A bot sits in a session like any other client and
+// makes random but legal moves, which is enough to soak test sessions and to fill empty seats in casual lobbies.
+package bots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"outDrinkMeAPI/services"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDPrefix starts every user ID Fill hands out, so bots can be told apart from Clerk users
+const IDPrefix = "bot_"
+
+// Options tune how a bot plays
+type Options struct {
+	Seed  int64         // for the bot's own picks, 0 picks one from the clock
+	Delay time.Duration // how long the bot "thinks" before each move, 0 plays instantly
+}
+
+// Bot is one scripted player in a session
+type Bot struct {
+	ID       string
+	Username string
+
+	client *services.Client
+	brain  brain
+	rand   *rand.Rand
+	delay  time.Duration
+
+	outbox chan []byte
+	stop   chan struct{}
+	done   chan struct{}
+	leave  sync.Once
+
+	hostID  string // from the last player list, only touched by the read loop
+	players int
+
+	received atomic.Int64
+	sent     atomic.Int64
+	errors   atomic.Int64
+	games    atomic.Int64
+}
+
+// brain picks the moves for one game type. handle runs on the bot's read loop, one frame at a time.
+type brain interface {
+	handle(b *Bot, action string, frame []byte)
+}
+
+func brainFor(gameType string) (brain, error) {
+	switch gameType {
+	case "kings-cup":
+		return &kingsCupBrain{}, nil
+	case "burn-book":
+		return &burnBookBrain{}, nil
+	case "mafia":
+		return &mafiaBrain{}, nil
+	default:
+		return nil, fmt.Errorf("bots can't play %q", gameType)
+	}
+}
+
+// Join seats a bot in the session. It plays until it leaves or the session drops it.
+func Join(s *services.Session, userID, username string, opts Options) (*Bot, error) {
+	brain, err := brainFor(s.GameType)
+	if err != nil {
+		return nil, err
+	}
+
+	client, reason := s.Join(services.JoinRequest{UserID: userID, Username: username, PasswordOK: true}, nil)
+	if client == nil {
+		return nil, errors.New(reason)
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	b := &Bot{
+		ID:       userID,
+		Username: username,
+		client:   client,
+		brain:    brain,
+		rand:     rand.New(rand.NewSource(seed)),
+		delay:    opts.Delay,
+		outbox:   make(chan []byte, 64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.readLoop()
+	go b.writeLoop()
+
+	b.Send("join_room", nil)
+	return b, nil
+}
+
+// Fill seats n bots named "Bot 1", "Bot 2"... Bots already seated stay if a later one can't join.
+func Fill(s *services.Session, n int, opts Options) ([]*Bot, error) {
+	bots := make([]*Bot, 0, n)
+	for i := 1; i <= n; i++ {
+		if opts.Seed != 0 {
+			opts.Seed++
+		}
+		b, err := Join(s, IDPrefix+uuid.NewString(), fmt.Sprintf("Bot %d", i), opts)
+		if err != nil {
+			return bots, err
+		}
+		bots = append(bots, b)
+	}
+	return bots, nil
+}
+
+// Send queues a message for the session, the same JSON a real client would send.
+// Messages are dropped if the bot is backed up or has left.
+func (b *Bot) Send(action string, fields map[string]interface{}) {
+	msg := map[string]interface{}{"v": services.ProtocolVersion, "action": action}
+	for k, v := range fields {
+		msg[k] = v
+	}
+	data, _ := json.Marshal(msg)
+
+	select {
+	case b.outbox <- data:
+	default:
+	}
+}
+
+// act sends a game action for the engine
+func (b *Bot) act(actionType string, fields map[string]interface{}) {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["type"] = actionType
+	b.Send("game_action", fields)
+}
+
+// StartGame starts the game, if the bot is the host
+func (b *Bot) StartGame() { b.Send("start_game", nil) }
+
+// ResetGame starts the next game, if the bot is the host
+func (b *Bot) ResetGame() { b.Send("reset_game", nil) }
+
+// Leave drops the bot like a closed socket would. Its seat is held for the reconnect grace period.
+func (b *Bot) Leave() {
+	b.leave.Do(func() {
+		close(b.stop)
+		b.client.Disconnect()
+	})
+}
+
+// Done is closed once the session stops sending to the bot
+func (b *Bot) Done() <-chan struct{} { return b.done }
+
+// Received is how many frames the session has sent the bot
+func (b *Bot) Received() int64 { return b.received.Load() }
+
+// Sent is how many messages the bot has sent
+func (b *Bot) Sent() int64 { return b.sent.Load() }
+
+// Errors is how many error frames the bot got back. A few are normal, a bot can act on a state that just went stale.
+func (b *Bot) Errors() int64 { return b.errors.Load() }
+
+// Games is how many games the bot has seen end
+func (b *Bot) Games() int64 { return b.games.Load() }
+
+func (b *Bot) isHost() bool { return b.hostID == b.ID }
+
+func (b *Bot) readLoop() {
+	defer close(b.done)
+
+	for frame := range b.client.Send {
+		b.received.Add(1)
+
+		var env struct {
+			Action string `json:"action"`
+		}
+		if json.Unmarshal(frame, &env) != nil {
+			continue
+		}
+
+		switch env.Action {
+		case "update_player_list":
+			var list struct {
+				HostID  string            `json:"hostId"`
+				Players []json.RawMessage `json:"players"`
+			}
+			json.Unmarshal(frame, &list)
+			if list.HostID != "" {
+				b.hostID = list.HostID
+			}
+			b.players = len(list.Players)
+		case "error":
+			b.errors.Add(1)
+		}
+
+		b.brain.handle(b, env.Action, frame)
+	}
+}
+
+func (b *Bot) writeLoop() {
+	for {
+		select {
+		case <-b.stop:
+			return
+		case data := <-b.outbox:
+			if b.delay > 0 {
+				select {
+				case <-time.After(b.delay):
+				case <-b.stop:
+					return
+				}
+			}
+			b.sent.Add(1)
+			b.client.Receive(data)
+		}
+	}
+}
+
+// gameOver counts a finished game once, however many frames say it's over
+func (b *Bot) gameOver(over *bool) {
+	if !*over {
+		*over = true
+		b.games.Add(1)
+	}
+}
+
+// pick returns a random player that isn't the bot, or nil if there is none
+func (b *Bot) pick(players []services.PlayerInfo) *services.PlayerInfo {
+	others := make([]services.PlayerInfo, 0, len(players))
+	for _, p := range players {
+		if p.ID != b.ID {
+			others = append(others, p)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	return &others[b.rand.Intn(len(others))]
+}
+
+func decodeState[T any](frame []byte) (T, bool) {
+	var payload struct {
+		GameState T `json:"gameState"`
+	}
+	err := json.Unmarshal(frame, &payload)
+	return payload.GameState, err == nil
+}
@@ -0,0 +1,182 @@
+package bots
+
+import (
+	"fmt"
+	"outDrinkMeAPI/services"
+	"slices"
+)
+
+// kingsCupBrain draws when it's the bot's turn, picks a random buddy on an 8 and makes up a rule on a King
+type kingsCupBrain struct {
+	lastMove string // the state the bot last moved on, so repeats of it don't get a second move
+	over     bool
+}
+
+func (k *kingsCupBrain) handle(b *Bot, action string, frame []byte) {
+	if action != "game_update" {
+		return
+	}
+	state, ok := decodeState[services.KingsCupGameState](frame)
+	if !ok {
+		return
+	}
+
+	if state.GameStarted && state.CardsRemaining == 52 {
+		k.over = false
+	}
+	if state.GameOver {
+		b.gameOver(&k.over)
+	}
+	if state.CurrentPlayerTurnID == nil || *state.CurrentPlayerTurnID != b.ID {
+		return
+	}
+
+	// An 8 or a King showing on the bot's turn is one it drew and still has to deal with
+	pending := ""
+	if state.CurrentCard != nil && (state.CurrentCard.Value == "8" || state.CurrentCard.Value == "K") {
+		pending = state.CurrentCard.Value
+	}
+	if pending == "" && state.GameOver {
+		return
+	}
+	move := fmt.Sprintf("%d/%s", state.CardsRemaining, pending)
+	if move == k.lastMove {
+		return
+	}
+	k.lastMove = move
+
+	switch pending {
+	case "8":
+		if buddy := b.pick(state.Players); buddy != nil {
+			b.act("choose_buddy", map[string]interface{}{"chosen_buddie_id": buddy.ID})
+		}
+	case "K":
+		b.act("set_rule", map[string]interface{}{"new_rule": fmt.Sprintf("%s says drink with your left hand", b.Username)})
+	default:
+		b.act("draw_card", nil)
+	}
+}
+
+// burnBookBrain writes one question a game and votes for a random player. As host it opens voting
+// once everyone has written a question and clicks through the results.
+type burnBookBrain struct {
+	asked      bool
+	votingOpen bool
+	votedOn    int // CurrentNumber of the last question the bot voted on
+	over       bool
+}
+
+func (k *burnBookBrain) handle(b *Bot, action string, frame []byte) {
+	var state services.BurnBookGameState
+	switch action {
+	case "start_game", "reset_game":
+		// The game doesn't send a state when it opens, clients go straight to writing questions
+		k.asked, k.votingOpen, k.votedOn, k.over = false, false, 0, false
+		state.Phase = "collecting"
+	case "game_update":
+		var ok bool
+		if state, ok = decodeState[services.BurnBookGameState](frame); !ok {
+			return
+		}
+	default:
+		return
+	}
+
+	switch state.Phase {
+	case "collecting":
+		if !k.asked {
+			k.asked = true
+			b.act("submit_question", map[string]interface{}{"payload": fmt.Sprintf("Who is most likely to out drink %s?", b.Username)})
+		}
+		if b.isHost() && !k.votingOpen && b.players > 0 && state.CollectedCount >= b.players {
+			k.votingOpen = true
+			b.act("start_voting", nil)
+		}
+
+	case "voting":
+		if state.HasVoted || state.CurrentNumber == k.votedOn {
+			return
+		}
+		if target := b.pick(state.Players); target != nil {
+			k.votedOn = state.CurrentNumber
+			b.act("vote_player", map[string]interface{}{"targetId": target.ID})
+		}
+
+	case "results_wait", "results":
+		if b.isHost() {
+			b.act("next_reveal", nil)
+		}
+
+	case "game_over":
+		b.gameOver(&k.over)
+	}
+}
+
+// mafiaBrain uses its role's night action on a random living player and votes at random by day
+type mafiaBrain struct {
+	role      string
+	phase     string
+	alive     []services.PlayerInfo
+	nightTask bool // the game asked for the bot's night action
+	acted     bool // in the current phase
+	over      bool
+}
+
+func (k *mafiaBrain) handle(b *Bot, action string, frame []byte) {
+	switch action {
+	case "action_request":
+		k.nightTask = true
+	case "game_update":
+		state, ok := decodeState[services.MafiaGameState](frame)
+		if !ok {
+			return
+		}
+		if state.Phase != k.phase {
+			k.phase, k.acted = state.Phase, false
+		}
+		if state.MyRole != "" {
+			k.role = state.MyRole
+		}
+		if state.AlivePlayers != nil {
+			k.alive = state.AlivePlayers
+		}
+		if state.Phase == "GAME_OVER" {
+			k.role, k.alive, k.nightTask = "", nil, false
+			b.gameOver(&k.over)
+			return
+		}
+		if state.Phase == "NIGHT" {
+			k.over = false
+		}
+	default:
+		return
+	}
+
+	if k.acted || !slices.ContainsFunc(k.alive, func(p services.PlayerInfo) bool { return p.ID == b.ID }) {
+		return
+	}
+
+	switch k.phase {
+	case "NIGHT":
+		if !k.nightTask || k.role == "" {
+			return
+		}
+		targets := k.alive
+		if k.role == services.ROLE_BODYGUARD {
+			targets = slices.DeleteFunc(slices.Clone(targets), func(p services.PlayerInfo) bool { return p.ID == b.ID })
+		}
+		if len(targets) == 0 {
+			return
+		}
+		k.acted, k.nightTask = true, false
+		b.act("night_action", map[string]interface{}{"targetId": targets[b.rand.Intn(len(targets))].ID})
+
+	case "DAY":
+		k.acted = true
+		target := "SKIP"
+		if p := b.pick(k.alive); p != nil {
+			target = p.ID
+		}
+		b.act("vote", map[string]interface{}{"targetId": target})
+	}
+}
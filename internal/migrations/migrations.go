@@ -0,0 +1,86 @@
+// Package migrations keeps the schema changes the API needs on top of the existing database. Every file in sql/
+// runs once, in name order, and is recorded in schema_migrations. Add a new numbered file for a change instead of
+// editing one that has already shipped.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Any fixed key works, it only keeps two instances starting at once from running the same file
+const lockKey = 7243550104
+
+// Apply runs the migrations the database hasn't had yet. Each one runs in its own transaction.
+func Apply(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(files, "sql/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := apply(ctx, db, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, db *pgxpool.Pool, name string) error {
+	script, err := files.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	version := name[len("sql/"):]
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+
+	var applied bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+	if err != nil {
+		return fmt.Errorf("failed to check migration %s: %w", version, err)
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, string(script)); err != nil {
+		return fmt.Errorf("migration %s failed: %w", version, err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", version, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", version, err)
+	}
+
+	log.Printf("Applied migration %s", version)
+	return nil
+}
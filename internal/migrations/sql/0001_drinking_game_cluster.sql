@@ -0,0 +1,21 @@
+-- Sessions shared across API instances and the relay for sockets that land on another node
+CREATE TABLE IF NOT EXISTS drinking_game_sessions (
+    id            TEXT PRIMARY KEY,
+    node_id       TEXT NOT NULL,
+    join_code     TEXT NOT NULL UNIQUE,
+    game_type     TEXT NOT NULL,
+    host_id       TEXT NOT NULL,
+    host_username TEXT NOT NULL,
+    is_public     BOOLEAN NOT NULL,
+    password_hash BYTEA,
+    max_players   INT NOT NULL DEFAULT 0,
+    players       INT NOT NULL DEFAULT 0,
+    spectators    INT NOT NULL DEFAULT 0,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS drinking_game_relay (
+    id         BIGSERIAL PRIMARY KEY,
+    payload    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,22 @@
+-- Finished drinking games and who played in them
+CREATE TABLE IF NOT EXISTS drinking_game_results (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id       TEXT NOT NULL,
+    game_type        TEXT NOT NULL,
+    winning_side     TEXT,
+    started_at       TIMESTAMPTZ NOT NULL,
+    ended_at         TIMESTAMPTZ NOT NULL,
+    duration_seconds INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS drinking_game_participants (
+    result_id   UUID NOT NULL REFERENCES drinking_game_results(id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username    TEXT NOT NULL,
+    role        TEXT,
+    won         BOOLEAN NOT NULL DEFAULT FALSE,
+    xp_earned   INT NOT NULL DEFAULT 0,
+    gems_earned INT NOT NULL DEFAULT 0,
+    stats       JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (result_id, user_id)
+);
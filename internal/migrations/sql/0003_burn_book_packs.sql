@@ -0,0 +1,18 @@
+-- Curated BurnBook question packs
+CREATE TABLE IF NOT EXISTS burn_book_packs (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    slug        TEXT NOT NULL UNIQUE,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    is_premium  BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active   BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS burn_book_questions (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pack_id    UUID NOT NULL REFERENCES burn_book_packs(id) ON DELETE CASCADE,
+    text       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
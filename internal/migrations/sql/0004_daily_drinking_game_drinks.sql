@@ -0,0 +1,2 @@
+-- Drinks counted in drinking games, added up per day
+ALTER TABLE daily_drinking ADD COLUMN IF NOT EXISTS game_drinks INT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- When a rate limited notification can go out in a digest
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS digest_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS notifications_digest_at_idx ON notifications (digest_at) WHERE digest_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- When a failed notification is tried again, NULL once it's out of attempts
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS notifications_next_attempt_at_idx ON notifications (next_attempt_at) WHERE next_attempt_at IS NOT NULL;
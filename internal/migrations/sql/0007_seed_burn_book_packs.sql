@@ -0,0 +1,64 @@
+-- The curated BurnBook packs the game launches with. Packs an admin already created under
+-- the same slug are left alone, questions are only added along with a new pack.
+WITH pack AS (
+    INSERT INTO burn_book_packs (slug, name, description, is_premium)
+    VALUES ('wholesome', 'Wholesome', 'Nice things to find out about your friends', FALSE)
+    ON CONFLICT (slug) DO NOTHING
+    RETURNING id
+)
+INSERT INTO burn_book_questions (pack_id, text)
+SELECT pack.id, q.text
+FROM pack, (VALUES
+    ('Who is most likely to remember everyone''s birthday?'),
+    ('Who gives the best hugs?'),
+    ('Who would you call at 3am in an emergency?'),
+    ('Who is most likely to adopt every stray animal they meet?'),
+    ('Who always makes sure everyone gets home safe?'),
+    ('Who is most likely to cry at a wedding?'),
+    ('Who gives the best advice?'),
+    ('Who is most likely to become a famous chef?'),
+    ('Who would be the best parent?'),
+    ('Who lights up the room when they walk in?')
+) AS q(text);
+
+WITH pack AS (
+    INSERT INTO burn_book_packs (slug, name, description, is_premium)
+    VALUES ('work-party', 'Work Party', 'Safe enough for the office, awkward enough for the afterparty', FALSE)
+    ON CONFLICT (slug) DO NOTHING
+    RETURNING id
+)
+INSERT INTO burn_book_questions (pack_id, text)
+SELECT pack.id, q.text
+FROM pack, (VALUES
+    ('Who is most likely to reply-all by accident?'),
+    ('Who is most likely to fall asleep in a meeting?'),
+    ('Who would survive longest without coffee?'),
+    ('Who is most likely to become the boss one day?'),
+    ('Who has the messiest desk?'),
+    ('Who is most likely to forget they are unmuted?'),
+    ('Who sends the longest emails?'),
+    ('Who is most likely to quit and start a farm?'),
+    ('Who always steals the last slice of cake in the kitchen?'),
+    ('Who is most likely to show up to the party in their work badge?')
+) AS q(text);
+
+WITH pack AS (
+    INSERT INTO burn_book_packs (slug, name, description, is_premium)
+    VALUES ('spicy', 'Spicy', 'Not for the faint of heart. Premium only.', TRUE)
+    ON CONFLICT (slug) DO NOTHING
+    RETURNING id
+)
+INSERT INTO burn_book_questions (pack_id, text)
+SELECT pack.id, q.text
+FROM pack, (VALUES
+    ('Who is most likely to text their ex tonight?'),
+    ('Who has the worst taste in partners?'),
+    ('Who is most likely to get kicked out of a bar?'),
+    ('Who has the wildest search history?'),
+    ('Who is most likely to have a secret dating profile?'),
+    ('Who would be the first to skinny dip?'),
+    ('Who is most likely to wake up somewhere they don''t recognise?'),
+    ('Who has told the biggest lie in this room?'),
+    ('Who is most likely to hook up with someone here?'),
+    ('Who would last the shortest on a dating show?')
+) AS q(text);
@@ -0,0 +1,3 @@
+-- When a dispatcher took the notification to send it. Once the lease runs out another one can take it,
+-- so notifications claimed by an instance that went down still go out.
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- The digest a rate limited notification went out in. It's marked sent once that digest is delivered.
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS digest_id UUID REFERENCES notifications(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS notifications_digest_id_idx ON notifications (digest_id) WHERE digest_id IS NOT NULL;
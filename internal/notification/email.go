@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"outDrinkMeAPI/internal/types/notification"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig is where emails are sent from. Username empty means the server takes mail without logging in.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string // e.g. "OutDrinkMe <no-reply@outdrinkme.app>"
+
+	// ImplicitTLS starts the connection with TLS, as servers on port 465 expect. Otherwise
+	// the connection is upgraded with STARTTLS when the server offers it.
+	ImplicitTLS bool
+	TLSConfig   *tls.Config // nil checks the server's certificate against the system roots
+}
+
+// SMTPConfigFromEnv reads SMTP_HOST, SMTP_PORT (587 if unset), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and
+// SMTP_IMPLICIT_TLS (on by default for port 465). ok is false when SMTP_HOST isn't set.
+func SMTPConfigFromEnv() (cfg SMTPConfig, ok bool) {
+	cfg = SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+		cfg.Port = port
+	}
+	cfg.ImplicitTLS = cfg.Port == 465
+	if implicit, err := strconv.ParseBool(os.Getenv("SMTP_IMPLICIT_TLS")); err == nil {
+		cfg.ImplicitTLS = implicit
+	}
+	return cfg, cfg.Host != ""
+}
+
+// SMTPEmailService emails notifications as a text and an HTML part, rendered from the notification type's templates
+type SMTPEmailService struct {
+	cfg  SMTPConfig
+	from string // just the address, for MAIL FROM
+}
+
+func NewSMTPEmailService(cfg SMTPConfig) (*SMTPEmailService, error) {
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, fmt.Errorf("SMTP host and from address are required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %v", cfg.From, err)
+	}
+	return &SMTPEmailService{cfg: cfg, from: from.Address}, nil
+}
+
+// SendNotificationEmail renders notif for the user and sends it to them
+func (s *SMTPEmailService) SendNotificationEmail(ctx context.Context, to notification.EmailRecipient, notif *notification.Notification) error {
+	subject, text, html, err := renderEmail(to, notif)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email: %w", notif.Type, err)
+	}
+
+	msg, err := buildEmail(s.cfg.From, to.Email, subject, text, html)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	return s.send(ctx, to.Email, msg)
+}
+
+// send talks SMTP itself rather than using smtp.SendMail, so the request's deadline applies
+func (s *SMTPEmailService) send(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+
+	var conn net.Conn
+	var err error
+	if s.cfg.ImplicitTLS {
+		dialer := tls.Dialer{Config: s.tlsConfig()}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && !s.cfg.ImplicitTLS {
+		if err := c.StartTLS(s.tlsConfig()); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT TO failed: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("server refused the email: %w", err)
+	}
+	return c.Quit()
+}
+
+func (s *SMTPEmailService) tlsConfig() *tls.Config {
+	if s.cfg.TLSConfig == nil {
+		return &tls.Config{ServerName: s.cfg.Host}
+	}
+	cfg := s.cfg.TLSConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = s.cfg.Host
+	}
+	return cfg
+}
+
+// buildEmail makes a multipart/alternative message, text first so clients that can show HTML prefer it
+func buildEmail(from, to, subject, text, html string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		w.Write([]byte(part.content))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
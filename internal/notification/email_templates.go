@@ -0,0 +1,163 @@
+package notification
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"outDrinkMeAPI/internal/types/notification"
+	"strings"
+	texttemplate "text/template"
+)
+
+// emailTemplate is the copy for a notification type's email. The title and body are the notification's own,
+// already rendered from notification_templates, the email adds a greeting and a call to action around them.
+type emailTemplate struct {
+	subject string
+	text    string
+	html    string // goes inside emailLayout
+}
+
+// emailData is what the templates can use
+type emailData struct {
+	Username string
+	Title    string
+	Body     string
+	Link     string
+	Action   string
+	Data     map[string]any
+}
+
+// emailTemplates are the types with copy of their own, any other type uses defaultEmailTemplate
+var emailTemplates = map[notification.NotificationType]emailTemplate{
+	notification.TypeStreakMilestone: {
+		subject: "🔥 {{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nKeep the streak alive, log tonight's drinks in the app.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>Keep the streak alive, log tonight's drinks in the app.</p>`,
+	},
+	notification.TypeFriendOvertookYou: {
+		subject: "{{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nTime to win your spot back.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>Time to win your spot back.</p>`,
+	},
+	notification.TypeMentionedInPost: {
+		subject: "📸 {{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nSee how you made it into the night and add your side of the story.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>See how you made it into the night and add your side of the story.</p>`,
+	},
+	notification.TypeDrunkThoughtReaction: {
+		subject: "💭 {{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nYour drunk thought struck a chord. Got another one in you tonight?",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>Your drunk thought struck a chord. Got another one in you tonight?</p>`,
+	},
+	notification.TypeFriendPostedMix: {
+		subject: "🍻 {{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nSee what your friends are drinking and leave a reaction.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>See what your friends are drinking and leave a reaction.</p>`,
+	},
+	notification.TypeFriendPostedStory: {
+		subject: "{{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nCatch up on how their night is going.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>Catch up on how their night is going.</p>`,
+	},
+	notification.TypeFriendPostedReaction: {
+		subject: "❤️ {{.Title}}",
+		text:    "Hey {{.Username}},\n\n{{.Body}}\n\nSee who's hyping up your post.",
+		html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p><p>See who's hyping up your post.</p>`,
+	},
+}
+
+var defaultEmailTemplate = emailTemplate{
+	subject: "{{.Title}}",
+	text:    "Hey {{.Username}},\n\n{{.Body}}",
+	html:    `<p>Hey {{.Username}},</p><p>{{.Body}}</p>`,
+}
+
+// emailActions label the button, shown when the notification has a link
+var emailActions = map[notification.NotificationType]string{
+	notification.TypeFriendOvertookYou:    "See the leaderboard",
+	notification.TypeMentionedInPost:      "See the post",
+	notification.TypeDrunkThoughtReaction: "See your drunk thought",
+	notification.TypeFriendPostedMix:      "Open the Mix",
+	notification.TypeFriendPostedStory:    "Watch the story",
+	notification.TypeFriendPostedReaction: "See the reaction",
+}
+
+const defaultEmailAction = "Open OutDrinkMe"
+
+const emailLayout = `<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#0f0f0f;font-family:Helvetica,Arial,sans-serif;color:#f2f2f2">
+<div style="max-width:480px;margin:0 auto;background:#1c1c1c;border-radius:12px;padding:24px">
+<h2 style="margin-top:0;color:#ff8a00">{{.Title}}</h2>
+{{template "content" .}}
+{{if .Link}}<p style="margin-top:24px"><a href="{{.Link}}" style="background:#ff8a00;color:#0f0f0f;padding:12px 20px;border-radius:8px;text-decoration:none;font-weight:bold">{{.Action}}</a></p>{{end}}
+<p style="margin-top:32px;font-size:12px;color:#8a8a8a">You're getting this because email notifications are on. Turn them off in the app under Settings, Notifications.</p>
+</div>
+</body>
+</html>`
+
+const textFooter = "{{if .Link}}\n\n{{.Action}}: {{.Link}}{{end}}\n\n--\nYou're getting this because email notifications are on. Turn them off in the app under Settings, Notifications.\n"
+
+// parsedEmail is an emailTemplate ready to execute, the HTML already inside the layout and the text with its footer
+type parsedEmail struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Parsed once at start up, a broken template panics there rather than failing every send
+var (
+	parsedEmails       = make(map[notification.NotificationType]parsedEmail, len(emailTemplates))
+	defaultParsedEmail = parseEmail(defaultEmailTemplate)
+)
+
+func init() {
+	for notifType, tmpl := range emailTemplates {
+		parsedEmails[notifType] = parseEmail(tmpl)
+	}
+}
+
+func parseEmail(tmpl emailTemplate) parsedEmail {
+	page := htmltemplate.Must(htmltemplate.New("email").Parse(emailLayout))
+	htmltemplate.Must(page.New("content").Parse(tmpl.html))
+	return parsedEmail{
+		subject: texttemplate.Must(texttemplate.New("subject").Parse(tmpl.subject)),
+		text:    texttemplate.Must(texttemplate.New("text").Parse(tmpl.text + textFooter)),
+		html:    page,
+	}
+}
+
+// renderEmail fills in notif's templates for the user
+func renderEmail(to notification.EmailRecipient, notif *notification.Notification) (subject, text, html string, err error) {
+	tmpl, ok := parsedEmails[notif.Type]
+	if !ok {
+		tmpl = defaultParsedEmail
+	}
+	action, ok := emailActions[notif.Type]
+	if !ok {
+		action = defaultEmailAction
+	}
+
+	data := emailData{
+		Username: to.Username,
+		Title:    notif.Title,
+		Body:     notif.Body,
+		Action:   action,
+		Data:     notif.Data,
+	}
+	// Only web links make sense in an email, app deep links don't open from a mail client
+	if notif.ActionURL != nil && strings.HasPrefix(*notif.ActionURL, "https://") {
+		data.Link = *notif.ActionURL
+	}
+
+	var subjectBuf, textBuf, htmlBuf bytes.Buffer
+	if err = tmpl.subject.Execute(&subjectBuf, data); err != nil {
+		return "", "", "", err
+	}
+	if err = tmpl.text.Execute(&textBuf, data); err != nil {
+		return "", "", "", err
+	}
+	if err = tmpl.html.Execute(&htmlBuf, data); err != nil {
+		return "", "", "", err
+	}
+	return strings.TrimSpace(subjectBuf.String()), textBuf.String(), htmlBuf.String(), nil
+}
@@ -7,14 +7,25 @@ import (
 	"log"
 	"os"
 	"outDrinkMeAPI/internal/types/notification"
+	"strings"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
 	"google.golang.org/api/option"
 )
 
+// MessageSender sends one FCM message. *messaging.Client is the real one.
+type MessageSender interface {
+	Send(ctx context.Context, message *messaging.Message) (string, error)
+}
+
 type FCMService struct {
-	client *messaging.Client
+	client MessageSender
+}
+
+// NewFCMServiceWithSender skips the Firebase setup and sends through sender, e.g. a fake in tests
+func NewFCMServiceWithSender(sender MessageSender) *FCMService {
+	return &FCMService{client: sender}
 }
 
 // NewFCMService initializes FCMService. It first attempts to use
@@ -54,68 +65,109 @@ func NewFCMService(localFilePath string) (*FCMService, error) {
 	return &FCMService{client: client}, nil
 }
 
-// SendPush UPDATED to fix 404 Error
-func (s *FCMService) SendPush(ctx context.Context, tokens []notification.DeviceToken, title, body string, data map[string]any) error {
+// SendPush sends msg to every token, one at a time (the /batch endpoint 404s). Android, iOS and web
+// tokens each get their platform's config. Tokens saved before platforms were recorded are Android.
+// Returns an error only if nothing was delivered.
+func (s *FCMService) SendPush(ctx context.Context, tokens []notification.DeviceToken, msg notification.PushMessage) (notification.PushReport, error) {
+	report := notification.PushReport{}
 	if len(tokens) == 0 {
-		return nil
+		return report, nil
+	}
+
+	// FCM data values have to be strings
+	stringData := make(map[string]string)
+	for k, v := range msg.Data {
+		stringData[k] = fmt.Sprintf("%v", v)
 	}
 
-	// 1. Filter Android tokens
-	var androidTokens []string
 	for _, t := range tokens {
-		if t.Platform == "android" || t.Platform == "" {
-			androidTokens = append(androidTokens, t.Token)
+		platform := t.Platform
+		if platform == "" {
+			platform = "android"
 		}
-	}
 
-	if len(androidTokens) == 0 {
-		return nil
+		message, err := buildMessage(t.Token, platform, msg, stringData)
+		if err == nil {
+			_, err = s.client.Send(ctx, message)
+		}
+		if err != nil {
+			log.Printf("FCM: Failed to send to %s token %s: %v", platform, t.Token, err)
+		}
+		report.Add(platform, err)
 	}
 
-	// 2. Convert data to map[string]string
-	stringData := make(map[string]string)
-	for k, v := range data {
-		stringData[k] = fmt.Sprintf("%v", v)
+	log.Printf("FCM: %s", report)
+
+	if report.Sent() == 0 && report.Failed() > 0 {
+		return report, fmt.Errorf("all push notifications failed (%s)", report)
 	}
+	return report, nil
+}
 
-	// 3. SEND ONE BY ONE (Fixes the /batch 404 error)
-	successCount := 0
-	failureCount := 0
+func buildMessage(token, platform string, msg notification.PushMessage, data map[string]string) (*messaging.Message, error) {
+	message := &messaging.Message{
+		Token: token,
+		Notification: &messaging.Notification{
+			Title: msg.Title,
+			Body:  msg.Body,
+		},
+		Data: data,
+	}
+	urgent := msg.Priority == notification.PriorityHigh || msg.Priority == notification.PriorityUrgent
+
+	switch platform {
+	case "android":
+		message.Android = &messaging.AndroidConfig{
+			Priority: "high",
+			Notification: &messaging.AndroidNotification{
+				Sound: "default",
+				// Icon: "notification_icon", // Uncomment if you added the icon in app.json
+			},
+		}
 
-	for _, token := range androidTokens {
-		message := &messaging.Message{
-			Token: token,
-			Notification: &messaging.Notification{
-				Title: title,
-				Body:  body,
+	case "ios":
+		// 10 shows the alert right away, 5 lets iOS hold it to save battery
+		apnsPriority := "5"
+		if urgent {
+			apnsPriority = "10"
+		}
+		message.APNS = &messaging.APNSConfig{
+			Headers: map[string]string{
+				"apns-push-type": "alert",
+				"apns-priority":  apnsPriority,
 			},
-			Data: stringData,
-			Android: &messaging.AndroidConfig{
-				Priority: "high",
-				Notification: &messaging.AndroidNotification{
-					Sound: "default",
-                    // Icon: "notification_icon", // Uncomment if you added the icon in app.json
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Alert: &messaging.ApsAlert{
+						Title: msg.Title,
+						Body:  msg.Body,
+					},
+					Badge:    msg.Badge,
+					Sound:    "default",
+					ThreadID: msg.ThreadID,
 				},
 			},
 		}
 
-		// Send individually
-		_, err := s.client.Send(ctx, message)
-		if err != nil {
-			log.Printf("FCM: Failed to send to token %s: %v", token, err)
-			failureCount++
-		} else {
-			successCount++
+	case "web":
+		urgency := "normal"
+		if urgent {
+			urgency = "high"
+		}
+		message.Webpush = &messaging.WebpushConfig{
+			Headers: map[string]string{"Urgency": urgency},
+			Notification: &messaging.WebpushNotification{
+				Title: msg.Title,
+				Body:  msg.Body,
+				Tag:   msg.ThreadID,
+			},
+		}
+		if strings.HasPrefix(msg.Link, "https://") {
+			message.Webpush.FCMOptions = &messaging.WebpushFCMOptions{Link: msg.Link}
 		}
-	}
-
-	log.Printf("FCM: Sent %d messages, %d failed", successCount, failureCount)
-	
-    // If at least one succeeded, we consider it a success for the batch job
-    // If all failed, return error
-    if successCount == 0 && failureCount > 0 {
-        return fmt.Errorf("all push notifications failed")
-    }
 
-	return nil
-}
\ No newline at end of file
+	default:
+		return nil, fmt.Errorf("unsupported platform %q", platform)
+	}
+	return message, nil
+}
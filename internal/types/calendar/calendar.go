@@ -5,6 +5,7 @@ import "time"
 type CalendarDay struct {
 	Date       time.Time `json:"date" db:"date"`
 	DrankToday bool      `json:"drank_today" db:"drank_today"`
+	GameDrinks int       `json:"game_drinks" db:"game_drinks"` // drinks logged from drinking games that day
 	IsToday    bool      `json:"is_today"`
 }
 
@@ -0,0 +1,50 @@
+package drinkinggame
+
+import (
+	"time"
+)
+
+// GameResult represents a finished game in the 'drinking_game_results' table
+type GameResult struct {
+	ID              string        `json:"id" db:"id"`
+	SessionID       string        `json:"sessionId" db:"session_id"`
+	GameType        string        `json:"gameType" db:"game_type"`
+	WinningSide     string        `json:"winningSide,omitempty" db:"winning_side"` // e.g. "MAFIA", empty when winners are individual players
+	StartedAt       time.Time     `json:"startedAt" db:"started_at"`
+	EndedAt         time.Time     `json:"endedAt" db:"ended_at"`
+	DurationSeconds int           `json:"durationSeconds" db:"duration_seconds"`
+	Participants    []Participant `json:"participants"`
+}
+
+// Participant represents a row in 'drinking_game_participants'
+type Participant struct {
+	UserID     string         `json:"userId" db:"clerk_id"`
+	Username   string         `json:"username" db:"username"`
+	Role       string         `json:"role,omitempty" db:"role"`
+	Won        bool           `json:"won" db:"won"`
+	XPEarned   int            `json:"xpEarned" db:"xp_earned"`
+	GemsEarned int            `json:"gemsEarned" db:"gems_earned"`
+	Stats      map[string]int `json:"stats" db:"stats"` // per game, e.g. "cards_drawn", "votes_received"
+}
+
+// QuestionPack represents a curated set of BurnBook questions in 'burn_book_packs'
+type QuestionPack struct {
+	ID            string    `json:"id" db:"id"`
+	Slug          string    `json:"slug" db:"slug"` // e.g. "spicy", "work-party"
+	Name          string    `json:"name" db:"name"`
+	Description   string    `json:"description" db:"description"`
+	IsPremium     bool      `json:"isPremium" db:"is_premium"`
+	IsActive      bool      `json:"isActive" db:"is_active"` // inactive packs are hidden from players
+	QuestionCount int       `json:"questionCount" db:"question_count"`
+	Locked        bool      `json:"locked,omitempty"` // premium pack the user can't pick without premium
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// PackQuestion represents a row in 'burn_book_questions'
+type PackQuestion struct {
+	ID        string    `json:"id" db:"id"`
+	PackID    string    `json:"packId" db:"pack_id"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
@@ -1,6 +1,9 @@
 package notification
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -75,6 +78,66 @@ type NotificationPreferences struct {
 	UpdatedAt               time.Time       `json:"updated_at" db:"updated_at"`
 }
 
+// QuietUntil reports whether at falls in the user's quiet hours and, if so, when they end. The start and end
+// are times of day in QuietHoursTimezone (UTC if unset or unknown), a window like 23:00-08:00 runs past midnight.
+func (p *NotificationPreferences) QuietUntil(at time.Time) (time.Time, bool) {
+	if !p.QuietHoursEnabled || p.QuietHoursStart == nil || p.QuietHoursEnd == nil {
+		return time.Time{}, false
+	}
+
+	loc := p.location()
+	local := at.In(loc)
+
+	now := local.Hour()*60 + local.Minute()
+	start := p.QuietHoursStart.Hour()*60 + p.QuietHoursStart.Minute()
+	end := p.QuietHoursEnd.Hour()*60 + p.QuietHoursEnd.Minute()
+
+	days := 0 // from today to the end of the window
+	switch {
+	case start == end:
+		return time.Time{}, false
+	case start < end && (now < start || now >= end):
+		return time.Time{}, false
+	case start > end && now >= end && now < start:
+		return time.Time{}, false
+	case start > end && now >= start:
+		days = 1
+	}
+
+	y, m, d := local.Date()
+	return time.Date(y, m, d+days, p.QuietHoursEnd.Hour(), p.QuietHoursEnd.Minute(), 0, 0, loc), true
+}
+
+// Day is the user's calendar day that at falls in, from midnight to midnight in QuietHoursTimezone
+func (p *NotificationPreferences) Day(at time.Time) (start, end time.Time) {
+	loc := p.location()
+	y, m, d := at.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
+
+// location is the user's timezone, UTC if it isn't set or isn't one we know
+func (p *NotificationPreferences) location() *time.Location {
+	loc, err := time.LoadLocation(p.QuietHoursTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// RateLimited reports whether hourCount notifications sent in the hour and dayCount in the user's day (see Day)
+// put them at MaxNotificationsPerHour or MaxNotificationsPerDay, and if so when both have room again.
+// A limit of 0 or less is no limit.
+func (p *NotificationPreferences) RateLimited(now time.Time, hourCount, dayCount int) (time.Time, bool) {
+	if p.MaxNotificationsPerDay > 0 && dayCount >= p.MaxNotificationsPerDay {
+		_, dayEnd := p.Day(now)
+		return dayEnd, true
+	}
+	if p.MaxNotificationsPerHour > 0 && hourCount >= p.MaxNotificationsPerHour {
+		return now.Truncate(time.Hour).Add(time.Hour), true
+	}
+	return time.Time{}, false
+}
+
 type DeviceToken struct {
 	Token    string    `json:"token"`
 	Platform string    `json:"platform"` // "ios", "android", "web"
@@ -92,3 +155,113 @@ type NotificationTemplate struct {
 	CreatedAt       time.Time            `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time            `json:"updated_at" db:"updated_at"`
 }
+
+// PushMessage is one notification as the push provider sends it
+type PushMessage struct {
+	Title    string
+	Body     string
+	Data     map[string]any
+	Priority NotificationPriority
+	Badge    *int   // unread count for the iOS app icon, nil leaves the badge as it is
+	ThreadID string // iOS groups notifications with the same thread-id
+	Link     string // opened when a web notification is clicked, must be https
+}
+
+// EmailRecipient is who a notification email goes to
+type EmailRecipient struct {
+	Email    string
+	Username string
+}
+
+// PushResult is how a push went on one platform
+type PushResult struct {
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+}
+
+// PushReport is the result of a push per platform ("ios", "android", "web")
+type PushReport map[string]*PushResult
+
+func (r PushReport) Add(platform string, err error) {
+	if r[platform] == nil {
+		r[platform] = &PushResult{}
+	}
+	if err != nil {
+		r[platform].Failed++
+	} else {
+		r[platform].Sent++
+	}
+}
+
+func (r PushReport) Sent() int {
+	n := 0
+	for _, res := range r {
+		n += res.Sent
+	}
+	return n
+}
+
+func (r PushReport) Failed() int {
+	n := 0
+	for _, res := range r {
+		n += res.Failed
+	}
+	return n
+}
+
+// String reads like "android 2 sent 0 failed, ios 1 sent 1 failed"
+func (r PushReport) String() string {
+	platforms := make([]string, 0, len(r))
+	for platform := range r {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	parts := make([]string, len(platforms))
+	for i, platform := range platforms {
+		parts[i] = fmt.Sprintf("%s %d sent %d failed", platform, r[platform].Sent, r[platform].Failed)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// digestVerbs finish a digest's sentence for each type, after who did it
+var digestVerbs = map[NotificationType]string{
+	TypeFriendOvertookYou:    "overtook you on the leaderboard",
+	TypeMentionedInPost:      "mentioned you in a post",
+	TypeDrunkThoughtReaction: "reacted to your drunk thoughts",
+	TypeFriendPostedMix:      "posted to the Mix",
+	TypeFriendPostedStory:    "posted a story",
+	TypeFriendPostedReaction: "reacted to your post",
+}
+
+// DigestMessage sums up count notifications of one type that were held back by the rate limit, e.g.
+// "Ivan and 4 others posted to the Mix". actors are who caused them, most recent first, repeats allowed.
+func DigestMessage(notifType NotificationType, actors []string, count int) string {
+	verb, ok := digestVerbs[notifType]
+	if !ok {
+		return fmt.Sprintf("You have %d new notifications", count)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, actor := range actors {
+		if actor != "" && !seen[actor] {
+			seen[actor] = true
+			names = append(names, actor)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return fmt.Sprintf("%d friends %s", count, verb)
+	case 1:
+		if count > 1 {
+			return fmt.Sprintf("%s %s %d times", names[0], verb, count)
+		}
+		return fmt.Sprintf("%s %s", names[0], verb)
+	case 2:
+		return fmt.Sprintf("%s and %s %s", names[0], names[1], verb)
+	default:
+		return fmt.Sprintf("%s and %d others %s", names[0], len(names)-1, verb)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/PaddleHQ/paddle-go-sdk"
@@ -17,6 +18,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"outDrinkMeAPI/handlers"
+	"outDrinkMeAPI/internal/migrations"
 	"outDrinkMeAPI/internal/notification"
 	"outDrinkMeAPI/middleware"
 	"outDrinkMeAPI/services"
@@ -32,6 +34,7 @@ var (
 	notificationService *services.NotificationService
 	photoDumpService    *services.FuncService
 	gameManager         *services.DrinnkingGameManager
+	gameResultService   *services.GameResultService
 	venueService        *services.VenueService
 	paddleService       *services.PaddleService
 )
@@ -84,11 +87,31 @@ func main() {
 		dbPool.Close()
 	}()
 
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := migrations.Apply(migrateCtx, dbPool); err != nil {
+		log.Fatal("Failed to apply database migrations:", err)
+	}
+	cancelMigrate()
+
 	notificationService = services.NewNotificationService(dbPool)
 	userService = services.NewUserService(dbPool, notificationService)
 	storeService = services.NewStoreService(dbPool)
 	photoDumpService = services.NewFuncService(dbPool)
 	gameManager = services.NewDrinnkingGameManager()
+	gameResultService = services.NewGameResultService(dbPool)
+	gameManager.SetResultRecorder(gameResultService)
+	questionPackService := services.NewQuestionPackService(dbPool, userService)
+	gameManager.SetQuestionPacks(questionPackService)
+	// "log_drinks" adds a finished game's drinks to the player's daily log
+	gameManager.SetDrinkLogger(userService)
+	// Comma separated, e.g. CHAT_BLOCKED_WORDS="word1,word2"
+	gameManager.SetChatFilter(services.NewChatFilter(strings.Split(os.Getenv("CHAT_BLOCKED_WORDS"), ",")))
+	// Closes games nobody is playing any more, and caps how long any one game can run
+	gameManager.StartReaper(services.DefaultSessionLimits)
+	// Needed as soon as more than one API instance runs behind the load balancer
+	if os.Getenv("DRINKING_GAMES_CLUSTER") == "true" {
+		gameManager.EnableCluster(dbPool)
+	}
 	docService = services.NewDocService(dbPool)
 	venueService = services.NewVenueService(dbPool)
 	paddleService = services.NewPaddleService(paddleClient, dbPool)
@@ -99,7 +122,8 @@ func main() {
 	notificationHandler := handlers.NewNotificationHandler(notificationService)
 	webhookHandler := handlers.NewWebhookHandler(userService)
 	funcHandler := handlers.NewFuncHandler(photoDumpService)
-	drinkingGameHandler := handlers.NewDrinkingGamesHandler(gameManager, userService)
+	drinkingGameHandler := handlers.NewDrinkingGamesHandler(gameManager, userService, gameResultService)
+	questionPackHandler := handlers.NewQuestionPackHandler(questionPackService)
 	venueHandler := handlers.NewVenueHandler(venueService)
 	paddleHandler := handlers.NewPaddleHandler(paddleService)
 
@@ -113,6 +137,16 @@ func main() {
 		log.Println("FCM Push Provider initialized in background")
 	}()
 
+	if smtpConfig, ok := notification.SMTPConfigFromEnv(); ok {
+		email, err := notification.NewSMTPEmailService(smtpConfig)
+		if err != nil {
+			log.Printf("Warning: Could not initialize SMTP: %v", err)
+		} else {
+			notificationService.SetEmailProvider(email)
+			log.Printf("SMTP Email Provider initialized for %s", smtpConfig.Host)
+		}
+	}
+
 	go middleware.CleanupVisitors()
 
 	go func() {
@@ -219,6 +253,7 @@ func main() {
 	protected.HandleFunc("/user/stories", userHandler.GetStories).Methods("GET")
 	protected.HandleFunc("/user/stories", userHandler.AddStory).Methods("POST")
 	protected.HandleFunc("/user/stories/{story_id}", userHandler.DeleteStory).Methods("DELETE")
+	protected.HandleFunc("/user/games/history", drinkingGameHandler.GetGameHistory).Methods("GET")
 	protected.HandleFunc("/user/stories/relate", userHandler.RelateStory).Methods("POST")
 	protected.HandleFunc("/user/stories/seen", userHandler.MarkStoryAsSeen).Methods("POST")
 	protected.HandleFunc("/user/user-stories", userHandler.GetAllUserStories).Methods("GET")
@@ -251,6 +286,9 @@ func main() {
 	protected.HandleFunc("/func/leave", funcHandler.LeaveFunction).Methods("POST")
 	protected.HandleFunc("/func/delete", funcHandler.DeleteImages).Methods("DELETE")
 	protected.HandleFunc("/drinking-games/create", drinkingGameHandler.CreateDrinkingGame).Methods("POST")
+	protected.HandleFunc("/drinking-games/code/{code}", drinkingGameHandler.ResolveJoinCode).Methods("GET")
+	protected.HandleFunc("/drinking-games/matchmaking", drinkingGameHandler.Matchmake).Methods("POST")
+	protected.HandleFunc("/drinking-games/burn-book/packs", questionPackHandler.GetPacks).Methods("GET")
 
 	protected.HandleFunc("/venues", venueHandler.GetAllVenues).Methods("GET")
 	protected.HandleFunc("/venues/employee", venueHandler.GetEmployeeDetails).Methods("GET")
@@ -261,6 +299,18 @@ func main() {
 	protected.HandleFunc("/paddle/price", paddleHandler.GetPrices).Methods("GET")
 	protected.HandleFunc("/paddle/transaction", paddleHandler.CreateTransaction).Methods("POST")
 
+	// ADMIN_CLERK_IDS lists who gets in
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminMiddleware)
+
+	admin.HandleFunc("/burn-book/packs", questionPackHandler.AdminGetPacks).Methods("GET")
+	admin.HandleFunc("/burn-book/packs", questionPackHandler.AdminCreatePack).Methods("POST")
+	admin.HandleFunc("/burn-book/packs/{packId}", questionPackHandler.AdminUpdatePack).Methods("PUT")
+	admin.HandleFunc("/burn-book/packs/{packId}", questionPackHandler.AdminDeletePack).Methods("DELETE")
+	admin.HandleFunc("/burn-book/packs/{packId}/questions", questionPackHandler.AdminGetQuestions).Methods("GET")
+	admin.HandleFunc("/burn-book/packs/{packId}/questions", questionPackHandler.AdminAddQuestions).Methods("POST")
+	admin.HandleFunc("/burn-book/packs/{packId}/questions/{questionId}", questionPackHandler.AdminDeleteQuestion).Methods("DELETE")
+
 	corsHandler := gorilllaHandlers.CORS(
 		gorilllaHandlers.AllowedOrigins([]string{"*"}),
 		gorilllaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
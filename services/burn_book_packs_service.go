@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPackNotFound     = errors.New("question pack not found")
+	ErrPackPremiumOnly  = errors.New("question pack is for premium members")
+	ErrPackSlugTaken    = errors.New("a pack with that slug already exists")
+	ErrQuestionNotFound = errors.New("question not found")
+)
+
+// QuestionPackSource hands BurnBook sessions the questions in a pack. Hosts need premium for premium packs.
+type QuestionPackSource interface {
+	LoadPack(ctx context.Context, packID, hostID string) (*drinkinggame.QuestionPack, []string, error)
+}
+
+// QuestionPackService stores the curated BurnBook packs
+type QuestionPackService struct {
+	db    *pgxpool.Pool
+	users *UserService
+}
+
+func NewQuestionPackService(db *pgxpool.Pool, users *UserService) *QuestionPackService {
+	return &QuestionPackService{db: db, users: users}
+}
+
+const packColumns = `
+	p.id, p.slug, p.name, p.description, p.is_premium, p.is_active, p.created_at, p.updated_at,
+	(SELECT COUNT(*) FROM burn_book_questions q WHERE q.pack_id = p.id)
+`
+
+func scanPack(row pgx.Row) (*drinkinggame.QuestionPack, error) {
+	var p drinkinggame.QuestionPack
+	err := row.Scan(&p.ID, &p.Slug, &p.Name, &p.Description, &p.IsPremium, &p.IsActive, &p.CreatedAt, &p.UpdatedAt, &p.QuestionCount)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *QuestionPackService) queryPacks(ctx context.Context, activeOnly bool) ([]drinkinggame.QuestionPack, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+packColumns+`
+		FROM burn_book_packs p
+		WHERE p.is_active OR NOT $1
+		ORDER BY p.is_premium, p.name
+	`, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get question packs: %w", err)
+	}
+	defer rows.Close()
+
+	packs := []drinkinggame.QuestionPack{}
+	for rows.Next() {
+		p, err := scanPack(rows)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, *p)
+	}
+	return packs, rows.Err()
+}
+
+// ListPacks returns the packs players can pick from. Premium packs are marked locked unless the user has premium.
+func (s *QuestionPackService) ListPacks(ctx context.Context, clerkID string) ([]drinkinggame.QuestionPack, error) {
+	packs, err := s.queryPacks(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	premium, err := s.hasPremium(ctx, clerkID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range packs {
+		packs[i].Locked = packs[i].IsPremium && !premium
+	}
+	return packs, nil
+}
+
+// LoadPack returns an active pack and its questions for a BurnBook game
+func (s *QuestionPackService) LoadPack(ctx context.Context, packID, hostID string) (*drinkinggame.QuestionPack, []string, error) {
+	id, err := uuid.Parse(packID)
+	if err != nil {
+		return nil, nil, ErrPackNotFound
+	}
+
+	pack, err := s.getPack(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !pack.IsActive {
+		return nil, nil, ErrPackNotFound
+	}
+
+	if pack.IsPremium {
+		premium, err := s.hasPremium(ctx, hostID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !premium {
+			return pack, nil, ErrPackPremiumOnly
+		}
+	}
+
+	questions, err := s.GetQuestions(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	texts := make([]string, len(questions))
+	for i, q := range questions {
+		texts[i] = q.Text
+	}
+	return pack, texts, nil
+}
+
+func (s *QuestionPackService) hasPremium(ctx context.Context, clerkID string) (bool, error) {
+	details, err := s.users.GetPremiumDetails(ctx, clerkID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check premium: %w", err)
+	}
+	return details != nil && details.IsActive, nil
+}
+
+func (s *QuestionPackService) getPack(ctx context.Context, packID uuid.UUID) (*drinkinggame.QuestionPack, error) {
+	pack, err := scanPack(s.db.QueryRow(ctx, `
+		SELECT `+packColumns+`
+		FROM burn_book_packs p
+		WHERE p.id = $1
+	`, packID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPackNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get question pack: %w", err)
+	}
+	return pack, nil
+}
+
+// --- Admin ---
+
+// ListAllPacks returns every pack, inactive ones included
+func (s *QuestionPackService) ListAllPacks(ctx context.Context) ([]drinkinggame.QuestionPack, error) {
+	return s.queryPacks(ctx, false)
+}
+
+// CreatePack adds an empty pack. Questions are added with AddQuestions.
+func (s *QuestionPackService) CreatePack(ctx context.Context, pack *drinkinggame.QuestionPack) error {
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO burn_book_packs (slug, name, description, is_premium, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`, pack.Slug, pack.Name, pack.Description, pack.IsPremium, pack.IsActive).Scan(&pack.ID, &pack.CreatedAt, &pack.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrPackSlugTaken
+		}
+		return fmt.Errorf("failed to create question pack: %w", err)
+	}
+	return nil
+}
+
+// UpdatePack overwrites the details of the pack with packID
+func (s *QuestionPackService) UpdatePack(ctx context.Context, packID uuid.UUID, pack *drinkinggame.QuestionPack) error {
+	pack.ID = packID.String()
+	err := s.db.QueryRow(ctx, `
+		UPDATE burn_book_packs
+		SET slug = $2, name = $3, description = $4, is_premium = $5, is_active = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`, packID, pack.Slug, pack.Name, pack.Description, pack.IsPremium, pack.IsActive).Scan(&pack.CreatedAt, &pack.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPackNotFound
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrPackSlugTaken
+		}
+		return fmt.Errorf("failed to update question pack: %w", err)
+	}
+	return nil
+}
+
+// DeletePack removes a pack and its questions. Games that already loaded it keep their questions.
+func (s *QuestionPackService) DeletePack(ctx context.Context, packID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM burn_book_packs WHERE id = $1`, packID)
+	if err != nil {
+		return fmt.Errorf("failed to delete question pack: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPackNotFound
+	}
+	return nil
+}
+
+// GetQuestions lists a pack's questions, oldest first
+func (s *QuestionPackService) GetQuestions(ctx context.Context, packID uuid.UUID) ([]drinkinggame.PackQuestion, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, pack_id, text, created_at
+		FROM burn_book_questions
+		WHERE pack_id = $1
+		ORDER BY created_at, id
+	`, packID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pack questions: %w", err)
+	}
+	defer rows.Close()
+
+	questions := []drinkinggame.PackQuestion{}
+	for rows.Next() {
+		var q drinkinggame.PackQuestion
+		if err := rows.Scan(&q.ID, &q.PackID, &q.Text, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// AddQuestions appends questions to a pack. Blank ones are skipped.
+func (s *QuestionPackService) AddQuestions(ctx context.Context, packID uuid.UUID, texts []string) ([]drinkinggame.PackQuestion, error) {
+	if _, err := s.getPack(ctx, packID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	added := []drinkinggame.PackQuestion{}
+	for _, text := range texts {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		q := drinkinggame.PackQuestion{Text: text}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO burn_book_questions (pack_id, text)
+			VALUES ($1, $2)
+			RETURNING id, pack_id, created_at
+		`, packID, text).Scan(&q.ID, &q.PackID, &q.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add question: %w", err)
+		}
+		added = append(added, q)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE burn_book_packs SET updated_at = NOW() WHERE id = $1`, packID); err != nil {
+		return nil, fmt.Errorf("failed to touch question pack: %w", err)
+	}
+
+	return added, tx.Commit(ctx)
+}
+
+// DeleteQuestion removes one question from a pack
+func (s *QuestionPackService) DeleteQuestion(ctx context.Context, packID, questionID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM burn_book_questions
+		WHERE pack_id = $1 AND id = $2
+	`, packID, questionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete question: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQuestionNotFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
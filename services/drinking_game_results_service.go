@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Rewards handed out when a drinking game is recorded
+const (
+	gameParticipationXP = 10
+	gameWinXP           = 50
+	gameWinGems         = 5
+
+	// Games with fewer registered players than this are saved without rewards, so nobody farms a game alone
+	minRewardedPlayers = 3
+
+	// A user is paid for at most this many games a day, later games are still saved without rewards
+	maxRewardedGamesPerDay = 20
+)
+
+// GameResultRecorder saves finished drinking games. Sessions call it when an engine reports a game over.
+type GameResultRecorder interface {
+	RecordResult(ctx context.Context, result *drinkinggame.GameResult) error
+}
+
+// GameResultService stores finished games and credits XP and gems on users
+type GameResultService struct {
+	db *pgxpool.Pool
+}
+
+func NewGameResultService(db *pgxpool.Pool) *GameResultService {
+	return &GameResultService{db: db}
+}
+
+// RecordResult saves the game and pays out rewards in one transaction. Participants without
+// a users row (e.g. test accounts and bots) are skipped. Nobody is paid for a game with fewer than
+// minRewardedPlayers registered players, or past their maxRewardedGamesPerDay.
+func (s *GameResultService) RecordResult(ctx context.Context, result *drinkinggame.GameResult) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var winningSide *string
+	if result.WinningSide != "" {
+		winningSide = &result.WinningSide
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO drinking_game_results (session_id, game_type, winning_side, started_at, ended_at, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, result.SessionID, result.GameType, winningSide, result.StartedAt, result.EndedAt, result.DurationSeconds).Scan(&result.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert game result: %w", err)
+	}
+
+	clerkIDs := make([]string, 0, len(result.Participants))
+	for _, p := range result.Participants {
+		clerkIDs = append(clerkIDs, p.UserID)
+	}
+
+	// Locking the users keeps two games ending at once from both slipping under the daily cap
+	rows, err := tx.Query(ctx, `
+		SELECT clerk_id, id FROM users
+		WHERE clerk_id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`, clerkIDs)
+	if err != nil {
+		return fmt.Errorf("failed to look up participants: %w", err)
+	}
+	userIDs := make(map[string]string, len(clerkIDs))
+	for rows.Next() {
+		var clerkID, userID string
+		if err := rows.Scan(&clerkID, &userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to look up participants: %w", err)
+		}
+		userIDs[clerkID] = userID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look up participants: %w", err)
+	}
+
+	rewarded := len(userIDs) >= minRewardedPlayers
+
+	for i := range result.Participants {
+		p := &result.Participants[i]
+
+		userID, ok := userIDs[p.UserID]
+		if !ok {
+			continue
+		}
+
+		p.XPEarned, p.GemsEarned = 0, 0
+		if rewarded {
+			var paidToday int
+			err = tx.QueryRow(ctx, `
+				SELECT COUNT(*)
+				FROM drinking_game_participants dp
+				JOIN drinking_game_results r ON r.id = dp.result_id
+				WHERE dp.user_id = $1 AND dp.xp_earned > 0 AND r.ended_at > NOW() - INTERVAL '1 day'
+			`, userID).Scan(&paidToday)
+			if err != nil {
+				return fmt.Errorf("failed to count rewarded games: %w", err)
+			}
+
+			if paidToday < maxRewardedGamesPerDay {
+				p.XPEarned = gameParticipationXP
+				if p.Won {
+					p.XPEarned += gameWinXP
+					p.GemsEarned = gameWinGems
+				}
+			}
+		}
+
+		stats, err := json.Marshal(p.Stats)
+		if err != nil {
+			return fmt.Errorf("failed to encode stats: %w", err)
+		}
+
+		var role *string
+		if p.Role != "" {
+			role = &p.Role
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO drinking_game_participants (result_id, user_id, username, role, won, xp_earned, gems_earned, stats)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, result.ID, userID, p.Username, role, p.Won, p.XPEarned, p.GemsEarned, stats)
+		if err != nil {
+			return fmt.Errorf("failed to insert participant: %w", err)
+		}
+		if p.XPEarned == 0 && p.GemsEarned == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE users
+			SET xp = xp + $2, gems = gems + $3
+			WHERE id = $1
+		`, userID, p.XPEarned, p.GemsEarned)
+		if err != nil {
+			return fmt.Errorf("failed to credit rewards: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetUserGameHistory lists the games a user took part in, newest first
+func (s *GameResultService) GetUserGameHistory(ctx context.Context, clerkID string, page, limit int) ([]drinkinggame.GameResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	rows, err := s.db.Query(ctx, `
+		SELECT r.id, r.session_id, r.game_type, COALESCE(r.winning_side, ''), r.started_at, r.ended_at, r.duration_seconds
+		FROM drinking_game_results r
+		JOIN drinking_game_participants p ON p.result_id = r.id
+		JOIN users u ON u.id = p.user_id
+		WHERE u.clerk_id = $1
+		ORDER BY r.ended_at DESC
+		LIMIT $2 OFFSET $3
+	`, clerkID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []drinkinggame.GameResult{}
+	index := make(map[string]int)
+	ids := []string{}
+	for rows.Next() {
+		var r drinkinggame.GameResult
+		if err := rows.Scan(&r.ID, &r.SessionID, &r.GameType, &r.WinningSide, &r.StartedAt, &r.EndedAt, &r.DurationSeconds); err != nil {
+			return nil, err
+		}
+		r.Participants = []drinkinggame.Participant{}
+		index[r.ID] = len(history)
+		ids = append(ids, r.ID)
+		history = append(history, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return history, nil
+	}
+
+	participantRows, err := s.db.Query(ctx, `
+		SELECT p.result_id, u.clerk_id, p.username, COALESCE(p.role, ''), p.won, p.xp_earned, p.gems_earned, p.stats
+		FROM drinking_game_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.result_id = ANY($1::uuid[])
+		ORDER BY p.won DESC, p.username
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game participants: %w", err)
+	}
+	defer participantRows.Close()
+
+	for participantRows.Next() {
+		var resultID string
+		var stats []byte
+		var p drinkinggame.Participant
+		if err := participantRows.Scan(&resultID, &p.UserID, &p.Username, &p.Role, &p.Won, &p.XPEarned, &p.GemsEarned, &stats); err != nil {
+			return nil, err
+		}
+		if len(stats) > 0 {
+			json.Unmarshal(stats, &p.Stats)
+		}
+		i := index[resultID]
+		history[i].Participants = append(history[i].Participants, p)
+	}
+
+	return history, participantRows.Err()
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
+)
+
+// Chat channels. Every game has "all", engines can open more through ChatRules.
+const (
+	ChatChannelAll   = "all"
+	ChatChannelDead  = "dead"  // Mafia: players who died, and spectators
+	ChatChannelMafia = "mafia" // Mafia: the mafia talking at night
+)
+
+const (
+	// How many messages a session keeps to replay to people who join later
+	chatHistoryLimit = 100
+
+	maxChatLength = 300 // runes
+
+	// Each sender gets a burst of chatBurst messages, then one every chatInterval
+	chatInterval = time.Second
+	chatBurst    = 5
+)
+
+// ChatMessage is sent to everyone who can read its channel
+type ChatMessage struct {
+	Action   string    `json:"action"` // always "chat"
+	ID       int64     `json:"id"`     // increases per session, lets clients drop messages they already have after a replay
+	Channel  string    `json:"channel"`
+	UserID   string    `json:"userId"`
+	Username string    `json:"username"`
+	Content  string    `json:"content"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// ChatRules is implemented by engines that limit who can talk to whom.
+// Engines without it get the "all" channel only, open to everyone in the session.
+type ChatRules interface {
+	// CanPost returns an error for the sender if they can't post to channel right now
+	CanPost(session *Session, sender *Client, channel string) error
+	// CanRead reports whether reader gets messages posted to channel
+	CanRead(session *Session, reader *Client, channel string) bool
+}
+
+// ChatFilter masks blocked words in chat messages
+type ChatFilter struct {
+	pattern *regexp.Regexp // nil when nothing is blocked
+}
+
+// NewChatFilter blocks the given words, matched case-insensitively as whole words in any script. Blank entries are skipped.
+func NewChatFilter(words []string) *ChatFilter {
+	quoted := []string{}
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return &ChatFilter{}
+	}
+	// Longest first, so "heckin" isn't matched as "heck" and then thrown out for running into "in"
+	slices.SortFunc(quoted, func(a, b string) int { return len(b) - len(a) })
+
+	// \b only knows ASCII, so the start of a word is matched by hand and the end is checked in Clean
+	return &ChatFilter{pattern: regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}\p{M}_])(` + strings.Join(quoted, "|") + `)`)}
+}
+
+// Clean replaces every blocked word with asterisks
+func (f *ChatFilter) Clean(text string) string {
+	if f == nil || f.pattern == nil {
+		return text
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, m := range f.pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], m[3]
+		if next, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(next) {
+			continue // only the start of a longer word
+		}
+		out.WriteString(text[last:start])
+		out.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[start:end])))
+		last = end
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_'
+}
+
+func newChatLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Every(chatInterval), chatBurst)
+}
+
+// PostChat checks a chat message against the rate limit and the engine's rules, filters it,
+// and sends it to everyone who can read the channel. An empty channel means "all".
+func (s *Session) PostChat(sender *Client, channel, content string) error {
+	if channel == "" {
+		channel = ChatChannelAll
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return gameError(ErrCodeBadRequest, "the message is empty")
+	}
+	if utf8.RuneCountInString(content) > maxChatLength {
+		return gameError(ErrCodeBadRequest, "messages can be at most %d characters", maxChatLength)
+	}
+
+	if !sender.chatLimiter.Allow() {
+		return gameError(ErrCodeRateLimited, "slow down, you're sending messages too fast")
+	}
+
+	if rules, ok := s.GameEngine.(ChatRules); ok {
+		if err := rules.CanPost(s, sender, channel); err != nil {
+			return err
+		}
+	} else if channel != ChatChannelAll {
+		return gameError(ErrCodeBadRequest, "there's no %q channel in this game", channel)
+	}
+
+	msg := ChatMessage{
+		Action:   "chat",
+		Channel:  channel,
+		UserID:   sender.UserID,
+		Username: sender.Username,
+		Content:  s.chatFilter().Clean(content),
+		SentAt:   s.Clock.Now(),
+	}
+
+	// Held while sending too, so a replay never misses a message that's on its way out
+	s.chatMu.Lock()
+	defer s.chatMu.Unlock()
+
+	s.chatSeq++
+	msg.ID = s.chatSeq
+	s.chatHistory = append(s.chatHistory, msg)
+	if len(s.chatHistory) > chatHistoryLimit {
+		s.chatHistory = s.chatHistory[len(s.chatHistory)-chatHistoryLimit:]
+	}
+
+	data, _ := json.Marshal(msg)
+	for _, client := range s.clientList() {
+		if s.canRead(client, channel) {
+			client.trySend(data)
+		}
+	}
+	return nil
+}
+
+// replayChat sends a client the history they're allowed to see, after they join or reconnect
+func (s *Session) replayChat(client *Client) {
+	s.chatMu.Lock()
+	defer s.chatMu.Unlock()
+
+	messages := []ChatMessage{}
+	for _, msg := range s.chatHistory {
+		if s.canRead(client, msg.Channel) {
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"action":   "chat_history",
+		"messages": messages,
+	})
+	client.trySend(data)
+}
+
+func (s *Session) canRead(client *Client, channel string) bool {
+	if rules, ok := s.GameEngine.(ChatRules); ok {
+		return rules.CanRead(s, client, channel)
+	}
+	return channel == ChatChannelAll
+}
+
+func (s *Session) chatFilter() *ChatFilter {
+	if s.Manager == nil {
+		return nil
+	}
+	return s.Manager.chatFilter
+}
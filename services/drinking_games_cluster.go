@@ -0,0 +1,528 @@
+// Multi-instance support for drinking games. A session lives on exactly one node, the one it was created on,
+// which runs its Run() loop and game engine. A socket that lands on another node is relayed to the owner over
+// Postgres LISTEN/NOTIFY: every node listens on its own channel, the owner sees the remote player as a normal
+// Client and everything put on its Send channel is forwarded back to the node holding the socket.
+//
+// LISTEN needs a direct connection, not one behind a transaction pooler. The tables are created by
+// internal/migrations/sql/0001_drinking_game_cluster.sql.
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// How often a node refreshes the sessions it owns in drinking_game_sessions
+	clusterHeartbeat = 15 * time.Second
+
+	// Sessions whose node hasn't checked in for this long are treated as gone
+	clusterStaleAfter = 45 * time.Second
+
+	// NOTIFY payloads must stay under 8000 bytes, anything bigger is parked in drinking_game_relay
+	maxNotifyPayload = 7000
+
+	// Messages from a remote socket waiting for the session to pick them up
+	relayInboxSize = 64
+
+	// Parked messages nobody fetched by now belong to a node that went away
+	relayExpiry = time.Minute
+)
+
+// relayTarget points at a socket held by another node
+type relayTarget struct {
+	NodeID string
+	ConnID string
+}
+
+// clusterMessage is what nodes send each other. "join", "message" and "leave" go from the node holding
+// the socket to the session owner, "deliver" and "close" go back.
+type clusterMessage struct {
+	Kind      string       `json:"kind"`
+	From      string       `json:"from"`
+	ConnID    string       `json:"connId,omitempty"`
+	SessionID string       `json:"sessionId,omitempty"`
+	Join      *JoinRequest `json:"join,omitempty"`
+	Data      string       `json:"data,omitempty"`
+	RelayID   int64        `json:"relayId,omitempty"` // the full message is in drinking_game_relay
+}
+
+// edgeConn is a socket on this node whose session is owned by another node
+type edgeConn struct {
+	client    *Client // only Conn, Send and link are used, it never joins a local session
+	sessionID string
+	owner     string
+}
+
+// GameCluster shares drinking game sessions between API instances
+type GameCluster struct {
+	db      *pgxpool.Pool
+	nodeID  string
+	manager *DrinnkingGameManager
+
+	mu     sync.Mutex
+	remote map[string]chan []byte // ConnID -> inbox of a player relayed in from another node
+	edges  map[string]*edgeConn   // ConnID -> socket relayed out to the owning node
+}
+
+func newGameCluster(db *pgxpool.Pool, manager *DrinnkingGameManager) *GameCluster {
+	return &GameCluster{
+		db:      db,
+		nodeID:  strings.ReplaceAll(uuid.New().String(), "-", ""),
+		manager: manager,
+		remote:  make(map[string]chan []byte),
+		edges:   make(map[string]*edgeConn),
+	}
+}
+
+func clusterChannel(nodeID string) string {
+	return "drinking_games_" + nodeID
+}
+
+// --- Session registry ---
+
+// saveSession records that this node owns s, along with what the lobby list needs. It fails with a
+// unique violation when another node already uses s.JoinCode.
+func (gc *GameCluster) saveSession(s *Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	players, spectators := s.counts()
+	hostID, hostUsername := s.host()
+
+	query := `
+		INSERT INTO drinking_game_sessions (
+			id, node_id, join_code, game_type, host_id, host_username,
+			is_public, password_hash, max_players, players, spectators, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			host_id = EXCLUDED.host_id,
+			host_username = EXCLUDED.host_username,
+			players = EXCLUDED.players,
+			spectators = EXCLUDED.spectators,
+			updated_at = NOW()
+	`
+	_, err := gc.db.Exec(ctx, query,
+		s.ID, gc.nodeID, s.JoinCode, s.GameType, hostID, hostUsername,
+		s.Settings.IsPublic, s.Settings.passwordHash, s.Settings.MaxPlayers, players, spectators,
+	)
+	return err
+}
+
+func (gc *GameCluster) removeSession(sessionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := gc.db.Exec(ctx, `DELETE FROM drinking_game_sessions WHERE id = $1 AND node_id = $2`, sessionID, gc.nodeID); err != nil {
+		log.Printf("[Cluster] Failed to remove session %s: %v", sessionID, err)
+	}
+}
+
+const clusterSessionColumns = `
+	id, node_id, join_code, game_type, host_id, host_username,
+	is_public, password_hash, max_players, players, spectators
+`
+
+func scanSessionInfo(row pgx.Row) (*SessionInfo, error) {
+	var info SessionInfo
+	var hash []byte
+	err := row.Scan(
+		&info.ID, &info.NodeID, &info.JoinCode, &info.GameType, &info.HostID, &info.HostUsername,
+		&info.Settings.IsPublic, &hash, &info.Settings.MaxPlayers, &info.Players, &info.Spectators,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) > 0 {
+		info.Settings.passwordHash = hash
+		info.Settings.HasPassword = true
+	}
+	return &info, nil
+}
+
+// findSession looks up a live session on any node by a column of drinking_game_sessions
+func (gc *GameCluster) findSession(ctx context.Context, column, value string) (*SessionInfo, bool) {
+	query := `SELECT ` + clusterSessionColumns + ` FROM drinking_game_sessions
+		WHERE ` + pgx.Identifier{column}.Sanitize() + ` = $1 AND updated_at > NOW() - make_interval(secs => $2)`
+
+	info, err := scanSessionInfo(gc.db.QueryRow(ctx, query, value, clusterStaleAfter.Seconds()))
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			log.Printf("[Cluster] Session lookup by %s failed: %v", column, err)
+		}
+		return nil, false
+	}
+	return info, true
+}
+
+// publicSessions lists public sessions from every node
+func (gc *GameCluster) publicSessions(ctx context.Context) ([]PublicGameResponse, error) {
+	query := `SELECT ` + clusterSessionColumns + ` FROM drinking_game_sessions
+		WHERE is_public AND updated_at > NOW() - make_interval(secs => $1)
+		ORDER BY updated_at DESC`
+
+	rows, err := gc.db.Query(ctx, query, clusterStaleAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := []PublicGameResponse{}
+	for rows.Next() {
+		info, err := scanSessionInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		// Our own sessions can report live numbers instead of the last heartbeat
+		if s, ok := gc.manager.GetSession(info.ID); ok {
+			info = s.info(gc.nodeID)
+		}
+		games = append(games, info.publicGame())
+	}
+	return games, rows.Err()
+}
+
+// heartbeat keeps this node's sessions fresh, drops relayed sockets whose owner went away and
+// clears out what dead nodes left behind
+func (gc *GameCluster) heartbeat() {
+	ticker := time.NewTicker(clusterHeartbeat)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, s := range gc.manager.localSessions() {
+			if err := gc.saveSession(s); err != nil {
+				log.Printf("[Cluster] Failed to save session %s: %v", s.ID, err)
+			}
+		}
+		gc.closeOrphanedEdges()
+		gc.purgeStale()
+	}
+}
+
+// purgeStale deletes sessions no node has refreshed in a while, which also frees their join codes,
+// and parked messages that were never fetched
+func (gc *GameCluster) purgeStale() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := gc.db.Exec(ctx, `DELETE FROM drinking_game_sessions WHERE updated_at < NOW() - make_interval(secs => $1)`, clusterStaleAfter.Seconds())
+	if err != nil {
+		log.Printf("[Cluster] Failed to purge stale sessions: %v", err)
+	}
+
+	_, err = gc.db.Exec(ctx, `DELETE FROM drinking_game_relay WHERE created_at < NOW() - make_interval(secs => $1)`, relayExpiry.Seconds())
+	if err != nil {
+		log.Printf("[Cluster] Failed to purge parked messages: %v", err)
+	}
+}
+
+func (gc *GameCluster) closeOrphanedEdges() {
+	gc.mu.Lock()
+	sessionIDs := make([]string, 0, len(gc.edges))
+	for _, edge := range gc.edges {
+		sessionIDs = append(sessionIDs, edge.sessionID)
+	}
+	gc.mu.Unlock()
+
+	if len(sessionIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := gc.db.Query(ctx, `
+		SELECT id FROM drinking_game_sessions
+		WHERE id = ANY($1) AND updated_at > NOW() - make_interval(secs => $2)
+	`, sessionIDs, clusterStaleAfter.Seconds())
+	if err != nil {
+		log.Printf("[Cluster] Failed to check relayed sessions: %v", err)
+		return
+	}
+	alive, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("[Cluster] Failed to check relayed sessions: %v", err)
+		return
+	}
+	aliveSet := make(map[string]bool, len(alive))
+	for _, id := range alive {
+		aliveSet[id] = true
+	}
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	for _, edge := range gc.edges {
+		if !aliveSet[edge.sessionID] {
+			// Closing the socket ends both pumps, the client reconnects and finds out the game is gone
+			edge.client.Conn.Close()
+		}
+	}
+}
+
+// --- Messaging between nodes ---
+
+func (gc *GameCluster) publish(nodeID string, msg clusterMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg.From = gc.nodeID
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[Cluster] Failed to encode %s message: %v", msg.Kind, err)
+		return
+	}
+
+	if len(payload) > maxNotifyPayload {
+		var relayID int64
+		err := gc.db.QueryRow(ctx, `INSERT INTO drinking_game_relay (payload) VALUES ($1) RETURNING id`, string(payload)).Scan(&relayID)
+		if err != nil {
+			log.Printf("[Cluster] Failed to park %s message: %v", msg.Kind, err)
+			return
+		}
+		payload, _ = json.Marshal(clusterMessage{Kind: msg.Kind, From: gc.nodeID, RelayID: relayID})
+	}
+
+	if _, err := gc.db.Exec(ctx, `SELECT pg_notify($1, $2)`, clusterChannel(nodeID), string(payload)); err != nil {
+		log.Printf("[Cluster] Failed to notify node %s: %v", nodeID, err)
+	}
+}
+
+// listen receives messages for this node until the process exits. Messages sent while the
+// listener is reconnecting are lost, the affected clients recover by reconnecting.
+func (gc *GameCluster) listen() {
+	for {
+		if err := gc.listenOnce(); err != nil {
+			log.Printf("[Cluster] Listener stopped: %v, retrying", err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (gc *GameCluster) listenOnce() error {
+	ctx := context.Background()
+
+	pooled, err := gc.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays in LISTEN mode, so it never goes back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{clusterChannel(gc.nodeID)}.Sanitize()); err != nil {
+		return err
+	}
+	log.Printf("[Cluster] Node %s listening for drinking game relays", gc.nodeID)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		gc.handleNotification(notification.Payload)
+	}
+}
+
+func (gc *GameCluster) handleNotification(payload string) {
+	var msg clusterMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Printf("[Cluster] Dropping malformed message: %v", err)
+		return
+	}
+
+	if msg.RelayID != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := gc.db.QueryRow(ctx, `DELETE FROM drinking_game_relay WHERE id = $1 RETURNING payload`, msg.RelayID).Scan(&payload)
+		cancel()
+		if err != nil {
+			log.Printf("[Cluster] Failed to fetch parked message %d: %v", msg.RelayID, err)
+			return
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			log.Printf("[Cluster] Dropping malformed message: %v", err)
+			return
+		}
+	}
+
+	switch msg.Kind {
+	case "join":
+		gc.acceptRemote(msg)
+	case "message":
+		gc.mu.Lock()
+		inbox := gc.remote[msg.ConnID]
+		gc.mu.Unlock()
+		if inbox == nil {
+			return
+		}
+		select {
+		case inbox <- []byte(msg.Data):
+		default:
+			log.Printf("[Cluster] Inbox full for %s, dropping message", msg.ConnID)
+		}
+	case "leave":
+		gc.mu.Lock()
+		inbox := gc.remote[msg.ConnID]
+		delete(gc.remote, msg.ConnID)
+		gc.mu.Unlock()
+		if inbox != nil {
+			close(inbox)
+		}
+	case "deliver":
+		gc.mu.Lock()
+		edge := gc.edges[msg.ConnID]
+		gc.mu.Unlock()
+		if edge != nil && !edge.client.trySend([]byte(msg.Data)) {
+			log.Printf("[Cluster] Socket %s can't keep up, dropping message", msg.ConnID)
+		}
+	case "close":
+		gc.mu.Lock()
+		edge := gc.edges[msg.ConnID]
+		delete(gc.edges, msg.ConnID)
+		gc.mu.Unlock()
+		if edge != nil {
+			close(edge.client.Send)
+		}
+	}
+}
+
+// --- Owner side: players whose socket is on another node ---
+
+// acceptRemote seats a relayed socket in one of our sessions. Only the listener goroutine touches
+// an inbox, so messages that arrive while the join is in flight simply wait in it.
+func (gc *GameCluster) acceptRemote(msg clusterMessage) {
+	target := &relayTarget{NodeID: msg.From, ConnID: msg.ConnID}
+	inbox := make(chan []byte, relayInboxSize)
+
+	gc.mu.Lock()
+	gc.remote[msg.ConnID] = inbox
+	gc.mu.Unlock()
+
+	go func() {
+		var client *Client
+		reason := "Game session not found"
+		if session, ok := gc.manager.GetSession(msg.SessionID); ok && msg.Join != nil {
+			client, reason = session.join(*msg.Join, nil, target)
+		}
+
+		if client == nil {
+			gc.mu.Lock()
+			delete(gc.remote, msg.ConnID)
+			gc.mu.Unlock()
+
+			data, _ := json.Marshal(map[string]string{
+				"action": "join_rejected",
+				"reason": reason,
+			})
+			gc.publish(target.NodeID, clusterMessage{Kind: "deliver", ConnID: target.ConnID, Data: string(data)})
+			gc.publish(target.NodeID, clusterMessage{Kind: "close", ConnID: target.ConnID})
+			return
+		}
+
+		link := client.link
+		go gc.relayWritePump(client, *target, link)
+		gc.relayReadPump(client, inbox, link)
+	}()
+}
+
+// relayWritePump does WritePump's job for a remote socket
+func (gc *GameCluster) relayWritePump(c *Client, target relayTarget, link *clientLink) {
+	for {
+		select {
+		case <-link.done:
+			return
+
+		case message, ok := <-c.Send:
+			if !ok {
+				gc.publish(target.NodeID, clusterMessage{Kind: "close", ConnID: target.ConnID})
+				return
+			}
+			gc.publish(target.NodeID, clusterMessage{Kind: "deliver", ConnID: target.ConnID, Data: string(message)})
+		}
+	}
+}
+
+// relayReadPump does ReadPump's job for a remote socket
+func (gc *GameCluster) relayReadPump(c *Client, inbox <-chan []byte, link *clientLink) {
+	defer func() {
+		link.close()
+		toRun(c.Session, c.Session.Unregister, c)
+	}()
+
+	for {
+		select {
+		case <-link.done:
+			return
+
+		case message, ok := <-inbox:
+			if !ok {
+				return
+			}
+			c.handleMessage(message)
+		}
+	}
+}
+
+// --- Edge side: sockets on this node for sessions owned elsewhere ---
+
+// relay forwards conn to the node that owns info's session
+func (gc *GameCluster) relay(info *SessionInfo, req JoinRequest, conn *websocket.Conn) {
+	connID := uuid.New().String()
+	edge := &edgeConn{
+		client: &Client{
+			Conn:     conn,
+			Send:     make(chan []byte, 256),
+			UserID:   req.UserID,
+			Username: req.Username,
+			link:     newClientLink(),
+		},
+		sessionID: info.ID,
+		owner:     info.NodeID,
+	}
+
+	gc.mu.Lock()
+	gc.edges[connID] = edge
+	gc.mu.Unlock()
+
+	log.Printf("[Cluster] Relaying %s to session %s on node %s", req.Username, info.ID, info.NodeID)
+	gc.publish(edge.owner, clusterMessage{Kind: "join", ConnID: connID, SessionID: info.ID, Join: &req})
+
+	go edge.client.WritePump()
+	go gc.edgeReadPump(edge, connID)
+}
+
+func (gc *GameCluster) edgeReadPump(edge *edgeConn, connID string) {
+	conn := edge.client.Conn
+
+	defer func() {
+		edge.client.link.close()
+		gc.mu.Lock()
+		delete(gc.edges, connID)
+		gc.mu.Unlock()
+		gc.publish(edge.owner, clusterMessage{Kind: "leave", ConnID: connID})
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		gc.publish(edge.owner, clusterMessage{Kind: "message", ConnID: connID, Data: string(message)})
+	}
+}
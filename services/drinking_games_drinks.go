@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// The most drinks a player can mark as taken in one go
+const maxDrinksPerAction = 10
+
+// DrinkTally is one player's drinks in the current game
+type DrinkTally struct {
+	Owed  int `json:"owed"` // the game told them to drink and they haven't said they did yet
+	Taken int `json:"taken"`
+}
+
+// drinkLedger counts drinks per player. Engines keep one under their own mu and start a new one each game.
+type drinkLedger map[string]*DrinkTally
+
+func (l drinkLedger) get(userID string) *DrinkTally {
+	if l[userID] == nil {
+		l[userID] = &DrinkTally{}
+	}
+	return l[userID]
+}
+
+// owe adds n drinks the game handed userID
+func (l drinkLedger) owe(userID string, n int) {
+	l.get(userID).Owed += n
+}
+
+// take records that userID drank n, paying off what they owe first
+func (l drinkLedger) take(userID string, n int) {
+	t := l.get(userID)
+	t.Taken += n
+	t.Owed = max(t.Owed-n, 0)
+}
+
+// tally copies the ledger for a game state, which is marshalled after the engine lets go of its lock
+func (l drinkLedger) tally() map[string]DrinkTally {
+	if len(l) == 0 {
+		return nil
+	}
+	out := make(map[string]DrinkTally, len(l))
+	for id, t := range l {
+		out[id] = *t
+	}
+	return out
+}
+
+// DrinkTracker is implemented by engines that count drinks. The session handles "drink", a player saying
+// they drank, and "log_drinks", adding a finished game's drinks to the player's daily log, for them.
+type DrinkTracker interface {
+	// TakeDrinks records that userID drank n and returns everyone's tally
+	TakeDrinks(userID string, n int) (map[string]DrinkTally, error)
+	// FinalTally is userID's drinks in the game that just ended, ok is false while no game has ended
+	FinalTally(userID string) (tally DrinkTally, ok bool)
+}
+
+// DrinkLogger adds the drinks a player had in a game to their daily_drinking entry
+type DrinkLogger interface {
+	LogGameDrinks(ctx context.Context, clerkID string, drinks int, date time.Time) error
+}
+
+// SetDrinkLogger lets players log their drinks from a game. Call before serving.
+func (m *DrinnkingGameManager) SetDrinkLogger(logger DrinkLogger) {
+	m.drinkLog = logger
+}
+
+// TakeDrinks records that the player drank n, one if n is 0, and tells everyone the new tally
+func (s *Session) TakeDrinks(c *Client, n int) error {
+	tracker, ok := s.GameEngine.(DrinkTracker)
+	if !ok {
+		return gameError(ErrCodeNotAllowed, "this game doesn't count drinks")
+	}
+	if n == 0 {
+		n = 1
+	}
+	if n < 1 || n > maxDrinksPerAction {
+		return gameError(ErrCodeBadRequest, "amount must be between 1 and %d", maxDrinksPerAction)
+	}
+
+	tally, err := tracker.TakeDrinks(c.UserID, n)
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"action": "drink_tally",
+		"userId": c.UserID,
+		"tally":  tally,
+	})
+	toRun(s, s.Broadcast, data)
+	return nil
+}
+
+// LogDrinks adds the drinks the player took in the game that just ended to their log for date, the
+// YYYY-MM-DD day on the player's phone, and confirms with a "drinks_logged" frame. Without a date the
+// server's UTC day is used. Each game can be logged once.
+func (s *Session) LogDrinks(c *Client, requestID, date string) error {
+	tracker, ok := s.GameEngine.(DrinkTracker)
+	if !ok {
+		return gameError(ErrCodeNotAllowed, "this game doesn't count drinks")
+	}
+	if s.Manager == nil || s.Manager.drinkLog == nil {
+		return gameError(ErrCodeNotAllowed, "drinks can't be logged right now")
+	}
+
+	tally, over := tracker.FinalTally(c.UserID)
+	if !over {
+		return gameError(ErrCodeWrongPhase, "drinks can be logged once the game is over")
+	}
+	if tally.Taken == 0 {
+		return gameError(ErrCodeBadRequest, "you didn't drink anything this game")
+	}
+
+	day, err := drinkingDay(s.Clock.Now(), date)
+	if err != nil {
+		return err
+	}
+
+	game := s.startedAt.Load()
+	s.drinksMu.Lock()
+	if logged, ok := s.drinksLogged[c.UserID]; ok && logged == game {
+		s.drinksMu.Unlock()
+		return gameError(ErrCodeNotAllowed, "you already logged this game's drinks")
+	}
+	s.drinksLogged[c.UserID] = game
+	s.drinksMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Manager.drinkLog.LogGameDrinks(ctx, c.UserID, tally.Taken, day); err != nil {
+		log.Printf("[Session %s] Failed to log drinks for %s: %v", s.ID, c.UserID, err)
+
+		// Let them try again
+		s.drinksMu.Lock()
+		delete(s.drinksLogged, c.UserID)
+		s.drinksMu.Unlock()
+		return gameError(ErrCodeInternal, "couldn't log your drinks, try again")
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"action":    "drinks_logged",
+		"requestId": requestID,
+		"drinks":    tally.Taken,
+		"date":      day.Format("2006-01-02"),
+	})
+	c.trySend(data)
+	return nil
+}
+
+// drinkingDay parses the day a player logs drinks for. Local dates run at most a day either side of the
+// UTC date, anything further out is a wrong date rather than a timezone.
+func drinkingDay(now time.Time, date string) (time.Time, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	if date == "" {
+		return today, nil
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, gameError(ErrCodeBadRequest, "date must be YYYY-MM-DD")
+	}
+	if day.Before(today.AddDate(0, 0, -1)) || day.After(today.AddDate(0, 0, 1)) {
+		return time.Time{}, gameError(ErrCodeBadRequest, "drinks can only be logged for today")
+	}
+	return day, nil
+}
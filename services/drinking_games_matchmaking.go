@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MatchRules decide when matchmaking opens a new game and how many seats it fills
+type MatchRules struct {
+	MinPlayers int // queued players it takes to open a new session
+	MaxPlayers int // seats in sessions matchmaking opens, and the most it fills anyone else's public lobby to
+}
+
+// DefaultMatchRules are the game types players can queue for
+var DefaultMatchRules = map[string]MatchRules{
+	"kings-cup":         {MinPlayers: 2, MaxPlayers: 8},
+	"burn-book":         {MinPlayers: 3, MaxPlayers: 10},
+	"mafia":             {MinPlayers: 5, MaxPlayers: 12},
+	"never-have-i-ever": {MinPlayers: 2, MaxPlayers: 10},
+	"ride-the-bus":      {MinPlayers: 2, MaxPlayers: 8},
+}
+
+var (
+	ErrUnknownGameType = errors.New("unknown game type")
+	ErrMatchReplaced   = errors.New("queued again from another request")
+)
+
+// How long a seat matchmaking handed out is kept for the player to connect
+const matchReservation = 30 * time.Second
+
+// Match is where matchmaking put a player
+type Match struct {
+	SessionID string
+	GameType  string
+	Created   bool // a new session was opened for the queue, the player who waited longest hosts it
+}
+
+type matchTicket struct {
+	userID   string
+	username string
+	match    chan *Match // buffered, gets one match, or nil if the player queued again
+}
+
+// matchmaker queues players per game type. Queues are per instance, sessions on other nodes aren't offered.
+type matchmaker struct {
+	mu       sync.Mutex
+	rules    map[string]MatchRules
+	queues   map[string][]*matchTicket       // GameType -> waiting players, longest waiting first
+	reserved map[string]map[string]time.Time // SessionID -> UserID -> when the seat is let go
+}
+
+func newMatchmaker(rules map[string]MatchRules) *matchmaker {
+	return &matchmaker{
+		rules:    rules,
+		queues:   make(map[string][]*matchTicket),
+		reserved: make(map[string]map[string]time.Time),
+	}
+}
+
+// SetMatchRules replaces the game types players can queue for. Call before serving.
+func (m *DrinnkingGameManager) SetMatchRules(rules map[string]MatchRules) {
+	m.matchmaking.mu.Lock()
+	defer m.matchmaking.mu.Unlock()
+	m.matchmaking.rules = rules
+}
+
+// Matchmake puts the player in an open public game of gameType. If there is none they're queued until
+// enough players are waiting to open one. Returns ctx's error if that doesn't happen before ctx ends.
+func (m *DrinnkingGameManager) Matchmake(ctx context.Context, gameType, userID, username string) (*Match, error) {
+	mm := m.matchmaking
+	mm.mu.Lock()
+
+	rules, ok := mm.rules[gameType]
+	if !ok {
+		mm.mu.Unlock()
+		return nil, ErrUnknownGameType
+	}
+
+	// Queueing twice, say from a second tab, gives the newest request the place
+	for _, t := range mm.queues[gameType] {
+		if t.userID == userID {
+			mm.remove(gameType, t)
+			t.match <- nil
+			break
+		}
+	}
+
+	if s := m.openSession(gameType, rules); s != nil {
+		mm.reserve(s.ID, userID, m.Clock.Now())
+		mm.mu.Unlock()
+		return &Match{SessionID: s.ID, GameType: gameType}, nil
+	}
+
+	ticket := &matchTicket{userID: userID, username: username, match: make(chan *Match, 1)}
+	mm.queues[gameType] = append(mm.queues[gameType], ticket)
+	if len(mm.queues[gameType]) >= rules.MinPlayers {
+		m.openForQueue(gameType, rules)
+	}
+	mm.mu.Unlock()
+
+	select {
+	case match := <-ticket.match:
+		return matchOrReplaced(match)
+	case <-ctx.Done():
+		mm.mu.Lock()
+		waiting := mm.remove(gameType, ticket)
+		mm.mu.Unlock()
+		if !waiting {
+			// Matched just as the request gave up, the seat is theirs
+			return matchOrReplaced(<-ticket.match)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func matchOrReplaced(match *Match) (*Match, error) {
+	if match == nil {
+		return nil, ErrMatchReplaced
+	}
+	return match, nil
+}
+
+// openSession picks the fullest public lobby of gameType that still has a seat. Caller must hold mm.mu.
+func (m *DrinnkingGameManager) openSession(gameType string, rules MatchRules) *Session {
+	var best *Session
+	bestRoom := 0
+	now := m.Clock.Now()
+
+	for _, s := range m.localSessions() {
+		if s.GameType != gameType || !s.Settings.IsPublic || s.Settings.HasPassword {
+			continue
+		}
+		// Players can't be slotted into a game that's already going, or a lobby the host closed
+		if s.startedAt.Load() != 0 || s.isLocked() {
+			continue
+		}
+		room := m.matchmaking.room(s, rules, now)
+		if room > 0 && (best == nil || room < bestRoom) {
+			best, bestRoom = s, room
+		}
+	}
+	return best
+}
+
+// openForQueue opens a session for the players at the front of the queue. Caller must hold mm.mu.
+func (m *DrinnkingGameManager) openForQueue(gameType string, rules MatchRules) {
+	mm := m.matchmaking
+	queue := mm.queues[gameType]
+
+	n := min(len(queue), rules.MaxPlayers)
+	tickets := queue[:n]
+	mm.queues[gameType] = append([]*matchTicket(nil), queue[n:]...)
+
+	host := tickets[0]
+	s := m.CreateSession(context.Background(), uuid.New().String(), gameType, host.userID, host.username, NewSessionSettings(true, "", rules.MaxPlayers))
+	log.Printf("[Matchmaking] Opened %s session %s for %d queued players", gameType, s.ID, n)
+
+	now := m.Clock.Now()
+	for _, t := range tickets {
+		mm.reserve(s.ID, t.userID, now)
+		t.match <- &Match{SessionID: s.ID, GameType: gameType, Created: true}
+	}
+}
+
+// offerSession hands a newly opened public lobby's seats to players already waiting for its game type
+func (m *DrinnkingGameManager) offerSession(s *Session) {
+	mm := m.matchmaking
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	rules, ok := mm.rules[s.GameType]
+	if !ok {
+		return
+	}
+
+	now := m.Clock.Now()
+	for len(mm.queues[s.GameType]) > 0 && mm.room(s, rules, now) > 0 {
+		t := mm.queues[s.GameType][0]
+		mm.queues[s.GameType] = mm.queues[s.GameType][1:]
+		mm.reserve(s.ID, t.userID, now)
+		t.match <- &Match{SessionID: s.ID, GameType: s.GameType}
+	}
+}
+
+// room is how many more players matchmaking can send to s. Seats handed out but not yet taken count as full,
+// and so does the host's, who may not have connected yet. Caller must hold mm.mu.
+func (mm *matchmaker) room(s *Session, rules MatchRules, now time.Time) int {
+	seats := rules.MaxPlayers
+	if s.Settings.MaxPlayers > 0 && s.Settings.MaxPlayers < seats {
+		seats = s.Settings.MaxPlayers
+	}
+
+	hostID, _ := s.host()
+	seated := map[string]bool{hostID: true}
+	for _, client := range s.players() {
+		seated[client.UserID] = true
+	}
+	taken := len(seated)
+
+	for userID, until := range mm.reserved[s.ID] {
+		switch {
+		case now.After(until):
+			delete(mm.reserved[s.ID], userID)
+		case !seated[userID]:
+			taken++
+		}
+	}
+	return seats - taken
+}
+
+// reserve holds a seat in sessionID for userID while they connect. Caller must hold mm.mu.
+func (mm *matchmaker) reserve(sessionID, userID string, now time.Time) {
+	// Sessions whose seats have all been let go are dropped here, so the map doesn't grow with every session
+	for id, seats := range mm.reserved {
+		expired := true
+		for _, until := range seats {
+			if !now.After(until) {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			delete(mm.reserved, id)
+		}
+	}
+
+	if mm.reserved[sessionID] == nil {
+		mm.reserved[sessionID] = make(map[string]time.Time)
+	}
+	mm.reserved[sessionID][userID] = now.Add(matchReservation)
+}
+
+// remove takes t out of the queue and reports whether it was still waiting. Caller must hold mm.mu.
+func (mm *matchmaker) remove(gameType string, t *matchTicket) bool {
+	queue := mm.queues[gameType]
+	for i, waiting := range queue {
+		if waiting == t {
+			mm.queues[gameType] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
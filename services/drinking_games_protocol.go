@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the drinking game WebSocket protocol this server speaks.
+// Clients send it as "v". Frames without one come from clients older than the envelope and are read as version 1.
+const ProtocolVersion = 1
+
+// Envelope is the frame every client message arrives in. Action specific fields sit next to it at the
+// top level, so messages from clients that predate the envelope still parse.
+type Envelope struct {
+	Version   int    `json:"v,omitempty"`
+	RequestID string `json:"requestId,omitempty"` // echoed back on any error frame for this message
+	Action    string `json:"action"`
+	Type      string `json:"type,omitempty"` // the game action, e.g. "draw_card", when Action is "game_action"
+}
+
+// ErrorFrame is sent back to the client whose message was rejected
+type ErrorFrame struct {
+	Action    string `json:"action"` // always "error"
+	Version   int    `json:"v"`
+	RequestID string `json:"requestId,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// Error codes sent in error frames
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeUnknownAction      = "unknown_action"
+	ErrCodeNotAllowed         = "not_allowed"
+	ErrCodeWrongPhase         = "wrong_phase"
+	ErrCodeNotYourTurn        = "not_your_turn"
+	ErrCodeInvalidTarget      = "invalid_target"
+	ErrCodeRateLimited        = "rate_limited"
+	ErrCodeInternal           = "internal_error"
+)
+
+// GameError is a rejected message. Engines return one from HandleMessage and the sender gets it as an error frame.
+type GameError struct {
+	Code    string
+	Message string
+}
+
+func (e *GameError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func gameError(code, format string, args ...interface{}) *GameError {
+	return &GameError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// FieldKind is the JSON type an action field must have
+type FieldKind int
+
+const (
+	FieldString FieldKind = iota
+	FieldInt
+	FieldObject
+)
+
+// ActionSchema describes one action a client can send. Fields not listed are ignored.
+type ActionSchema struct {
+	Fields      map[string]FieldKind
+	Required    []string // must be present and not empty
+	HostOnly    bool
+	PlayersOnly bool // spectators can't send it
+}
+
+// sessionActions are the actions the session handles itself. Anything else is rejected.
+var sessionActions = map[string]ActionSchema{
+	"join_room":     {},
+	"start_game":    {HostOnly: true, PlayersOnly: true},
+	"reset_game":    {HostOnly: true, PlayersOnly: true},
+	"kick_player":   {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"ban_player":    {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"transfer_host": {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"lock_lobby":    {},
+	"unlock_lobby":  {},
+	"game_action":   {Fields: map[string]FieldKind{"type": FieldString}, Required: []string{"type"}, PlayersOnly: true},
+	"chat":          {Fields: map[string]FieldKind{"channel": FieldString, "content": FieldString}, Required: []string{"content"}},
+	"drink":         {Fields: map[string]FieldKind{"amount": FieldInt}, PlayersOnly: true},  // amount defaults to 1
+	"log_drinks":    {Fields: map[string]FieldKind{"date": FieldString}, PlayersOnly: true}, // the player's local YYYY-MM-DD
+}
+
+// decodeEnvelope reads the envelope and keeps the raw fields around for schema checks
+func decodeEnvelope(message []byte) (Envelope, map[string]json.RawMessage, *GameError) {
+	var env Envelope
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(message, &fields); err != nil || fields == nil {
+		return env, nil, gameError(ErrCodeBadRequest, "message must be a JSON object")
+	}
+	if err := json.Unmarshal(message, &env); err != nil {
+		// Salvage the request ID so the client can match the error up
+		json.Unmarshal(fields["requestId"], &env.RequestID)
+		return env, nil, gameError(ErrCodeBadRequest, "malformed envelope: %v", err)
+	}
+
+	if env.Version == 0 {
+		env.Version = 1
+	}
+	if env.Version > ProtocolVersion {
+		return env, nil, gameError(ErrCodeUnsupportedVersion, "protocol version %d is not supported, this server speaks %d", env.Version, ProtocolVersion)
+	}
+	if env.Action == "" {
+		return env, nil, gameError(ErrCodeBadRequest, "action is required")
+	}
+
+	return env, fields, nil
+}
+
+// validate checks a message against the schema and the sender's permissions
+func (a ActionSchema) validate(name string, fields map[string]json.RawMessage, sender *Client) *GameError {
+	if a.HostOnly && !sender.isHost() {
+		return gameError(ErrCodeNotAllowed, "only the host can %s", name)
+	}
+	if a.PlayersOnly && sender.IsSpectator {
+		return gameError(ErrCodeNotAllowed, "spectators can't %s", name)
+	}
+
+	for field, kind := range a.Fields {
+		raw, ok := fields[field]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		switch kind {
+		case FieldString:
+			var v string
+			if json.Unmarshal(raw, &v) != nil {
+				return gameError(ErrCodeBadRequest, "%s must be a string", field)
+			}
+		case FieldInt:
+			var v int
+			if json.Unmarshal(raw, &v) != nil {
+				return gameError(ErrCodeBadRequest, "%s must be a whole number", field)
+			}
+		case FieldObject:
+			var v map[string]json.RawMessage
+			if json.Unmarshal(raw, &v) != nil {
+				return gameError(ErrCodeBadRequest, "%s must be an object", field)
+			}
+		}
+	}
+
+	for _, field := range a.Required {
+		raw, ok := fields[field]
+		if !ok || string(raw) == "null" || string(raw) == `""` {
+			return gameError(ErrCodeBadRequest, "%s is required for %s", field, name)
+		}
+	}
+
+	return nil
+}
+
+// sendError tells the client its message was rejected
+func (c *Client) sendError(requestID string, err error) {
+	var gameErr *GameError
+	if !errors.As(err, &gameErr) {
+		gameErr = &GameError{Code: ErrCodeInternal, Message: err.Error()}
+	}
+
+	frame, _ := json.Marshal(ErrorFrame{
+		Action:    "error",
+		Version:   ProtocolVersion,
+		RequestID: requestID,
+		Code:      gameErr.Code,
+		Message:   gameErr.Message,
+	})
+	c.trySend(frame)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// SessionLimits decide when the reaper closes a session. A zero duration turns that limit off.
+type SessionLimits struct {
+	IdleTimeout   time.Duration // no client has sent anything for this long
+	MaxLifetime   time.Duration // counted from when the session was created
+	Warning       time.Duration // clients are told this long before either limit closes the session
+	SweepInterval time.Duration
+}
+
+// DefaultSessionLimits are what production runs with
+var DefaultSessionLimits = SessionLimits{
+	IdleTimeout:   30 * time.Minute,
+	MaxLifetime:   6 * time.Hour,
+	Warning:       time.Minute,
+	SweepInterval: 30 * time.Second,
+}
+
+// TimedGame is implemented by engines that run timers. StopTimers is called once the session is gone,
+// so nothing fires into a game nobody can see any more.
+type TimedGame interface {
+	StopTimers()
+}
+
+// StartReaper closes sessions that outlive limits, checking every SweepInterval. Call before serving.
+func (m *DrinnkingGameManager) StartReaper(limits SessionLimits) {
+	m.limits = limits
+	go func() {
+		ticker := time.NewTicker(limits.SweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.ReapSessions()
+		}
+	}()
+}
+
+// SetSessionLimits sets the limits ReapSessions checks, without starting the background sweep
+func (m *DrinnkingGameManager) SetSessionLimits(limits SessionLimits) {
+	m.limits = limits
+}
+
+// ReapSessions does one sweep over the sessions on this instance. A session past a limit is closed,
+// unless its clients haven't been warned yet, in which case they're warned and it closes on a later sweep.
+func (m *DrinnkingGameManager) ReapSessions() {
+	now := m.Clock.Now()
+
+	for _, s := range m.localSessions() {
+		idleLeft := time.Duration(1<<63 - 1)
+		if m.limits.IdleTimeout > 0 {
+			idleLeft = m.limits.IdleTimeout - now.Sub(time.Unix(0, s.lastActivity.Load()))
+		}
+		lifeLeft := time.Duration(1<<63 - 1)
+		if m.limits.MaxLifetime > 0 {
+			lifeLeft = m.limits.MaxLifetime - now.Sub(s.createdAt)
+		}
+
+		switch {
+		case lifeLeft <= 0 && (s.lifetimeWarned.Load() || m.limits.Warning == 0):
+			s.Close("This game hit its time limit")
+		case idleLeft <= 0 && (s.idleWarned.Load() || m.limits.Warning == 0):
+			s.Close("This game was idle for too long")
+		case lifeLeft <= m.limits.Warning && !s.lifetimeWarned.Swap(true):
+			s.warnClosing("This game is about to hit its time limit", lifeLeft)
+		case idleLeft <= m.limits.Warning && !s.idleWarned.Swap(true):
+			s.warnClosing("This game is about to close because nobody is playing", idleLeft)
+		}
+	}
+}
+
+// Close ends the session: clients are told why and disconnected, and the session is removed from the manager
+func (s *Session) Close(reason string) {
+	toRun(s, s.shutdown, reason)
+}
+
+// closeAll tells every client the session is over and drops them. Must be called inside Run().
+func (s *Session) closeAll(reason string) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"action": "session_closed",
+		"reason": reason,
+	})
+
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	for client := range s.Clients {
+		if client.graceTimer != nil {
+			client.graceTimer.Stop()
+		}
+		client.trySend(data)
+		client.closeSend()
+		delete(s.Clients, client)
+	}
+	log.Printf("[Session %s] Closed: %s", s.ID, reason)
+}
+
+func (s *Session) warnClosing(reason string, left time.Duration) {
+	if left < 0 {
+		left = 0
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"action":      "session_closing",
+		"reason":      reason,
+		"secondsLeft": int(left.Seconds()),
+	})
+	for _, client := range s.clientList() {
+		client.trySend(data)
+	}
+}
+
+// touch marks the session as in use, pushing back the idle timeout
+func (s *Session) touch() {
+	s.lastActivity.Store(s.Clock.Now().UnixNano())
+	s.idleWarned.Store(false)
+}
+
+// stopEngine stops the engine's timers after Run has exited
+func (s *Session) stopEngine() {
+	if timed, ok := s.GameEngine.(TimedGame); ok {
+		timed.StopTimers()
+	}
+}
+
+// toRun hands v to Run, or drops it if the session has already ended
+func toRun[T any](s *Session, ch chan T, v T) {
+	select {
+	case ch <- v:
+	case <-s.quit:
+	}
+}
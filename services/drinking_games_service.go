@@ -6,12 +6,22 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"log"
+	mathrand "math/rand"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -26,27 +36,134 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// How long a dropped player keeps their seat before being removed from the session.
+	reconnectGracePeriod = 2 * time.Minute
+
+	// Join codes skip 0/O and 1/I so they can be read out loud across a bar
+	joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	joinCodeLength   = 6
+
+	// How many codes to try before giving up on registering a session with the cluster
+	maxJoinCodeAttempts = 5
 )
 
+// SessionSettings are picked by the host when creating the game
+type SessionSettings struct {
+	IsPublic     bool   `json:"isPublic"`
+	MaxPlayers   int    `json:"maxPlayers"` // 0 means no limit, spectators don't count
+	HasPassword  bool   `json:"hasPassword"`
+	passwordHash []byte
+}
+
+func NewSessionSettings(isPublic bool, password string, maxPlayers int) SessionSettings {
+	settings := SessionSettings{
+		IsPublic:   isPublic,
+		MaxPlayers: maxPlayers,
+	}
+	if password != "" {
+		hash := sha256.Sum256([]byte(password))
+		settings.passwordHash = hash[:]
+		settings.HasPassword = true
+	}
+	return settings
+}
+
+// CheckPassword reports whether password opens the session. Sessions without a password accept anything.
+func (s SessionSettings) CheckPassword(password string) bool {
+	if !s.HasPassword {
+		return true
+	}
+	hash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash[:], s.passwordHash) == 1
+}
+
 // --- 2. The Game Logic Interface (Strategy Pattern) ---
 type GameLogic interface {
-	HandleMessage(session *Session, sender *Client, message []byte)
+	// HandleMessage applies a game_action that already passed its schema. A returned error goes back to the sender as an error frame.
+	HandleMessage(session *Session, sender *Client, message []byte) error
+	// Actions lists the game actions the engine accepts, keyed by "type"
+	Actions() map[string]ActionSchema
 	InitState(session *Session) interface{}
 	ResetState(session *Session)
+	// SyncState sends the current game state to a single client, e.g. after they reconnect.
+	SyncState(session *Session, client *Client)
+	// PlayersChanged is called whenever a player joins or leaves the session for good (kick, ban, timeout).
+	PlayersChanged(session *Session)
+}
+
+// DisconnectWatcher is implemented by engines that can't wait out the reconnect grace period,
+// e.g. because the game is stuck until the player who dropped takes their turn
+type DisconnectWatcher interface {
+	PlayerDisconnected(session *Session, client *Client)
 }
 
 type Session struct {
 	ID          string
+	JoinCode    string
+	Settings    SessionSettings
 	HostID      string
 	HostUsername string
 	GameType    string
 	GameEngine  GameLogic
 	Manager     *DrinnkingGameManager
 	Clients     map[*Client]bool
+	clientsMu   sync.RWMutex // Run() is the only writer of Clients, their Connected and IsHost flags and Locked, everyone else reads under it
 	Broadcast   chan []byte
 	Register    chan *Client
 	Unregister  chan *Client
 	TriggerList chan bool
+	Reconnect   chan *ReconnectRequest
+	Moderation  chan *ModerationRequest
+	Locked      bool            // no new joiners while the lobby is locked
+	Banned      map[string]bool // UserID -> banned from this session
+	Rand        *mathrand.Rand  // all shuffles and random picks, set a seeded one (NewRand) before Run to replay a game
+	Clock       Clock           // all timers and timestamps, tests swap in a fake one before Run
+
+	expired   chan *Client  // grace period ran out for a disconnected client
+	shutdown  chan string   // Close asks Run to end the session, with the reason for clients
+	quit      chan struct{} // closed when Run exits
+	startedAt atomic.Int64  // UnixNano of the last start_game, for game results
+
+	createdAt      time.Time
+	lastActivity   atomic.Int64 // UnixNano of the last message from any client, for the idle timeout
+	idleWarned     atomic.Bool  // clients were told the session is about to close for being idle
+	lifetimeWarned atomic.Bool
+
+	chatMu      sync.Mutex
+	chatHistory []ChatMessage // the last chatHistoryLimit messages, replayed to late joiners
+	chatSeq     int64
+
+	drinksMu     sync.Mutex
+	drinksLogged map[string]int64 // UserID -> startedAt of the game whose drinks they logged
+}
+
+// ModerationRequest is a host-only action, handled inside Run()
+type ModerationRequest struct {
+	Sender    *Client
+	Action    string // "kick_player", "ban_player", "transfer_host", "lock_lobby", "unlock_lobby"
+	TargetID  string
+	RequestID string // from the envelope, for the error frame if the request is refused
+}
+
+// ReconnectRequest asks the session to hand an existing seat to a new connection.
+// Result receives the resumed client, or nil if the token doesn't match a seat of UserID.
+type ReconnectRequest struct {
+	Token  string
+	UserID string
+	Conn   *websocket.Conn
+	Result chan *Client
+
+	relay *relayTarget // set instead of Conn when the socket lives on another node
+}
+
+// JoinRequest is a verified user asking for a seat in the session
+type JoinRequest struct {
+	UserID      string
+	Username    string
+	Spectator   bool
+	ResumeToken string
+	PasswordOK  bool // the password was checked by whoever authenticated the socket
 }
 
 func NewGameLogic(gameType string) GameLogic {
@@ -57,14 +174,24 @@ func NewGameLogic(gameType string) GameLogic {
 		return &BurnBookLogic{}
 	case "mafia":
 		return &MafiaLogic{}
+	case "never-have-i-ever":
+		return &NeverHaveIEverLogic{}
+	case "ride-the-bus":
+		return &RideTheBusLogic{}
 	default:
 		return &KingsCupLogic{}
 	}
 }
 
-func NewSession(id, gameType, hostID, hostUsername string, manager *DrinnkingGameManager) *Session {
-	return &Session{
+func NewSession(id, gameType, hostID, hostUsername string, settings SessionSettings, manager *DrinnkingGameManager) *Session {
+	var clock Clock = realClock{}
+	if manager != nil && manager.Clock != nil {
+		clock = manager.Clock
+	}
+
+	s := &Session{
 		ID:          id,
+		Settings:    settings,
 		HostID:      hostID,
 		HostUsername: hostUsername,
 		GameType:    gameType,
@@ -75,70 +202,489 @@ func NewSession(id, gameType, hostID, hostUsername string, manager *DrinnkingGam
 		Register:    make(chan *Client),
 		Unregister:  make(chan *Client),
 		TriggerList: make(chan bool),
+		Reconnect:   make(chan *ReconnectRequest),
+		Moderation:  make(chan *ModerationRequest),
+		Banned:      make(map[string]bool),
+		Rand:        NewRand(time.Now().UnixNano()),
+		Clock:       clock,
+		expired:     make(chan *Client),
+		shutdown:    make(chan string),
+		quit:        make(chan struct{}),
+		createdAt:   clock.Now(),
+
+		drinksLogged: make(map[string]int64),
 	}
+	s.lastActivity.Store(s.createdAt.UnixNano())
+	return s
 }
 func (s *Session) sendPlayerListToAll() {
 	type PlayerInfo struct {
-		ID       string `json:"id"`
-		Username string `json:"username"`
-		IsHost   bool   `json:"isHost"`
+		ID        string `json:"id"`
+		Username  string `json:"username"`
+		IsHost    bool   `json:"isHost"`
+		Connected bool   `json:"connected"`
 	}
 
 	players := []PlayerInfo{}
+	spectators := []PlayerInfo{}
 
 	// Safe to read s.Clients here because this function is called inside Run()
 	for client := range s.Clients {
-		if client.Username != "" {
-			players = append(players, PlayerInfo{
-				ID:       client.UserID,
-				Username: client.Username,
-				IsHost:   client.IsHost,
-			})
+		if client.Username == "" {
+			continue
+		}
+		info := PlayerInfo{
+			ID:        client.UserID,
+			Username:  client.Username,
+			IsHost:    client.IsHost,
+			Connected: client.Connected,
+		}
+		if client.IsSpectator {
+			spectators = append(spectators, info)
+		} else {
+			players = append(players, info)
 		}
 	}
 
 	payload := map[string]interface{}{
-		"action":  "update_player_list",
-		"players": players,
+		"action":     "update_player_list",
+		"players":    players,
+		"spectators": spectators,
+		"hostId":     s.HostID,
+		"locked":     s.Locked,
 	}
 
 	data, _ := json.Marshal(payload)
 
 	// Send to everyone directly
 	for client := range s.Clients {
+		s.deliver(client, data)
+	}
+}
+
+// deliver sends a message to one client from inside Run(). Connected clients that can't keep up are dropped,
+// disconnected ones just miss the message and get a fresh state when they resume.
+func (s *Session) deliver(client *Client, message []byte) {
+	if !client.Connected {
+		return
+	}
+	select {
+	case client.Send <- message:
+	default:
+		client.closeSend()
+		s.clientsMu.Lock()
+		delete(s.Clients, client)
+		s.clientsMu.Unlock()
+	}
+}
+
+// disconnect keeps a joined player's seat for reconnectGracePeriod instead of removing them straight away
+func (s *Session) disconnect(client *Client) {
+	s.clientsMu.Lock()
+	client.Connected = false
+	s.clientsMu.Unlock()
+
+	client.graceTimer = s.Clock.AfterFunc(reconnectGracePeriod, func() {
 		select {
-		case client.Send <- data:
-		default:
-			close(client.Send)
-			delete(s.Clients, client)
+		case s.expired <- client:
+		case <-s.quit:
+		}
+	})
+	log.Printf("[Session %s] %s disconnected, holding seat for %s", s.ID, client.Username, reconnectGracePeriod)
+
+	if client.IsHost {
+		s.handOffHost()
+	}
+	if watcher, ok := s.GameEngine.(DisconnectWatcher); ok && !client.IsSpectator {
+		go watcher.PlayerDisconnected(s, client)
+	}
+}
+
+// removeClient drops the client for good and reports whether the session is now empty
+func (s *Session) removeClient(client *Client) bool {
+	if client.graceTimer != nil {
+		client.graceTimer.Stop()
+	}
+	s.clientsMu.Lock()
+	delete(s.Clients, client)
+	empty := len(s.Clients) == 0
+	s.clientsMu.Unlock()
+
+	client.closeSend()
+
+	if client.IsHost && !empty {
+		s.handOffHost()
+	}
+	if !client.IsSpectator {
+		go s.GameEngine.PlayersChanged(s)
+	}
+	return empty
+}
+
+// setHost makes target the host. Must be called inside Run().
+func (s *Session) setHost(target *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	for client := range s.Clients {
+		client.IsHost = false
+	}
+	target.IsHost = true
+	s.HostID = target.UserID
+	s.HostUsername = target.Username
+	log.Printf("[Session %s] %s is now the host", s.ID, target.Username)
+}
+
+// handOffHost passes host to the longest-connected player, if there is one. Must be called inside Run().
+func (s *Session) handOffHost() {
+	var next *Client
+	for client := range s.Clients {
+		if client.IsHost || !client.Connected || client.IsSpectator || client.UserID == "" {
+			continue
+		}
+		if next == nil || client.joinedAt.Before(next.joinedAt) {
+			next = client
+		}
+	}
+	if next != nil {
+		s.setHost(next)
+	}
+}
+
+func (s *Session) findClient(userID string) *Client {
+	for client := range s.Clients {
+		if client.UserID == userID {
+			return client
+		}
+	}
+	return nil
+}
+
+// admit decides whether a freshly registered client may join. Must be called inside Run().
+func (s *Session) admit(client *Client) string {
+	if s.Banned[client.UserID] {
+		return "You were banned from this game"
+	}
+	if s.Locked && client.UserID != s.HostID {
+		return "The lobby is locked"
+	}
+	if !client.IsSpectator && s.Settings.MaxPlayers > 0 {
+		players := 0
+		for c := range s.Clients {
+			if !c.IsSpectator {
+				players++
+			}
+		}
+		if players >= s.Settings.MaxPlayers {
+			return "The game is full"
+		}
+	}
+	return ""
+}
+
+// sendAndRemove delivers a final message to the client and drops it from the session. Must be called inside Run().
+func (s *Session) sendAndRemove(client *Client, action, reason string) bool {
+	data, _ := json.Marshal(map[string]interface{}{
+		"action": action,
+		"reason": reason,
+	})
+	client.trySend(data)
+	return s.removeClient(client)
+}
+
+// moderate runs a host action and reports whether the session ended up empty. Must be called inside Run().
+func (s *Session) moderate(req *ModerationRequest) bool {
+	if !req.Sender.IsHost {
+		log.Printf("[Session %s] %s tried %s without being host", s.ID, req.Sender.Username, req.Action)
+		req.Sender.sendError(req.RequestID, gameError(ErrCodeNotAllowed, "only the host can do that"))
+		return false
+	}
+
+	switch req.Action {
+	case "kick_player", "ban_player":
+		target := s.findClient(req.TargetID)
+		if target == nil || target == req.Sender {
+			req.Sender.sendError(req.RequestID, gameError(ErrCodeInvalidTarget, "that player isn't in the game"))
+			return false
+		}
+		if req.Action == "ban_player" {
+			s.Banned[target.UserID] = true
+			log.Printf("[Session %s] Host banned %s", s.ID, target.Username)
+			return s.sendAndRemove(target, "banned", "You were banned by the host")
+		}
+		log.Printf("[Session %s] Host kicked %s", s.ID, target.Username)
+		return s.sendAndRemove(target, "kicked", "You were kicked by the host")
+
+	case "transfer_host":
+		target := s.findClient(req.TargetID)
+		if target == nil || target == req.Sender || target.IsSpectator {
+			req.Sender.sendError(req.RequestID, gameError(ErrCodeInvalidTarget, "the host has to be another player in the game"))
+			return false
+		}
+		s.setHost(target)
+
+	case "lock_lobby", "unlock_lobby":
+		s.clientsMu.Lock()
+		s.Locked = req.Action == "lock_lobby"
+		s.clientsMu.Unlock()
+	}
+	return false
+}
+
+// isConnected reports whether userID is in the session with a live connection
+func (s *Session) isConnected(userID string) bool {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	for client := range s.Clients {
+		if client.UserID == userID {
+			return client.Connected
+		}
+	}
+	return false
+}
+
+// isHost reads c.IsHost from outside Run(), which sets it when the client is registered and on host changes
+func (c *Client) isHost() bool {
+	c.Session.clientsMu.RLock()
+	defer c.Session.clientsMu.RUnlock()
+	return c.IsHost
+}
+
+// clientList snapshots everyone in the session, players and spectators alike
+func (s *Session) clientList() []*Client {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	clients := make([]*Client, 0, len(s.Clients))
+	for client := range s.Clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// players snapshots the clients taking part in the game, spectators are left out
+func (s *Session) players() []*Client {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	players := make([]*Client, 0, len(s.Clients))
+	for client := range s.Clients {
+		if client.UserID != "" && !client.IsSpectator {
+			players = append(players, client)
+		}
+	}
+	return players
+}
+
+// host returns the current host, which can change through transfers
+func (s *Session) host() (string, string) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.HostID, s.HostUsername
+}
+
+// isLocked reads Locked from outside Run()
+func (s *Session) isLocked() bool {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	return s.Locked
+}
+
+// counts returns how many players and spectators are in the session
+func (s *Session) counts() (players int, spectators int) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	for client := range s.Clients {
+		if client.IsSpectator {
+			spectators++
+		} else {
+			players++
 		}
 	}
+	return players, spectators
+}
+
+// resume hands the seat matching the request's token over to its connection. Must be called inside Run().
+func (s *Session) resume(req *ReconnectRequest) *Client {
+	if req.Token == "" {
+		return nil
+	}
+	for client := range s.Clients {
+		if client.ResumeToken != req.Token || client.UserID != req.UserID {
+			continue
+		}
+
+		if client.graceTimer != nil {
+			client.graceTimer.Stop()
+			client.graceTimer = nil
+		}
+		if client.Connected {
+			// The old connection is probably half-open; ending it makes its pumps exit.
+			client.link.close()
+			if client.Conn != nil {
+				client.Conn.Close()
+			}
+		}
+
+		// Throw away whatever piled up while the client was gone, they get a fresh state below
+		for len(client.Send) > 0 {
+			<-client.Send
+		}
+
+		client.Conn = req.Conn
+		client.relay = req.relay
+		client.link = newClientLink()
+		s.clientsMu.Lock()
+		client.Connected = true
+		s.clientsMu.Unlock()
+
+		data, _ := json.Marshal(map[string]interface{}{
+			"action":      "session_resumed",
+			"sessionId":   s.ID,
+			"userId":      client.UserID,
+			"username":    client.Username,
+			"isHost":      client.IsHost,
+			"resumeToken": client.ResumeToken,
+		})
+		client.Send <- data
+
+		log.Printf("[Session %s] %s reconnected", s.ID, client.Username)
+		return client
+	}
+	return nil
+}
+
+// recordResult saves a finished game in the background. Engines call it once, when their game ends.
+func (s *Session) recordResult(result *drinkinggame.GameResult) {
+	if s.Manager == nil || s.Manager.results == nil {
+		return
+	}
+
+	result.SessionID = s.ID
+	result.GameType = s.GameType
+	result.EndedAt = s.Clock.Now()
+	result.StartedAt = result.EndedAt
+	if started := s.startedAt.Load(); started != 0 {
+		result.StartedAt = time.Unix(0, started)
+	}
+	result.DurationSeconds = int(result.EndedAt.Sub(result.StartedAt).Seconds())
+
+	recorder := s.Manager.results
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := recorder.RecordResult(ctx, result); err != nil {
+			log.Printf("[Session %s] Failed to record game result: %v", s.ID, err)
+		}
+	}()
+}
+
+// Join seats conn in the session, giving back the caller's old seat when the resume token matches.
+// On success the caller starts the client's pumps; otherwise it gets the reason the join was refused.
+func (s *Session) Join(req JoinRequest, conn *websocket.Conn) (*Client, string) {
+	return s.join(req, conn, nil)
+}
+
+func (s *Session) join(req JoinRequest, conn *websocket.Conn, relay *relayTarget) (*Client, string) {
+	// A player coming back from a dropped socket gets their old seat, role and game state back
+	if req.ResumeToken != "" {
+		reconnect := &ReconnectRequest{
+			Token:  req.ResumeToken,
+			UserID: req.UserID,
+			Conn:   conn,
+			Result: make(chan *Client, 1),
+			relay:  relay,
+		}
+		select {
+		case s.Reconnect <- reconnect:
+		case <-s.quit:
+			return nil, "Game has ended"
+		}
+
+		if client := <-reconnect.Result; client != nil {
+			return client, ""
+		}
+		log.Printf("[Session %s] Resume token not recognised, joining as a new client", s.ID)
+	}
+
+	if !req.PasswordOK {
+		return nil, "Wrong game password"
+	}
+
+	client := NewClient(s, conn, req.UserID, req.Username)
+	// Late joiners can watch without taking a seat (and a turn) in the game
+	client.IsSpectator = req.Spectator
+	client.relay = relay
+
+	select {
+	case s.Register <- client:
+	case <-s.quit:
+		return nil, "Game has ended"
+	}
+	return client, ""
 }
 
 func (s *Session) Run() {
 	defer func() {
-		close(s.Broadcast)
-		close(s.Register)
-		close(s.Unregister)
-		close(s.TriggerList)
+		// The other channels stay open, anyone still sending gives up on quit instead of panicking
+		close(s.quit)
+		go s.stopEngine()
 	}()
 	//! when client disconnects againghe should be unregistered
 	for {
 		select {
 		case client := <-s.Register:
+			if reason := s.admit(client); reason != "" {
+				data, _ := json.Marshal(map[string]interface{}{
+					"action": "join_rejected",
+					"reason": reason,
+				})
+				client.trySend(data)
+				client.closeSend()
+				continue
+			}
+
+			client.joinedAt = s.Clock.Now()
+			s.clientsMu.Lock()
+			client.IsHost = client.UserID == s.HostID
 			s.Clients[client] = true
+			s.clientsMu.Unlock()
+			s.touch()
 			log.Printf("[Session %s] User connected. Count: %d", s.ID, len(s.Clients))
 
+			if !client.IsSpectator {
+				go s.GameEngine.PlayersChanged(s)
+			}
+			go s.replayChat(client)
+
+		case req := <-s.Moderation:
+			if s.moderate(req) {
+				log.Printf("[Session %s] Empty, destroying.", s.ID)
+				s.Manager.DeleteSession(s.ID)
+				return
+			}
+			s.sendPlayerListToAll()
+
 		case <-s.TriggerList:
 			s.sendPlayerListToAll()
 
 		case client := <-s.Unregister:
 			if _, ok := s.Clients[client]; ok {
-				delete(s.Clients, client)
-				close(client.Send)
+				if !client.link.closed() {
+					// The client already resumed on a new socket, this is the old one going away
+					continue
+				}
+
+				if client.Username != "" {
+					s.disconnect(client)
+					s.sendPlayerListToAll()
+					continue
+				}
 
 				// If empty, delete session
-				if len(s.Clients) == 0 {
+				if s.removeClient(client) {
 					log.Printf("[Session %s] Empty, destroying.", s.ID)
 					s.Manager.DeleteSession(s.ID)
 					return
@@ -147,32 +693,90 @@ func (s *Session) Run() {
 				s.sendPlayerListToAll()
 			}
 
+		case client := <-s.expired:
+			if _, ok := s.Clients[client]; !ok || client.Connected {
+				continue
+			}
+			log.Printf("[Session %s] %s did not reconnect in time, removing.", s.ID, client.Username)
+			if s.removeClient(client) {
+				log.Printf("[Session %s] Empty, destroying.", s.ID)
+				s.Manager.DeleteSession(s.ID)
+				return
+			}
+			s.sendPlayerListToAll()
+
+		case req := <-s.Reconnect:
+			client := s.resume(req)
+			req.Result <- client
+			if client != nil {
+				s.touch()
+				s.sendPlayerListToAll()
+				go s.GameEngine.SyncState(s, client)
+				go s.replayChat(client)
+			}
+
 		case message := <-s.Broadcast:
 			for client := range s.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(s.Clients, client)
-				}
+				s.deliver(client, message)
 			}
+
+		case reason := <-s.shutdown:
+			s.closeAll(reason)
+			s.Manager.DeleteSession(s.ID)
+			return
 		}
 	}
 }
 
 // The Manager holds all active games
 type DrinnkingGameManager struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
+	sessions    map[string]*Session
+	joinCodes   map[string]string // JoinCode -> SessionID
+	mu          sync.RWMutex
+	cluster     *GameCluster       // nil when this instance runs on its own
+	results     GameResultRecorder // nil means finished games aren't saved
+	chatFilter  *ChatFilter        // nil means chat isn't filtered
+	packs       QuestionPackSource // nil means BurnBook only has the players' own questions
+	limits      SessionLimits      // zero means sessions live until their last client leaves
+	drinkLog    DrinkLogger        // nil means players can't log a game's drinks
+	matchmaking *matchmaker
+
+	Clock Clock // handed to new sessions and used by the reaper, tests swap in a fake one before creating sessions
 }
 
 func NewDrinnkingGameManager() *DrinnkingGameManager {
 	return &DrinnkingGameManager{
-		sessions: make(map[string]*Session),
+		sessions:    make(map[string]*Session),
+		joinCodes:   make(map[string]string),
+		Clock:       realClock{},
+		matchmaking: newMatchmaker(DefaultMatchRules),
 	}
 }
 
-func (m *DrinnkingGameManager) CreateSession(ctx context.Context, sessionID, gameType, clerkId, username string) *Session {
+// EnableCluster shares sessions with the other API instances through Postgres, so players
+// can join a game no matter which instance the load balancer sends them to. Call before serving.
+func (m *DrinnkingGameManager) EnableCluster(db *pgxpool.Pool) {
+	m.cluster = newGameCluster(db, m)
+	go m.cluster.listen()
+	go m.cluster.heartbeat()
+}
+
+// SetResultRecorder makes sessions save finished games and hand out rewards. Call before serving.
+func (m *DrinnkingGameManager) SetResultRecorder(recorder GameResultRecorder) {
+	m.results = recorder
+}
+
+// SetChatFilter sets the word filter for chat in every session. Call it before any session is created.
+func (m *DrinnkingGameManager) SetChatFilter(filter *ChatFilter) {
+	m.chatFilter = filter
+}
+
+// SetQuestionPacks lets BurnBook hosts add curated question packs. Call before serving.
+func (m *DrinnkingGameManager) SetQuestionPacks(source QuestionPackSource) {
+	m.packs = source
+}
+
+func (m *DrinnkingGameManager) CreateSession(ctx context.Context, sessionID, gameType, clerkId, username string, settings SessionSettings) *Session {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -180,12 +784,146 @@ func (m *DrinnkingGameManager) CreateSession(ctx context.Context, sessionID, gam
 		return s
 	}
 
-	s := NewSession(sessionID, gameType, clerkId, username, m)
+	s := NewSession(sessionID, gameType, clerkId, username, settings, m)
+	s.JoinCode = m.newJoinCode()
+	if m.cluster != nil {
+		m.registerSession(s)
+	}
 	m.sessions[sessionID] = s
+	m.joinCodes[s.JoinCode] = sessionID
 	go s.Run()
+
+	if settings.IsPublic && !settings.HasPassword {
+		go m.offerSession(s) // players already queued for this game get the seats
+	}
 	return s
 }
 
+// newJoinCode picks a code no running session is using. Caller must hold m.mu.
+func (m *DrinnkingGameManager) newJoinCode() string {
+	b := make([]byte, joinCodeLength)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("Failed to generate join code: %v", err)
+		}
+		for i := range b {
+			b[i] = joinCodeAlphabet[int(b[i])%len(joinCodeAlphabet)]
+		}
+		code := string(b)
+		if _, taken := m.joinCodes[code]; !taken {
+			return code
+		}
+	}
+}
+
+// registerSession saves s to the cluster before anyone sees its join code. Codes are only unique
+// per node in memory, so when another node already holds the code a new one is picked. Caller must hold m.mu.
+func (m *DrinnkingGameManager) registerSession(s *Session) {
+	for attempt := 1; ; attempt++ {
+		err := m.cluster.saveSession(s)
+		if err == nil {
+			return
+		}
+		if !isUniqueViolation(err) || attempt == maxJoinCodeAttempts {
+			// The heartbeat keeps retrying, the session still works for players on this node
+			log.Printf("[Cluster] Failed to save session %s: %v", s.ID, err)
+			return
+		}
+		s.JoinCode = m.newJoinCode()
+	}
+}
+
+// SessionInfo describes a session that may be running on this instance or another one in the cluster
+type SessionInfo struct {
+	ID           string
+	NodeID       string
+	JoinCode     string
+	GameType     string
+	HostID       string
+	HostUsername string
+	Settings     SessionSettings
+	Players      int
+	Spectators   int
+}
+
+func (s *Session) info(nodeID string) *SessionInfo {
+	players, spectators := s.counts()
+	hostID, hostUsername := s.host()
+	return &SessionInfo{
+		ID:           s.ID,
+		NodeID:       nodeID,
+		JoinCode:     s.JoinCode,
+		GameType:     s.GameType,
+		HostID:       hostID,
+		HostUsername: hostUsername,
+		Settings:     s.Settings,
+		Players:      players,
+		Spectators:   spectators,
+	}
+}
+
+func (i *SessionInfo) publicGame() PublicGameResponse {
+	return PublicGameResponse{
+		SessionID:    i.ID,
+		GameType:     i.GameType,
+		HostID:       i.HostID,
+		HostUsername: i.HostUsername,
+		Players:      i.Players,
+		Spectators:   i.Spectators,
+		MaxPlayers:   i.Settings.MaxPlayers,
+		HasPassword:  i.Settings.HasPassword,
+	}
+}
+
+// ResolveJoinCode finds the session behind a human-readable join code
+func (m *DrinnkingGameManager) ResolveJoinCode(ctx context.Context, code string) (*SessionInfo, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	m.mu.RLock()
+	s, ok := m.sessions[m.joinCodes[code]]
+	m.mu.RUnlock()
+	if ok {
+		return s.info(""), true
+	}
+
+	if m.cluster != nil {
+		return m.cluster.findSession(ctx, "join_code", code)
+	}
+	return nil, false
+}
+
+// FindSession looks for a session on this instance first, then on the rest of the cluster
+func (m *DrinnkingGameManager) FindSession(ctx context.Context, sessionID string) (*SessionInfo, bool) {
+	if s, ok := m.GetSession(sessionID); ok {
+		return s.info(""), true
+	}
+	if m.cluster != nil {
+		return m.cluster.findSession(ctx, "id", sessionID)
+	}
+	return nil, false
+}
+
+// Attach serves an upgraded socket for the session, relaying it to the instance that owns the
+// session when it isn't this one. It returns why the join was refused, or "" once the socket is in.
+func (m *DrinnkingGameManager) Attach(info *SessionInfo, req JoinRequest, conn *websocket.Conn) string {
+	if s, ok := m.GetSession(info.ID); ok {
+		client, reason := s.Join(req, conn)
+		if client == nil {
+			return reason
+		}
+		go client.WritePump()
+		go client.ReadPump()
+		return ""
+	}
+
+	if m.cluster == nil || info.NodeID == "" {
+		return "Game has ended"
+	}
+	// The owner does the seating and answers with join_rejected itself if needed
+	m.cluster.relay(info, req, conn)
+	return ""
+}
+
 func (m *DrinnkingGameManager) GetSession(sessionID string) (*Session, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -193,55 +931,162 @@ func (m *DrinnkingGameManager) GetSession(sessionID string) (*Session, bool) {
 	return s, ok
 }
 
+func (m *DrinnkingGameManager) localSessions() []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	return list
+}
+
 type PublicGameResponse struct {
 	SessionID    string `json:"sessionId"`
 	GameType     string `json:"gameType"`
 	HostID       string `json:"hostId"`
 	HostUsername string `json:"hostUsername"`
 	Players      int    `json:"players"`
+	Spectators   int    `json:"spectators"`
+	MaxPlayers   int    `json:"maxPlayers"`
+	HasPassword  bool   `json:"hasPassword"`
 }
 
-func (m *DrinnkingGameManager) GetPublicSessions() []PublicGameResponse {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// GetPublicSessions lists public games from every instance, or just this one if clustering is off
+func (m *DrinnkingGameManager) GetPublicSessions(ctx context.Context) []PublicGameResponse {
+	if m.cluster != nil {
+		games, err := m.cluster.publicSessions(ctx)
+		if err == nil {
+			return games
+		}
+		log.Printf("[Cluster] Failed to list public sessions, showing local ones only: %v", err)
+	}
 
 	// Initialize as empty slice so it returns [] instead of null in JSON
-	games := make([]PublicGameResponse, 0)
+	games := []PublicGameResponse{}
 
-	for _, s := range m.sessions {
-		// Optional: Check if s.Settings.IsPublic is true
-		// if !s.Settings.IsPublic { continue }
-
-		games = append(games, PublicGameResponse{
-			SessionID: s.ID,
-			GameType:  s.GameType,
-			HostID:    s.HostID,
-			HostUsername: s.HostUsername,
-			Players:   len(s.Clients), // Thread-safe read?
-			// Note: Reading len(s.Clients) here is technically a race condition
-			// if you don't lock the Session itself, but for a simple list it's usually acceptable.
-			// Ideally, Session should have its own RWMutex for its Client map.
-		})
+	for _, s := range m.localSessions() {
+		// Private games are only reachable through their join code
+		if !s.Settings.IsPublic {
+			continue
+		}
+		games = append(games, s.info("").publicGame())
 	}
 
-	log.Println(games)
-
 	return games
 }
 func (m *DrinnkingGameManager) DeleteSession(sessionID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if s, ok := m.sessions[sessionID]; ok {
+		delete(m.joinCodes, s.JoinCode)
+	}
 	delete(m.sessions, sessionID)
+
+	if m.cluster != nil {
+		go m.cluster.removeSession(sessionID)
+	}
 }
 
 // client is like a midlewman between the websocken and the hub
 type Client struct {
-	Session  *Session
-	Conn     *websocket.Conn
-	Send     chan []byte
-	UserID   string
-	Username string
-	IsHost   bool
+	Session     *Session
+	Conn        *websocket.Conn
+	Send        chan []byte
+	UserID      string
+	Username    string
+	IsHost      bool
+	IsSpectator bool   // watches the game without taking a seat in it
+	ResumeToken string // secret handed out on join, lets the client take its seat back after a drop
+	Connected   bool   // false while the seat is held during the reconnect grace period
+
+	link        *clientLink  // the connection currently backing this seat
+	relay       *relayTarget // set when the socket is held by another node in the cluster
+	graceTimer  Timer
+	joinedAt    time.Time
+	chatLimiter *rate.Limiter
+
+	sendMu     sync.RWMutex // Run() closes Send under it, so trySend from other goroutines can't hit a closed channel
+	sendClosed bool
+}
+
+// clientLink is one physical connection behind a Client. A reconnect swaps in a new link,
+// so pumps of the old connection can tell they are stale.
+type clientLink struct {
+	done chan struct{}
+	once sync.Once
+}
+
+func newClientLink() *clientLink {
+	return &clientLink{done: make(chan struct{})}
+}
+
+func (l *clientLink) close() {
+	l.once.Do(func() { close(l.done) })
+}
+
+func (l *clientLink) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewClient creates a client for an authenticated user. Identity comes from the verified
+// Clerk session, never from what the client sends over the socket.
+func NewClient(session *Session, conn *websocket.Conn, userID, username string) *Client {
+	return &Client{
+		Session:     session,
+		Conn:        conn,
+		Send:        make(chan []byte, 256),
+		UserID:      userID,
+		Username:    username,
+		IsHost:      userID == session.HostID,
+		ResumeToken: newResumeToken(),
+		Connected:   true,
+		link:        newClientLink(),
+		chatLimiter: newChatLimiter(),
+	}
+}
+
+func newResumeToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Failed to generate resume token: %v", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// trySend queues a message for the client without blocking the caller if the buffer is full.
+// Clients the session already let go get nothing.
+func (c *Client) trySend(message []byte) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes Send, which ends the write pump. Must be called inside Run().
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.Send)
+	}
 }
 
 type WsPayload struct {
@@ -251,75 +1096,159 @@ type WsPayload struct {
 	UserID   string `json:"userId"`
 	IsHost   bool   `json:"isHost"`
 	Content  string `json:"content"`
+	TargetID string `json:"targetId,omitempty"`
 }
 
 func (c *Client) ReadPump() {
+	// Grab this connection's handles, a reconnect swaps them on the client
+	conn, link := c.Conn, c.link
+
 	defer func() {
-		c.Session.Unregister <- c
-		c.Conn.Close()
+		link.close()
+		toRun(c.Session, c.Session.Unregister, c)
+		conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Println("Error reading msg", err)
 			break
 		}
 
-		var payload WsPayload
-		if err := json.Unmarshal(message, &payload); err == nil {
-			if payload.Action == "join_room" {
-				c.Username = payload.Username
-				c.UserID = payload.UserID
-				c.IsHost = payload.IsHost
-				c.Session.Broadcast <- message
-				c.Session.TriggerList <- true
-				continue
-			}
+		c.handleMessage(message)
+	}
+}
 
-			if payload.Action == "start_game" {
-				c.Session.GameEngine.InitState(c.Session) // this is sing the strategy patters, so that if in the create part it has been seleceted 1 game that same game's init will be executed here
-				// Also broadcast that game started so UI changes to game view
-				c.Session.Broadcast <- message
-				continue
-			}
+// Receive handles a frame from a client with no WebSocket behind it, like a bot playing in-process.
+// Clients with a socket get their frames through ReadPump.
+func (c *Client) Receive(message []byte) {
+	c.handleMessage(message)
+}
 
-			
+// Disconnect drops a client with no WebSocket the way a closed socket would, its seat is held for the grace period
+func (c *Client) Disconnect() {
+	c.link.close()
+	toRun(c.Session, c.Session.Unregister, c)
+}
 
-			if payload.Action == "reset_game" {
-				if c.IsHost {
-					log.Printf("[Session %s] Host resetting game...", c.Session.ID)
+// handleMessage acts on one frame from the client, whether it came from a local socket or was relayed from another node.
+// Messages are checked against their schema first, anything rejected goes back to the sender as an error frame.
+func (c *Client) handleMessage(message []byte) {
+	c.Session.touch()
 
-					c.Session.GameEngine.ResetState(c.Session)
+	env, fields, gameErr := decodeEnvelope(message)
+	if gameErr != nil {
+		c.sendError(env.RequestID, gameErr)
+		return
+	}
 
-					c.Session.Broadcast <- message
+	schema, ok := sessionActions[env.Action]
+	if !ok {
+		c.sendError(env.RequestID, gameError(ErrCodeUnknownAction, "%q is not a supported action", env.Action))
+		return
+	}
+	if gameErr := schema.validate(env.Action, fields, c); gameErr != nil {
+		c.sendError(env.RequestID, gameErr)
+		return
+	}
 
-				}
-				continue
-			}
+	switch env.Action {
+	case "join_room":
+		// Identity was set from the Clerk session on connect, whatever the payload claims is ignored
 
-			// We check if it is a game_action. The Engine will check the "Type" (draw_card).
-			if payload.Action == "game_action" {
-				log.Println("DEBUG: in game_action")
-				c.Session.GameEngine.HandleMessage(c.Session, c, message)
-				continue
-			}
+		joined, _ := json.Marshal(map[string]interface{}{
+			"action":                "session_joined",
+			"v":                     ProtocolVersion,
+			"sessionId":             c.Session.ID,
+			"userId":                c.UserID,
+			"resumeToken":           c.ResumeToken,
+			"reconnectGraceSeconds": int(reconnectGracePeriod.Seconds()),
+		})
+		c.trySend(joined)
+
+		announce, _ := json.Marshal(WsPayload{
+			Action:   "join_room",
+			Username: c.Username,
+			UserID:   c.UserID,
+			IsHost:   c.isHost(),
+		})
+		toRun(c.Session, c.Session.Broadcast, announce)
+		toRun(c.Session, c.Session.TriggerList, true)
+
+	case "start_game":
+		c.Session.startedAt.Store(c.Session.Clock.Now().UnixNano())
+		c.Session.GameEngine.InitState(c.Session) // this is sing the strategy patters, so that if in the create part it has been seleceted 1 game that same game's init will be executed here
+		// Also broadcast that game started so UI changes to game view
+		toRun(c.Session, c.Session.Broadcast, message)
+
+	case "reset_game":
+		log.Printf("[Session %s] Host resetting game...", c.Session.ID)
+		c.Session.startedAt.Store(c.Session.Clock.Now().UnixNano())
+
+		c.Session.GameEngine.ResetState(c.Session)
+
+		toRun(c.Session, c.Session.Broadcast, message)
+
+	case "kick_player", "ban_player", "transfer_host", "lock_lobby", "unlock_lobby":
+		toRun(c.Session, c.Session.Moderation, &ModerationRequest{
+			Sender:    c,
+			Action:    env.Action,
+			TargetID:  unquote(fields["targetId"]),
+			RequestID: env.RequestID,
+		})
+
+	case "chat":
+		if err := c.Session.PostChat(c, unquote(fields["channel"]), unquote(fields["content"])); err != nil {
+			c.sendError(env.RequestID, err)
+		}
+
+	case "drink":
+		var amount int
+		json.Unmarshal(fields["amount"], &amount)
+		if err := c.Session.TakeDrinks(c, amount); err != nil {
+			c.sendError(env.RequestID, err)
+		}
+
+	case "log_drinks":
+		if err := c.Session.LogDrinks(c, env.RequestID, unquote(fields["date"])); err != nil {
+			c.sendError(env.RequestID, err)
+		}
+
+	case "game_action":
+		// The Engine checks the "Type" (draw_card) against its own schema
+		action, ok := c.Session.GameEngine.Actions()[env.Type]
+		if !ok {
+			c.sendError(env.RequestID, gameError(ErrCodeUnknownAction, "%q is not an action in this game", env.Type))
+			return
+		}
+		if gameErr := action.validate(env.Type, fields, c); gameErr != nil {
+			c.sendError(env.RequestID, gameErr)
+			return
+		}
+		if err := c.Session.GameEngine.HandleMessage(c.Session, c, message); err != nil {
+			c.sendError(env.RequestID, err)
 		}
-		// Chat messages
-		c.Session.Broadcast <- message
 	}
 }
 
+// unquote reads a JSON string field, empty if it's missing or not a string
+func unquote(raw json.RawMessage) string {
+	var v string
+	json.Unmarshal(raw, &v)
+	return v
+}
+
 func (s *Session) getPlayersList() []PlayerInfo {
 	players := []PlayerInfo{}
-	for client := range s.Clients {
+	for _, client := range s.players() {
 		if client.Username != "" {
 			players = append(players, PlayerInfo{
 				ID:       client.UserID,
@@ -341,13 +1270,13 @@ func (s *Session) BroadcastPlayerList() {
 	players := []PlayerInfo{}
 
 	// Iterate over clients map
-	for client := range s.Clients {
+	for _, client := range s.players() {
 		// Only add clients who have actually completed the join handshake (have a username)
 		if client.Username != "" {
 			players = append(players, PlayerInfo{
 				ID:       client.UserID,
 				Username: client.Username,
-				IsHost:   client.IsHost,
+				IsHost:   client.isHost(),
 			})
 		}
 	}
@@ -363,28 +1292,34 @@ func (s *Session) BroadcastPlayerList() {
 		return
 	}
 
-	s.Broadcast <- data
+	toRun(s, s.Broadcast, data)
 }
 
 // WritePump handles messages going TO the frontend
 func (c *Client) WritePump() {
+	conn, link := c.Conn, c.link
+
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		conn.Close()
 	}()
 
 	for {
 		select {
+		case <-link.done:
+			// ReadPump for this connection is gone, leave Send for the next connection
+			return
+
 		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The session closed the channel.
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
@@ -396,8 +1331,8 @@ func (c *Client) WritePump() {
 
 		case <-ticker.C:
 			// Heartbeat: keep connection alive
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
@@ -1,11 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
 	"outDrinkMeAPI/utils"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -41,13 +45,26 @@ type KingsCupGameState struct {
 	KingsInCup          int                     `json:"kingsInCup"`                    // To track how many kings have been drawn
 	KingCupDrinker      *PlayerInfo             `json:"kingCupDrinker,omitempty"`      // The player who drew the last king
 	GameStarted         bool                    `json:"gameStarted"`                   // Indicates if the game has officially started
+	TurnSeconds         int                     `json:"turnSeconds,omitempty"`         // 0 while the turn timer is off
+	TimeRemaining       int                     `json:"timeRemaining,omitempty"`       // on the current turn
+	Notice              string                  `json:"notice,omitempty"`              // e.g. who got skipped, only on the update that did it
+	Drinks              map[string]DrinkTally   `json:"drinks,omitempty"`              // PlayerID -> drinks this game
 }
 
+// Kings Cup turn timer limits, in between the host can pick anything. The timer is off by default.
+const (
+	minKingsCupTurnTime = 10 * time.Second
+	maxKingsCupTurnTime = 2 * time.Minute
+
+	// Whoever draws the fourth King drinks the cup, which counts as this many drinks
+	kingsCupDrinks = 3
+)
+
 type KingsCupLogic struct {
 	mu              sync.Mutex
 	Deck            []utils.Card
 	CurrentCard     *utils.Card
-	Timer           *time.Timer             // Unused in this logic, but kept for consistency if you need it later
+	Timer           Timer                   // the turn timer, nil while it's off or nobody has a turn
 	DrawingIndex    int                     // Index in the Players slice indicating whose turn it is
 	Players         []PlayerInfo            // List of all players in the game (managed by Session, but stored here for game logic)
 	Buddies         map[string][]PlayerInfo // Tracks who is buddies with whom (playerID -> []PlayerInfo)
@@ -55,16 +72,21 @@ type KingsCupLogic struct {
 	KingsDrawn      int                     // Tracks how many kings have been drawn
 	LastKingDrinker string                  // Stores the ID of the player who drew the last king
 	GameStarted     bool
+	Stats           map[string]map[string]int // PlayerID -> stat -> count, saved with the game result
+	TurnTime        time.Duration             // set by the host, 0 means turns never time out
+	Drinks          drinkLedger               // what the cards handed out and what players said they drank
+
+	turnDeadline time.Time
+	timerGen     int    // bumped whenever the timer is stopped or replaced, so a stale one does nothing
+	notice       string // goes out with the next broadcast only
 }
 
 func (g *KingsCupLogic) InitState(s *Session) interface{} {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	g.Deck = utils.GenerateNewDeck()
-	rand.Shuffle(len(g.Deck), func(i, j int) {
-		g.Deck[i], g.Deck[j] = g.Deck[j], g.Deck[i]
-	}) // Shuffle the deck! Important for games.
+	g.stopTurnTimer()
+	g.Deck = utils.NewShuffledDeck(s.Rand) // Shuffled with the session's RNG so games can be replayed
 	g.CurrentCard = nil
 	g.DrawingIndex = 0
 	g.Buddies = make(map[string][]PlayerInfo)
@@ -72,18 +94,11 @@ func (g *KingsCupLogic) InitState(s *Session) interface{} {
 	g.KingsDrawn = 0
 	g.LastKingDrinker = ""
 	g.GameStarted = true
+	g.Stats = make(map[string]map[string]int)
+	g.Drinks = make(drinkLedger)
 
 	// IMPORTANT: Populate g.Players from the session's clients
-	g.Players = make([]PlayerInfo, 0, len(s.Clients))
-	for client := range s.Clients {
-		if client.UserID != "" {
-			g.Players = append(g.Players, PlayerInfo{ID: client.UserID, Username: client.Username})
-		}
-	}
-	// Ensure players are in a consistent order, e.g., by ID or username
-	sort.Slice(g.Players, func(i, j int) bool {
-		return g.Players[i].ID < g.Players[j].ID
-	})
+	g.Players = sortedPlayers(s)
 
 	var initialPlayerTurnID *string
 	if len(g.Players) > 0 {
@@ -103,12 +118,30 @@ func (g *KingsCupLogic) InitState(s *Session) interface{} {
 		GameStarted:         true,
 	}
 
+	g.startTurnTimer(s)
+	initialState.TurnSeconds = int(g.TurnTime.Seconds())
+	initialState.TimeRemaining = g.timeRemaining(s)
+
 	// Broadcast the initial game state immediately after initialization
 	// This is crucial for all clients to get the correct starting state, including player list and first turn
 	g.broadcastGameState(s) // Removed 'nil'
 
 	return initialState
 }
+
+// sortedPlayers lists the session's players in a consistent order (by ID) so turn order is stable
+func sortedPlayers(s *Session) []PlayerInfo {
+	clients := s.players()
+	players := make([]PlayerInfo, 0, len(clients))
+	for _, client := range clients {
+		players = append(players, PlayerInfo{ID: client.UserID, Username: client.Username})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].ID < players[j].ID
+	})
+	return players
+}
+
 func (g *KingsCupLogic) GetGameStarted() bool {
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -121,19 +154,16 @@ func (g *KingsCupLogic) GetCurrentCard() *utils.Card {
 	return g.CurrentCard
 }
 
-func (g *KingsCupLogic) UpdatePlayers(currentClients map[*Client]bool) {
+// UpdatePlayers syncs the turn order with the session's players. Spectators never get a turn.
+func (g *KingsCupLogic) UpdatePlayers(s *Session) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	newPlayers := make([]PlayerInfo, 0, len(currentClients))
+	newPlayers := sortedPlayers(s)
 	currentPlayersMap := make(map[string]bool) // To quickly check existing players
 
-	for client := range currentClients {
-		if client.UserID != "" {
-			playerInfo := PlayerInfo{ID: client.UserID, Username: client.Username}
-			newPlayers = append(newPlayers, playerInfo)
-			currentPlayersMap[client.UserID] = true
-		}
+	for _, p := range newPlayers {
+		currentPlayersMap[p.ID] = true
 	}
 
 	for playerID := range g.Buddies {
@@ -156,6 +186,22 @@ func (g *KingsCupLogic) UpdatePlayers(currentClients map[*Client]bool) {
 		}
 	}
 
+	// Keep the turn with whoever was drawing if they are still here
+	drawerLeft := true
+	if current := turnPlayerID(g.Players, g.DrawingIndex); current != nil {
+		for i, p := range newPlayers {
+			if p.ID == *current {
+				g.DrawingIndex = i
+				drawerLeft = false
+				break
+			}
+		}
+	}
+	if drawerLeft {
+		// Whatever they drew left with them
+		g.CurrentCard = nil
+	}
+
 	// If the current player's turn is no longer valid (player left), reset the index.
 	if g.DrawingIndex >= len(newPlayers) && len(newPlayers) > 0 {
 		g.DrawingIndex = 0
@@ -165,55 +211,106 @@ func (g *KingsCupLogic) UpdatePlayers(currentClients map[*Client]bool) {
 
 	g.Players = newPlayers
 	log.Printf("KingsCupLogic Players updated. Current players: %v", g.Players)
-	g.broadcastGameState(nil) // Removed 'nil' (Wait, your broadcastGameState takes session.
+	if drawerLeft {
+		g.startTurnTimer(s)
+	}
+	g.broadcastGameState(s)
+}
+
+func (g *KingsCupLogic) PlayersChanged(s *Session) {
+	if !g.GetGameStarted() {
+		return
+	}
+	g.UpdatePlayers(s)
+}
+
+func toClientCard(card utils.Card, rule string) *ClientCard {
+	return &ClientCard{
+		Suit:     utils.GetSuitName(card.Suit),
+		Value:    card.Rank,
+		Rule:     rule,
+		Color:    utils.GetCardColor(card.Suit),
+		ImageUrl: utils.GetImageUrl(card.Rank, card.Suit),
+	}
+}
+
+// turnPlayerID is the ID of the player at index in the turn order, nil when nobody is playing
+func turnPlayerID(players []PlayerInfo, index int) *string {
+	if index < 0 || index >= len(players) {
+		return nil
+	}
+	return &players[index].ID
+}
+
+func isPlayersTurn(players []PlayerInfo, index int, userID string) bool {
+	id := turnPlayerID(players, index)
+	return id != nil && *id == userID
+}
+
+func nextTurnIndex(index int, players []PlayerInfo) int {
+	if len(players) == 0 {
+		return 0
+	}
+	return (index + 1) % len(players)
 }
 
 func (g *KingsCupLogic) broadcastGameState(session *Session) {
-	var currentPlayerTurnID *string
-	if len(g.Players) > 0 {
-		currentPlayerTurnID = &g.Players[g.DrawingIndex].ID
+	response := GameStatePayload{
+		Action:    "game_update",
+		GameState: g.buildGameState(session),
+	}
+
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshalling game state: %v", err)
+		return
 	}
 
+	// Send to the session's broadcast channel
+	toRun(session, session.Broadcast, bytes)
+}
+
+// SyncState sends the current table to a single (reconnecting) client
+func (g *KingsCupLogic) SyncState(s *Session, client *Client) {
+	g.mu.Lock()
+	state := g.buildGameState(s)
+	g.mu.Unlock()
+
+	bytes, err := json.Marshal(GameStatePayload{Action: "game_update", GameState: state})
+	if err != nil {
+		log.Printf("Error marshalling game state: %v", err)
+		return
+	}
+	client.trySend(bytes)
+}
+
+// buildGameState snapshots the game for the client. Caller must hold g.mu.
+func (g *KingsCupLogic) buildGameState(s *Session) KingsCupGameState {
+	currentPlayerTurnID := turnPlayerID(g.Players, g.DrawingIndex)
+
 	kingCupDrinkerInfo := g.GetPlayerInfoByID(g.LastKingDrinker)
 
 	var clientCard *ClientCard
 	if g.CurrentCard != nil {
-		c := ClientCard{
-			Suit:     utils.GetSuitName(g.CurrentCard.Suit),
-			Value:    g.CurrentCard.Rank,
-			Rule:     g.getRule(g.CurrentCard.Rank),
-			Color:    utils.GetCardColor(g.CurrentCard.Suit),
-			ImageUrl: utils.GetImageUrl(g.CurrentCard.Rank, g.CurrentCard.Suit),
-		}
-		clientCard = &c
+		clientCard = toClientCard(*g.CurrentCard, g.getRule(g.CurrentCard.Rank))
 	}
 
-	state := KingsCupGameState{
+	return KingsCupGameState{
 		Players:             g.Players,
 		CustomRules:         g.CustomRules,
 		Buddies:             g.Buddies,
 		CurrentCard:         clientCard,
 		CardsRemaining:      len(g.Deck),
-		GameOver:            len(g.Deck) == 0,
+		GameOver:            g.GameStarted && len(g.Deck) == 0,
 		CurrentPlayerTurnID: currentPlayerTurnID,
 		KingsInCup:          g.KingsDrawn,
 		KingCupDrinker:      kingCupDrinkerInfo,
 		GameStarted:         g.GameStarted,
+		TurnSeconds:         int(g.TurnTime.Seconds()),
+		TimeRemaining:       g.timeRemaining(s),
+		Notice:              g.notice,
+		Drinks:              g.Drinks.tally(),
 	}
-
-	response := GameStatePayload{
-		Action:    "game_update",
-		GameState: state,
-	}
-
-	bytes, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Error marshalling game state: %v", err)
-		return
-	}
-
-	// Send to the session's broadcast channel
-	session.Broadcast <- bytes
 }
 
 func (g *KingsCupLogic) GetPlayerInfoByID(playerID string) *PlayerInfo {
@@ -261,275 +358,644 @@ func (g *KingsCupLogic) getRule(rank string) string {
 	}
 }
 
-func (g *KingsCupLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
-	var request struct {
-		Type           string  `json:"type"`
-		ChosenBuddieID *string `json:"chosen_buddie_id,omitempty"`
-		NewRule        string  `json:"new_rule,omitempty"`
-	}
+// KingsCupAction is a game_action in Kings Cup
+type KingsCupAction struct {
+	Envelope
+	ChosenBuddieID *string `json:"chosen_buddie_id,omitempty"`
+	NewRule        string  `json:"new_rule,omitempty"`
+	Seconds        int     `json:"seconds,omitempty"` // for set_turn_timer, 0 turns it off
+}
+
+var kingsCupActions = map[string]ActionSchema{
+	"draw_card":      {},
+	"choose_buddy":   {Fields: map[string]FieldKind{"chosen_buddie_id": FieldString}, Required: []string{"chosen_buddie_id"}},
+	"set_rule":       {Fields: map[string]FieldKind{"new_rule": FieldString}, Required: []string{"new_rule"}},
+	"set_turn_timer": {Fields: map[string]FieldKind{"seconds": FieldInt}, HostOnly: true},
+}
+
+func (g *KingsCupLogic) Actions() map[string]ActionSchema {
+	return kingsCupActions
+}
+
+func (g *KingsCupLogic) HandleMessage(s *Session, sender *Client, msg []byte) error {
+	var request KingsCupAction
 
 	if err := json.Unmarshal(msg, &request); err != nil {
-		fmt.Println("JSON Error:", err)
-		return
+		return gameError(ErrCodeBadRequest, "invalid Kings Cup action: %v", err)
 	}
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	// The host can change the timer whoever's turn it is
+	if request.Type == "set_turn_timer" {
+		return g.setTurnTimer(s, sender, request.Seconds)
+	}
+
 	if len(g.Players) == 0 {
 		log.Println("No players in the game logic. Cannot handle messages.")
-		return
+		return gameError(ErrCodeWrongPhase, "the game hasn't started")
 	}
 
-	if g.DrawingIndex >= len(g.Players) || sender.UserID != g.Players[g.DrawingIndex].ID {
-		if len(g.Players) > 0 {
+	if !isPlayersTurn(g.Players, g.DrawingIndex, sender.UserID) {
+		if g.DrawingIndex < len(g.Players) {
 			log.Printf("It's not %s's turn. Current turn is %s (%s) but %s (%s) tried to act.\n",
 				sender.Username, g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID, sender.Username, sender.UserID)
-		} else {
-			log.Printf("It's not %s's turn. No players in game logic.\n", sender.Username)
+			return gameError(ErrCodeNotYourTurn, "it's %s's turn", g.Players[g.DrawingIndex].Username)
 		}
-		return
+		log.Printf("It's not %s's turn. No players in game logic.\n", sender.Username)
+		return gameError(ErrCodeNotYourTurn, "it's not your turn")
 	}
+	player := PlayerInfo{ID: sender.UserID, Username: sender.Username}
 
 	switch request.Type {
 
 	case "draw_card":
-		if len(g.Deck) == 0 {
-			response := GameStatePayload{
-				Action: "game_update",
-				GameState: KingsCupGameState{
-					CurrentCard:    nil,
-					CardsRemaining: 0,
-					GameOver:       true,
-					KingsInCup:     g.KingsDrawn,
-					KingCupDrinker: g.GetPlayerInfoByID(g.LastKingDrinker),
-				},
-			}
-			bytes, _ := json.Marshal(response)
-			s.Broadcast <- bytes
-			return
-		}
-
-		drawn := g.Deck[0]
-		g.Deck = g.Deck[1:]
-		g.CurrentCard = &drawn // This updates the state
-
-		if drawn.Rank == "K" {
-			g.KingsDrawn++
-			if g.KingsDrawn == 4 {
-				g.LastKingDrinker = sender.UserID
-				log.Printf("The 4th King has been drawn! %s must drink the King's Cup!\n", sender.Username)
-			}
-		}
-
-		g.broadcastGameState(s)
-
-		if drawn.Rank == "8" {
-			log.Printf("%s drew an 8. Waiting for buddy selection.\n", sender.Username)
-			return
-		} else if drawn.Rank == "K" {
-			log.Printf("%s drew a King. Waiting for rule setting.\n", sender.Username)
-			return
-		}
-
-		g.DrawingIndex = (g.DrawingIndex + 1) % len(g.Players)
-		log.Printf("Turn advanced to %s (%s)\n", g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID)
-
-		g.broadcastGameState(s)
+		return g.drawCard(s, player)
 
 	case "choose_buddy":
-		if g.CurrentCard == nil || g.CurrentCard.Rank != "8" {
-			log.Printf("Cannot choose a buddy, an 8 was not just drawn by %s, or no card is drawn.\n", sender.Username)
-			return
-		}
 		if request.ChosenBuddieID == nil || *request.ChosenBuddieID == "" {
 			log.Println("No buddy chosen or invalid ID provided.")
-			return
-		}
-
-		chosenBuddyInfo := g.GetPlayerInfoByID(*request.ChosenBuddieID)
-		if chosenBuddyInfo == nil {
-			log.Printf("Chosen buddy with ID %s not found.\n", *request.ChosenBuddieID)
-			return
-		}
-
-		alreadyBuddies := false
-		for _, b := range g.Buddies[sender.UserID] {
-			if b.ID == chosenBuddyInfo.ID {
-				alreadyBuddies = true
-				break
-			}
-		}
-
-		if !alreadyBuddies {
-			g.Buddies[sender.UserID] = append(g.Buddies[sender.UserID], *chosenBuddyInfo)
-			g.Buddies[chosenBuddyInfo.ID] = append(g.Buddies[chosenBuddyInfo.ID], PlayerInfo{ID: sender.UserID, Username: sender.Username})
+			return gameError(ErrCodeBadRequest, "pick a buddy")
 		}
-
-		log.Printf("%s chose %s as a buddy. Buddies: %v\n", sender.Username, chosenBuddyInfo.Username, g.Buddies)
-		g.CurrentCard = nil
-
-		g.DrawingIndex = (g.DrawingIndex + 1) % len(g.Players)
-
-		log.Printf("Turn advanced to %s (%s) after buddy selection.\n", g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID)
-		g.broadcastGameState(s)
+		return g.chooseBuddy(s, player, *request.ChosenBuddieID)
 
 	case "set_rule":
 		if g.CurrentCard == nil || g.CurrentCard.Rank != "K" {
 			log.Printf("Cannot set a rule, a King was not just drawn by %s, or no card is drawn.\n", sender.Username)
-			return
+			return gameError(ErrCodeWrongPhase, "you can only set a rule after drawing a King")
 		}
 		if request.NewRule == "" {
 			log.Println("No new rule provided.")
-			return
+			return gameError(ErrCodeBadRequest, "the rule can't be empty")
 		}
 
 		g.CustomRules[sender.UserID] = append(g.CustomRules[sender.UserID], request.NewRule)
+		addStat(g.Stats, sender.UserID, "rules_set", 1)
 
 		log.Printf("%s set a new rule: \"%s\". Custom Rules: %v\n", sender.Username, request.NewRule, g.CustomRules)
 		g.CurrentCard = nil
 
-		g.DrawingIndex = (g.DrawingIndex + 1) % len(g.Players)
+		g.advanceTurn(s)
 		log.Printf("Turn advanced to %s (%s) after rule setting.\n", g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID)
 		g.broadcastGameState(s)
 
 	default:
 		log.Printf("Unknown game action type: %s from %s\n", request.Type, sender.Username)
+		return gameError(ErrCodeUnknownAction, "%q is not a Kings Cup action", request.Type)
 	}
+	return nil
 }
 
-func (g *KingsCupLogic) ResetState(s *Session) {
-	g.mu.Lock()
-	g.GameStarted = false
-	g.mu.Unlock()
+// drawCard turns over the top card for player, whose turn it is. Caller must hold g.mu.
+func (g *KingsCupLogic) drawCard(s *Session, player PlayerInfo) error {
+	if len(g.Deck) == 0 {
+		response := GameStatePayload{
+			Action: "game_update",
+			GameState: KingsCupGameState{
+				CurrentCard:    nil,
+				CardsRemaining: 0,
+				GameOver:       true,
+				KingsInCup:     g.KingsDrawn,
+				KingCupDrinker: g.GetPlayerInfoByID(g.LastKingDrinker),
+			},
+		}
+		bytes, _ := json.Marshal(response)
+		toRun(s, s.Broadcast, bytes)
+		return nil
+	}
 
-	g.InitState(s)
-}
+	if g.awaitingChoice() {
+		return gameError(ErrCodeWrongPhase, "finish your %s first", g.CurrentCard.Rank)
+	}
 
-type BurnBookLogic struct {
-	mu          sync.Mutex
-	Timer       *time.Timer
-	SkipTimer   chan bool
-	Questions   []string
-	Phase       string
-	Votes       map[int]map[string]int  // [QuestionIndex] -> [CandidateID] -> Count
-	WhoVoted    map[int]map[string]bool // [QuestionIndex] -> [VoterID] -> bool
-	VotingIndex int
-	RevealIndex int
+	drawn := g.Deck[0]
+	g.Deck = g.Deck[1:]
+	g.CurrentCard = &drawn // This updates the state
+	addStat(g.Stats, player.ID, "cards_drawn", 1)
+
+	if drawn.Rank == "K" {
+		addStat(g.Stats, player.ID, "kings_drawn", 1)
+		g.KingsDrawn++
+		if g.KingsDrawn == 4 {
+			g.LastKingDrinker = player.ID
+			g.owe(player.ID, kingsCupDrinks)
+			log.Printf("The 4th King has been drawn! %s must drink the King's Cup!\n", player.Username)
+		}
+	}
+	if drawn.Rank == "3" {
+		g.owe(player.ID, 1)
+	}
+
+	if len(g.Deck) == 0 {
+		s.recordResult(g.buildResult())
+	}
+
+	if drawn.Rank == "8" || drawn.Rank == "K" {
+		// The same player gets a fresh clock to pick a buddy or set a rule
+		log.Printf("%s drew a %s. Waiting for them to finish it.\n", player.Username, drawn.Rank)
+		g.startTurnTimer(s)
+		g.broadcastGameState(s)
+		return nil
+	}
+
+	g.broadcastGameState(s)
+
+	g.advanceTurn(s)
+	log.Printf("Turn advanced to %s (%s)\n", g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID)
+
+	g.broadcastGameState(s)
+	return nil
 }
 
-type RoundResult struct {
-	WinnerID string            `json:"winnerId"` // Helper to identify the top victim easily
-	Results  []PlayerRoundInfo `json:"results"`  // List of all players who got votes
+// chooseBuddy pairs player, who just drew an 8, with buddyID. Caller must hold g.mu.
+func (g *KingsCupLogic) chooseBuddy(s *Session, player PlayerInfo, buddyID string) error {
+	if g.CurrentCard == nil || g.CurrentCard.Rank != "8" {
+		log.Printf("Cannot choose a buddy, an 8 was not just drawn by %s, or no card is drawn.\n", player.Username)
+		return gameError(ErrCodeWrongPhase, "you can only pick a buddy after drawing an 8")
+	}
+
+	chosenBuddyInfo := g.GetPlayerInfoByID(buddyID)
+	if chosenBuddyInfo == nil || chosenBuddyInfo.ID == player.ID {
+		log.Printf("Chosen buddy with ID %s not found.\n", buddyID)
+		return gameError(ErrCodeInvalidTarget, "that player isn't in the game")
+	}
+
+	alreadyBuddies := false
+	for _, b := range g.Buddies[player.ID] {
+		if b.ID == chosenBuddyInfo.ID {
+			alreadyBuddies = true
+			break
+		}
+	}
+
+	if !alreadyBuddies {
+		g.Buddies[player.ID] = append(g.Buddies[player.ID], *chosenBuddyInfo)
+		g.Buddies[chosenBuddyInfo.ID] = append(g.Buddies[chosenBuddyInfo.ID], player)
+	}
+
+	log.Printf("%s chose %s as a buddy. Buddies: %v\n", player.Username, chosenBuddyInfo.Username, g.Buddies)
+	g.CurrentCard = nil
+
+	g.advanceTurn(s)
+
+	log.Printf("Turn advanced to %s (%s) after buddy selection.\n", g.Players[g.DrawingIndex].Username, g.Players[g.DrawingIndex].ID)
+	g.broadcastGameState(s)
+	return nil
 }
 
-type PlayerRoundInfo struct {
-	UserID string `json:"userId"`
-	Votes  int    `json:"votes"`
+// awaitingChoice reports whether the drawer still has to pick a buddy or set a rule. Caller must hold g.mu.
+func (g *KingsCupLogic) awaitingChoice() bool {
+	return g.CurrentCard != nil && (g.CurrentCard.Rank == "8" || g.CurrentCard.Rank == "K")
 }
 
-type BurnBookGameState struct {
-	Players        []PlayerInfo `json:"players,omitempty"`
-	Phase          string       `json:"phase"`
-	QuestionText   string       `json:"questionText,omitempty"`
-	RoundResults   *RoundResult `json:"roundResults,omitempty"`
-	CollectedCount int          `json:"collectedCount,omitempty"`
-	TimeRemaining  int          `json:"timeRemaining,omitempty"`
-	CurrentNumber  int          `json:"currentNumber,omitempty"`
-	TotalQuestions int          `json:"totalQuestions,omitempty"`
-	HasVoted       bool         `json:"hasVoted,omitempty"`
+// advanceTurn passes the turn on, past anyone whose connection has dropped, and restarts the timer.
+// If nobody is connected it just moves to the next seat. Caller must hold g.mu.
+func (g *KingsCupLogic) advanceTurn(s *Session) {
+	next := nextTurnIndex(g.DrawingIndex, g.Players)
+	for i := 0; i < len(g.Players); i++ {
+		candidate := (g.DrawingIndex + 1 + i) % len(g.Players)
+		if s.isConnected(g.Players[candidate].ID) {
+			next = candidate
+			break
+		}
+	}
+	g.DrawingIndex = next
+	g.startTurnTimer(s)
 }
 
-func (g *BurnBookLogic) InitState(s *Session) interface{} {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+func (g *KingsCupLogic) setTurnTimer(s *Session, sender *Client, seconds int) error {
+	if !sender.isHost() {
+		return gameError(ErrCodeNotAllowed, "only the host can set the turn timer")
+	}
 
-	g.Phase = "collecting"
-	g.Questions = make([]string, 0)
-	g.Votes = make(map[int]map[string]int)
-	g.WhoVoted = make(map[int]map[string]bool)
-	g.VotingIndex = 0
-	g.RevealIndex = -1
+	turnTime := time.Duration(seconds) * time.Second
+	if turnTime != 0 && (turnTime < minKingsCupTurnTime || turnTime > maxKingsCupTurnTime) {
+		return gameError(ErrCodeBadRequest, "turns can be %d to %d seconds, or 0 for no timer",
+			int(minKingsCupTurnTime.Seconds()), int(maxKingsCupTurnTime.Seconds()))
+	}
 
-	g.SkipTimer = make(chan bool)
+	g.TurnTime = turnTime
+	// Whoever's turn it is starts over with the new time
+	g.startTurnTimer(s)
+	if g.GameStarted {
+		g.broadcastGameState(s)
+	}
+	return nil
+}
 
-	return BurnBookGameState{
-		Phase:          "collecting",
-		CollectedCount: 0,
+// startTurnTimer (re)starts the clock on the current turn. Caller must hold g.mu.
+func (g *KingsCupLogic) startTurnTimer(s *Session) {
+	g.stopTurnTimer()
+	if g.TurnTime == 0 || !g.GameStarted || len(g.Players) == 0 || (len(g.Deck) == 0 && !g.awaitingChoice()) {
+		return
 	}
+
+	g.timerGen++
+	gen := g.timerGen
+	g.turnDeadline = s.Clock.Now().Add(g.TurnTime)
+	g.Timer = s.Clock.AfterFunc(g.TurnTime, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if gen == g.timerGen {
+			g.turnTimedOut(s)
+		}
+	})
 }
 
-func (g *BurnBookLogic) ResetState(s *Session) {
-	g.mu.Lock()
-	// 1. Stop any active timer
+// stopTurnTimer cancels the turn timer, if one is running. Caller must hold g.mu.
+func (g *KingsCupLogic) stopTurnTimer() {
+	g.timerGen++
 	if g.Timer != nil {
 		g.Timer.Stop()
 		g.Timer = nil
 	}
-
-	// 2. Non-blocking drain of the channel
-	select {
-	case <-g.SkipTimer:
-	default:
-	}
-	g.mu.Unlock()
-
-	// 3. Re-initialize
-	g.InitState(s)
+	g.turnDeadline = time.Time{}
 }
 
-func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
-	var request struct {
-		Type     string `json:"type"`
-		Payload  string `json:"payload"`
-		TargetID string `json:"targetId"`
+// timeRemaining is how many whole seconds the current turn has left, rounded up. Caller must hold g.mu.
+func (g *KingsCupLogic) timeRemaining(s *Session) int {
+	if g.turnDeadline.IsZero() {
+		return 0
+	}
+	left := g.turnDeadline.Sub(s.Clock.Now())
+	if left <= 0 {
+		return 0
 	}
+	return int((left + time.Second - 1) / time.Second)
+}
 
-	if err := json.Unmarshal(msg, &request); err != nil {
-		fmt.Println("JSON Error:", err)
+// turnTimedOut plays the current turn for a player who ran out of time: an 8 gets a random buddy, a King
+// passes without a rule, and otherwise a card is drawn for them, or their turn skipped if they're gone.
+// Caller must hold g.mu.
+func (g *KingsCupLogic) turnTimedOut(s *Session) {
+	g.Timer = nil
+	g.turnDeadline = time.Time{}
+	if len(g.Players) == 0 {
 		return
 	}
+	drawer := g.Players[g.DrawingIndex]
+	defer func() { g.notice = "" }()
 
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	switch {
+	case g.CurrentCard != nil && g.CurrentCard.Rank == "8":
+		g.resolveEight(s, drawer, "%s ran out of time, %s is their buddy")
 
-	log.Println("Received Action:", request.Type)
+	case g.CurrentCard != nil && g.CurrentCard.Rank == "K":
+		g.notice = fmt.Sprintf("%s ran out of time, no new rule this King", drawer.Username)
+		g.CurrentCard = nil
+		g.advanceTurn(s)
+		g.broadcastGameState(s)
 
-	if request.Type == "submit_question" && g.Phase == "collecting" {
-		if request.Payload == "" {
-			return
-		}
-		g.Questions = append(g.Questions, request.Payload)
+	case !s.isConnected(drawer.ID):
+		g.notice = fmt.Sprintf("%s isn't here, skipping their turn", drawer.Username)
+		g.advanceTurn(s)
+		g.broadcastGameState(s)
 
-		broadcast(s, GameStatePayload{
-			Action: "game_update",
-			GameState: BurnBookGameState{
-				Phase:          "collecting",
-				CollectedCount: len(g.Questions),
-			},
-		})
-		return
+	default:
+		g.notice = fmt.Sprintf("%s ran out of time, a card was drawn for them", drawer.Username)
+		g.drawCard(s, drawer)
 	}
+}
 
-	if request.Type == "start_voting" && sender.IsHost && g.Phase == "collecting" {
-		if len(g.Questions) == 0 {
-			return
+// resolveEight gives drawer a random buddy. notice gets the drawer's and the buddy's names. Caller must hold g.mu.
+func (g *KingsCupLogic) resolveEight(s *Session, drawer PlayerInfo, notice string) {
+	candidates := []PlayerInfo{}
+	for _, p := range g.Players {
+		if p.ID != drawer.ID {
+			candidates = append(candidates, p)
 		}
+	}
+	if len(candidates) == 0 {
+		g.CurrentCard = nil
+		g.advanceTurn(s)
+		g.broadcastGameState(s)
+		return
+	}
 
-		g.Phase = "voting"
-		g.VotingIndex = 0
-		g.Votes = make(map[int]map[string]int)
-		g.WhoVoted = make(map[int]map[string]bool)
+	buddy := candidates[s.Rand.Intn(len(candidates))]
+	g.notice = fmt.Sprintf(notice, drawer.Username, buddy.Username)
+	g.chooseBuddy(s, drawer, buddy.ID)
+}
 
-		g.mu.Unlock()
-		g.startQuestionTimer(s) // Start the automatic flow
-		g.mu.Lock()             // Relock for the defer Unlock
+// PlayerDisconnected moves the game on straight away if the player who dropped was the one drawing,
+// rather than leaving everyone waiting out the reconnect grace period
+func (g *KingsCupLogic) PlayerDisconnected(s *Session, client *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.GameStarted || !isPlayersTurn(g.Players, g.DrawingIndex, client.UserID) || s.isConnected(client.UserID) {
 		return
 	}
+	drawer := g.Players[g.DrawingIndex]
+	defer func() { g.notice = "" }()
 
-	if request.Type == "vote_player" && g.Phase == "voting" {
-		if request.TargetID == "" {
-			return
+	if g.CurrentCard != nil && g.CurrentCard.Rank == "8" {
+		g.resolveEight(s, drawer, "%s dropped out, %s is their buddy")
+		return
+	}
+	g.CurrentCard = nil
+	g.notice = fmt.Sprintf("%s dropped out, skipping their turn", drawer.Username)
+	g.advanceTurn(s)
+	g.broadcastGameState(s)
+}
+
+// owe hands playerID n drinks, and their buddies drink with them. Caller must hold g.mu.
+func (g *KingsCupLogic) owe(playerID string, n int) {
+	g.Drinks.owe(playerID, n)
+	for _, buddy := range g.Buddies[playerID] {
+		g.Drinks.owe(buddy.ID, n)
+	}
+}
+
+func (g *KingsCupLogic) TakeDrinks(userID string, n int) (map[string]DrinkTally, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.GameStarted || g.GetPlayerInfoByID(userID) == nil {
+		return nil, gameError(ErrCodeWrongPhase, "you're not in a game")
+	}
+	g.Drinks.take(userID, n)
+	return g.Drinks.tally(), nil
+}
+
+func (g *KingsCupLogic) FinalTally(userID string) (DrinkTally, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.GameStarted || len(g.Deck) > 0 {
+		return DrinkTally{}, false
+	}
+	if t := g.Drinks[userID]; t != nil {
+		return *t, true
+	}
+	return DrinkTally{}, true
+}
+
+// StopTimers ends the turn timer for good once the session is gone
+func (g *KingsCupLogic) StopTimers() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stopTurnTimer()
+}
+
+// buildResult sums up a finished game. Kings Cup has no winner, everyone still at the table gets
+// participation XP and whoever drew the fourth King is marked as the King's Cup drinker.
+func (g *KingsCupLogic) buildResult() *drinkinggame.GameResult {
+	result := &drinkinggame.GameResult{}
+	for _, p := range g.Players {
+		stats := map[string]int{
+			"cards_drawn": g.Stats[p.ID]["cards_drawn"],
+			"kings_drawn": g.Stats[p.ID]["kings_drawn"],
+			"rules_set":   g.Stats[p.ID]["rules_set"],
+			"buddies":     len(g.Buddies[p.ID]),
+		}
+		if p.ID == g.LastKingDrinker {
+			stats["kings_cup"] = 1
+		}
+		result.Participants = append(result.Participants, drinkinggame.Participant{
+			UserID:   p.ID,
+			Username: p.Username,
+			Stats:    stats,
+		})
+	}
+	return result
+}
+
+// addStat bumps a per-player counter that ends up in the game result
+func addStat(stats map[string]map[string]int, playerID, name string, n int) {
+	if stats[playerID] == nil {
+		stats[playerID] = make(map[string]int)
+	}
+	stats[playerID][name] += n
+}
+
+func (g *KingsCupLogic) ResetState(s *Session) {
+	g.mu.Lock()
+	g.GameStarted = false
+	g.mu.Unlock()
+
+	g.InitState(s)
+}
+
+const (
+	// How long players get to vote on each BurnBook question
+	burnBookVoteTime = 30 * time.Second
+
+	// How many questions each pack the host picked adds to a game, drawn at random
+	burnBookQuestionsPerPack = 10
+)
+
+type BurnBookLogic struct {
+	mu            sync.Mutex
+	Timer         Timer
+	SkipTimer     chan bool // one per question, buffered so a skip isn't lost if the timer goroutine isn't waiting yet
+	Questions     []string
+	Packs         []drinkinggame.QuestionPack // picked by the host, they stay picked for the next game
+	PackQuestions map[string][]string         // PackID -> every question in the pack
+	Phase         string
+	Votes         map[int]map[string]int  // [QuestionIndex] -> [CandidateID] -> Count
+	WhoVoted      map[int]map[string]bool // [QuestionIndex] -> [VoterID] -> bool
+	VotingIndex   int
+	RevealIndex   int
+	Drinks        drinkLedger // whoever got burned the most on a question drinks when it's revealed
+}
+
+type RoundResult struct {
+	WinnerID string            `json:"winnerId"` // Helper to identify the top victim easily
+	Results  []PlayerRoundInfo `json:"results"`  // List of all players who got votes
+}
+
+type PlayerRoundInfo struct {
+	UserID string `json:"userId"`
+	Votes  int    `json:"votes"`
+}
+
+type BurnBookGameState struct {
+	Players        []PlayerInfo                `json:"players,omitempty"`
+	Phase          string                      `json:"phase"`
+	QuestionText   string                      `json:"questionText,omitempty"`
+	RoundResults   *RoundResult                `json:"roundResults,omitempty"`
+	CollectedCount int                         `json:"collectedCount,omitempty"`
+	Packs          []drinkinggame.QuestionPack `json:"packs,omitempty"`
+	TimeRemaining  int                         `json:"timeRemaining,omitempty"`
+	CurrentNumber  int                         `json:"currentNumber,omitempty"`
+	TotalQuestions int                         `json:"totalQuestions,omitempty"`
+	HasVoted       bool                        `json:"hasVoted,omitempty"`
+	Drinks         map[string]DrinkTally       `json:"drinks,omitempty"` // PlayerID -> drinks this game, from the reveals on
+}
+
+func (g *BurnBookLogic) InitState(s *Session) interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.Phase = "collecting"
+	g.Questions = make([]string, 0)
+	g.Votes = make(map[int]map[string]int)
+	g.WhoVoted = make(map[int]map[string]bool)
+	g.VotingIndex = 0
+	g.RevealIndex = -1
+	g.Drinks = make(drinkLedger)
+	if g.PackQuestions == nil {
+		g.PackQuestions = make(map[string][]string)
+	}
+
+	g.SkipTimer = make(chan bool, 1)
+
+	return g.collectingState()
+}
+
+func (g *BurnBookLogic) collectingState() BurnBookGameState {
+	return BurnBookGameState{
+		Phase:          "collecting",
+		CollectedCount: len(g.Questions),
+		Packs:          g.Packs,
+	}
+}
+
+func (g *BurnBookLogic) ResetState(s *Session) {
+	g.mu.Lock()
+	// 1. Stop any active timer
+	if g.Timer != nil {
+		g.Timer.Stop()
+		g.Timer = nil
+	}
+
+	// 2. Non-blocking drain of the channel
+	select {
+	case <-g.SkipTimer:
+	default:
+	}
+	g.mu.Unlock()
+
+	// 3. Re-initialize
+	g.InitState(s)
+}
+
+// StopTimers ends the vote timer for good once the session is gone
+func (g *BurnBookLogic) StopTimers() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Timer != nil {
+		g.Timer.Stop()
+		g.Timer = nil
+	}
+	// Wake the timer goroutine so it sees the game is over and exits
+	g.Phase = ""
+	select {
+	case g.SkipTimer <- true:
+	default:
+	}
+}
+
+// BurnBookAction is a game_action in BurnBook
+type BurnBookAction struct {
+	Envelope
+	Payload  string `json:"payload,omitempty"` // the question, for submit_question
+	TargetID string `json:"targetId,omitempty"`
+	PackID   string `json:"packId,omitempty"`
+}
+
+var burnBookActions = map[string]ActionSchema{
+	"submit_question": {Fields: map[string]FieldKind{"payload": FieldString}, Required: []string{"payload"}},
+	"start_voting":    {HostOnly: true},
+	"vote_player":     {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"next_reveal":     {HostOnly: true},
+	"add_pack":        {Fields: map[string]FieldKind{"packId": FieldString}, Required: []string{"packId"}, HostOnly: true},
+	"remove_pack":     {Fields: map[string]FieldKind{"packId": FieldString}, Required: []string{"packId"}, HostOnly: true},
+}
+
+func (g *BurnBookLogic) Actions() map[string]ActionSchema {
+	return burnBookActions
+}
+
+func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) error {
+	var request BurnBookAction
+
+	if err := json.Unmarshal(msg, &request); err != nil {
+		return gameError(ErrCodeBadRequest, "invalid BurnBook action: %v", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	log.Println("Received Action:", request.Type)
+
+	switch request.Type {
+	case "submit_question", "start_voting", "add_pack", "remove_pack":
+		if g.Phase != "collecting" {
+			return gameError(ErrCodeWrongPhase, "questions are closed")
+		}
+	case "vote_player":
+		if g.Phase != "voting" {
+			return gameError(ErrCodeWrongPhase, "there's nothing to vote on right now")
+		}
+	case "next_reveal":
+		if g.Phase != "results" {
+			return gameError(ErrCodeWrongPhase, "there's nothing to reveal yet")
+		}
+	}
+
+	if request.Type == "submit_question" && g.Phase == "collecting" {
+		if request.Payload == "" {
+			return gameError(ErrCodeBadRequest, "the question can't be empty")
+		}
+		g.Questions = append(g.Questions, request.Payload)
+
+		broadcast(s, GameStatePayload{
+			Action:    "game_update",
+			GameState: g.collectingState(),
+		})
+		return nil
+	}
+
+	if request.Type == "add_pack" {
+		return g.addPack(s, sender, request.PackID)
+	}
+
+	if request.Type == "remove_pack" {
+		i := slices.IndexFunc(g.Packs, func(p drinkinggame.QuestionPack) bool { return p.ID == request.PackID })
+		if i < 0 {
+			return gameError(ErrCodeInvalidTarget, "that pack isn't in the game")
+		}
+		g.Packs = slices.Delete(slices.Clone(g.Packs), i, i+1) // the old slice may still be marshalling in a broadcast
+		delete(g.PackQuestions, request.PackID)
+
+		broadcast(s, GameStatePayload{
+			Action:    "game_update",
+			GameState: g.collectingState(),
+		})
+		return nil
+	}
+
+	if request.Type == "start_voting" && sender.isHost() && g.Phase == "collecting" {
+		questions := g.mixQuestions(s)
+		if len(questions) == 0 {
+			return gameError(ErrCodeWrongPhase, "add at least one question or pack first")
+		}
+
+		g.Questions = questions
+		g.Phase = "voting"
+		g.VotingIndex = 0
+		g.Votes = make(map[int]map[string]int)
+		g.WhoVoted = make(map[int]map[string]bool)
+
+		g.mu.Unlock()
+		g.startQuestionTimer(s) // Start the automatic flow
+		g.mu.Lock()             // Relock for the defer Unlock
+		return nil
+	}
+
+	if request.Type == "vote_player" && g.Phase == "voting" {
+		if request.TargetID == "" {
+			return gameError(ErrCodeBadRequest, "pick someone to vote for")
+		}
+		if !isPlayer(s, request.TargetID) {
+			return gameError(ErrCodeInvalidTarget, "that player isn't in the game")
+		}
+		if request.TargetID == sender.UserID {
+			return gameError(ErrCodeInvalidTarget, "you can't vote for yourself")
 		}
 
 		if g.Votes[g.VotingIndex] == nil {
@@ -540,18 +1006,13 @@ func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
 		}
 
 		if g.WhoVoted[g.VotingIndex][sender.UserID] {
-			return
+			return gameError(ErrCodeNotAllowed, "you already voted on this question")
 		}
 
 		g.Votes[g.VotingIndex][request.TargetID]++
 		g.WhoVoted[g.VotingIndex][sender.UserID] = true
 
-		activePlayers := 0
-		for c := range s.Clients {
-			if c.Username != "" {
-				activePlayers++
-			}
-		}
+		activePlayers := len(s.players())
 
 		votesCast := len(g.WhoVoted[g.VotingIndex])
 
@@ -568,10 +1029,10 @@ func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
 			default:
 			}
 		}
-		return
+		return nil
 	}
 
-	if request.Type == "next_reveal" && sender.IsHost && g.Phase == "results" {
+	if request.Type == "next_reveal" && sender.isHost() && g.Phase == "results" {
 		g.RevealIndex++
 
 		if g.RevealIndex >= len(g.Questions) {
@@ -579,13 +1040,17 @@ func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
 			broadcast(s, GameStatePayload{
 				Action: "game_update",
 				GameState: BurnBookGameState{
-					Phase: "game_over",
+					Phase:  "game_over",
+					Drinks: g.Drinks.tally(),
 				},
 			})
-			return
+			return nil
 		}
 
 		roundResults := g.getRoundResults(g.RevealIndex)
+		for _, id := range g.burned(g.RevealIndex) {
+			g.Drinks.owe(id, 1)
+		}
 
 		broadcast(s, GameStatePayload{
 			Action: "game_update",
@@ -594,10 +1059,144 @@ func (g *BurnBookLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
 				QuestionText: g.Questions[g.RevealIndex],
 				RoundResults: roundResults, // Sending the full struct
 				Players:      s.getPlayersList(),
+				Drinks:       g.Drinks.tally(),
 			},
 		})
+		return nil
+	}
+
+	return nil
+}
+
+// PlayersChanged moves voting on if the players still in the game have all voted
+func (g *BurnBookLogic) PlayersChanged(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase != "voting" || g.VotingIndex >= len(g.Questions) {
+		return
+	}
+
+	broadcastVotingState(s, g)
+
+	votesCast := 0
+	for _, p := range s.players() {
+		if g.WhoVoted[g.VotingIndex][p.UserID] {
+			votesCast++
+		}
+	}
+	if votesCast >= len(s.players()) {
+		select {
+		case g.SkipTimer <- true:
+		default:
+		}
+	}
+}
+
+// SyncState sends whatever the client would currently be looking at
+func (g *BurnBookLogic) SyncState(s *Session, client *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var state BurnBookGameState
+
+	switch g.Phase {
+	case "":
 		return
+	case "collecting":
+		state = g.collectingState()
+	case "voting":
+		if g.VotingIndex >= len(g.Questions) {
+			return
+		}
+		state = g.votingState(s, client)
+	case "results":
+		if g.RevealIndex < 0 || g.RevealIndex >= len(g.Questions) {
+			state = BurnBookGameState{Phase: "results_wait"}
+			break
+		}
+		state = BurnBookGameState{
+			Phase:        "results",
+			QuestionText: g.Questions[g.RevealIndex],
+			RoundResults: g.getRoundResults(g.RevealIndex),
+			Players:      s.getPlayersList(),
+			Drinks:       g.Drinks.tally(),
+		}
+	default:
+		state = BurnBookGameState{Phase: g.Phase, Drinks: g.Drinks.tally()}
+	}
+
+	bytes, _ := json.Marshal(GameStatePayload{Action: "game_update", GameState: state})
+	client.trySend(bytes)
+}
+
+// addPack loads a pack into the game. Called with g.mu held, which is let go while the pack loads.
+func (g *BurnBookLogic) addPack(s *Session, host *Client, packID string) error {
+	if g.hasPack(packID) {
+		return gameError(ErrCodeBadRequest, "that pack is already in the game")
+	}
+	if s.Manager == nil || s.Manager.packs == nil {
+		return gameError(ErrCodeNotAllowed, "question packs aren't available")
+	}
+	source := s.Manager.packs
+
+	g.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	pack, questions, err := source.LoadPack(ctx, packID, host.UserID)
+	cancel()
+	g.mu.Lock()
+
+	switch {
+	case errors.Is(err, ErrPackNotFound):
+		return gameError(ErrCodeInvalidTarget, "there's no such pack")
+	case errors.Is(err, ErrPackPremiumOnly):
+		return gameError(ErrCodeNotAllowed, "that pack is for premium members")
+	case err != nil:
+		log.Printf("[Session %s] Failed to load question pack %s: %v", s.ID, packID, err)
+		return gameError(ErrCodeInternal, "couldn't load the pack, try again")
+	}
+
+	// The game may have moved on, or the host double tapped, while the pack was loading
+	if g.Phase != "collecting" {
+		return gameError(ErrCodeWrongPhase, "questions are closed")
+	}
+	if g.hasPack(pack.ID) {
+		return nil
+	}
+
+	g.Packs = append(slices.Clone(g.Packs), *pack)
+	g.PackQuestions[pack.ID] = questions
+
+	broadcast(s, GameStatePayload{
+		Action:    "game_update",
+		GameState: g.collectingState(),
+	})
+	return nil
+}
+
+func (g *BurnBookLogic) hasPack(packID string) bool {
+	return slices.ContainsFunc(g.Packs, func(p drinkinggame.QuestionPack) bool { return p.ID == packID })
+}
+
+// mixQuestions deals burnBookQuestionsPerPack random questions from each pack in with the ones
+// the players wrote, and shuffles the lot so nobody can tell which is which
+func (g *BurnBookLogic) mixQuestions(s *Session) []string {
+	questions := slices.Clone(g.Questions)
+	if len(g.Packs) == 0 {
+		return questions
+	}
+
+	for _, pack := range g.Packs {
+		picks := slices.Clone(g.PackQuestions[pack.ID])
+		s.Rand.Shuffle(len(picks), func(i, j int) { picks[i], picks[j] = picks[j], picks[i] })
+		if len(picks) > burnBookQuestionsPerPack {
+			picks = picks[:burnBookQuestionsPerPack]
+		}
+		questions = append(questions, picks...)
 	}
+
+	s.Rand.Shuffle(len(questions), func(i, j int) { questions[i], questions[j] = questions[j], questions[i] })
+	return questions
 }
 
 func (g *BurnBookLogic) getRoundResults(idx int) *RoundResult {
@@ -634,45 +1233,79 @@ func (g *BurnBookLogic) getRoundResults(idx int) *RoundResult {
 	}
 }
 
-func (g *BurnBookLogic) startQuestionTimer(s *Session) {
-	g.mu.Lock()
-
-	if g.VotingIndex >= len(g.Questions) {
-		g.Phase = "results"
-		g.RevealIndex = -1
-		broadcast(s, GameStatePayload{
-			Action:    "game_update",
-			GameState: BurnBookGameState{Phase: "results_wait"},
-		})
-		g.mu.Unlock()
-		return
+// burned lists whoever got the most votes on question idx, everyone tied for it included. Caller must hold g.mu.
+func (g *BurnBookLogic) burned(idx int) []string {
+	most := 0
+	for _, count := range g.Votes[idx] {
+		most = max(most, count)
+	}
+	var ids []string
+	for id, count := range g.Votes[idx] {
+		if most > 0 && count == most {
+			ids = append(ids, id)
+		}
 	}
+	return ids
+}
 
-	broadcastVotingState(s, g)
-	currentIndex := g.VotingIndex
-	g.mu.Unlock()
+func (g *BurnBookLogic) TakeDrinks(userID string, n int) (map[string]DrinkTally, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.Drinks == nil {
+		return nil, gameError(ErrCodeWrongPhase, "the game hasn't started")
+	}
+	g.Drinks.take(userID, n)
+	return g.Drinks.tally(), nil
+}
 
+func (g *BurnBookLogic) FinalTally(userID string) (DrinkTally, bool) {
 	g.mu.Lock()
-	g.Timer = time.NewTimer(30 * time.Second)
-	g.mu.Unlock()
+	defer g.mu.Unlock()
 
-	go func() {
-		g.mu.Lock()
-		timer := g.Timer
+	if g.Phase != "game_over" {
+		return DrinkTally{}, false
+	}
+	if t := g.Drinks[userID]; t != nil {
+		return *t, true
+	}
+	return DrinkTally{}, true
+}
+
+func (g *BurnBookLogic) startQuestionTimer(s *Session) {
+	g.mu.Lock()
+
+	if g.VotingIndex >= len(g.Questions) {
+		g.Phase = "results"
+		g.RevealIndex = -1
+		broadcast(s, GameStatePayload{
+			Action:    "game_update",
+			GameState: BurnBookGameState{Phase: "results_wait"},
+		})
+		// Votes are final from here on, the reveal is just for show
+		s.recordResult(g.buildResult(s))
 		g.mu.Unlock()
+		return
+	}
 
-		if timer == nil {
-			return
-		} // Guard against nil
+	// Set up the skip channel before anyone can see the question, or an early round of votes skips the wrong one
+	g.Timer = s.Clock.NewTimer(burnBookVoteTime)
+	g.SkipTimer = make(chan bool, 1)
+	timer, skip := g.Timer, g.SkipTimer
+
+	broadcastVotingState(s, g)
+	currentIndex := g.VotingIndex
+	g.mu.Unlock()
 
+	go func() {
 		select {
-		case <-timer.C:
+		case <-timer.C():
 			// Time naturally expired
-		case <-g.SkipTimer:
+		case <-skip:
 			// Force stop
 			if !timer.Stop() {
 				select {
-				case <-timer.C:
+				case <-timer.C():
 				default:
 				}
 			}
@@ -696,33 +1329,87 @@ func (g *BurnBookLogic) startQuestionTimer(s *Session) {
 	}()
 }
 
+// isPlayer reports whether userID has a (non-spectator) seat in the session
+func isPlayer(s *Session, userID string) bool {
+	for _, client := range s.players() {
+		if client.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
 func broadcast(s *Session, payload GameStatePayload) {
 	bytes, _ := json.Marshal(payload)
-	s.Broadcast <- bytes
+	toRun(s, s.Broadcast, bytes)
 }
 
 func broadcastVotingState(s *Session, g *BurnBookLogic) {
-	for client := range s.Clients {
-		hasVoted := false
-		if g.WhoVoted[g.VotingIndex] != nil {
-			hasVoted = g.WhoVoted[g.VotingIndex][client.UserID]
-		}
-
+	for _, client := range s.clientList() {
 		response := GameStatePayload{
-			Action: "game_update",
-			GameState: BurnBookGameState{
-				Phase:          "voting",
-				QuestionText:   g.Questions[g.VotingIndex],
-				CurrentNumber:  g.VotingIndex + 1,
-				TotalQuestions: len(g.Questions),
-				Players:        s.getPlayersList(),
-				HasVoted:       hasVoted,
-				TimeRemaining:  30, // UI can start a countdown
-			},
+			Action:    "game_update",
+			GameState: g.votingState(s, client),
 		}
 		bytes, _ := json.Marshal(response)
-		client.Send <- bytes
+		client.trySend(bytes)
+	}
+}
+
+func (g *BurnBookLogic) votingState(s *Session, client *Client) BurnBookGameState {
+	hasVoted := false
+	if g.WhoVoted[g.VotingIndex] != nil {
+		hasVoted = g.WhoVoted[g.VotingIndex][client.UserID]
+	}
+
+	return BurnBookGameState{
+		Phase:          "voting",
+		QuestionText:   g.Questions[g.VotingIndex],
+		CurrentNumber:  g.VotingIndex + 1,
+		TotalQuestions: len(g.Questions),
+		Players:        s.getPlayersList(),
+		HasVoted:       hasVoted,
+		TimeRemaining:  int(burnBookVoteTime.Seconds()), // UI can start a countdown
+	}
+}
+
+// buildResult sums up the votes. Whoever got burned the most over the whole game wins, ties share it.
+func (g *BurnBookLogic) buildResult(s *Session) *drinkinggame.GameResult {
+	stats := make(map[string]map[string]int)
+	for idx := range g.Questions {
+		for candidateID, count := range g.Votes[idx] {
+			addStat(stats, candidateID, "votes_received", count)
+		}
+		for voterID := range g.WhoVoted[idx] {
+			addStat(stats, voterID, "votes_cast", 1)
+		}
+		if winnerID, votes := g.calculateWinner(idx); votes > 0 {
+			addStat(stats, winnerID, "rounds_won", 1)
+		}
+	}
+
+	players := s.players()
+	mostVotes := 0
+	for _, p := range players {
+		if v := stats[p.UserID]["votes_received"]; v > mostVotes {
+			mostVotes = v
+		}
+	}
+
+	result := &drinkinggame.GameResult{}
+	for _, p := range players {
+		received := stats[p.UserID]["votes_received"]
+		result.Participants = append(result.Participants, drinkinggame.Participant{
+			UserID:   p.UserID,
+			Username: p.Username,
+			Won:      mostVotes > 0 && received == mostVotes,
+			Stats: map[string]int{
+				"votes_received": received,
+				"votes_cast":     stats[p.UserID]["votes_cast"],
+				"rounds_won":     stats[p.UserID]["rounds_won"],
+			},
+		})
 	}
+	return result
 }
 
 func (g *BurnBookLogic) calculateWinner(idx int) (string, int) {
@@ -744,14 +1431,62 @@ func (g *BurnBookLogic) calculateWinner(idx int) (string, int) {
 }
 
 const (
-	ROLE_MAFIA    = "MAFIA"
-	ROLE_DOCTOR   = "DOCTOR"
-	ROLE_POLICE   = "POLICE"
-	ROLE_SPY      = "SPY"
-	ROLE_WHORE    = "WHORE"
-	ROLE_CIVILIAN = "CIVILIAN"
+	ROLE_MAFIA     = "MAFIA"
+	ROLE_DOCTOR    = "DOCTOR"
+	ROLE_POLICE    = "POLICE"
+	ROLE_SPY       = "SPY"
+	ROLE_WHORE     = "WHORE"
+	ROLE_BODYGUARD = "BODYGUARD" // guards someone at night and dies in their place
+	ROLE_MAYOR     = "MAYOR"     // day vote counts twice
+	ROLE_JESTER    = "JESTER"    // on nobody's side, wins by getting lynched
+	ROLE_CIVILIAN  = "CIVILIAN"
 )
 
+// mafiaRoleOrder is the order roles are dealt in, so a seeded game deals the same way every time.
+// Civilians fill whatever seats are left.
+var mafiaRoleOrder = []string{ROLE_MAFIA, ROLE_DOCTOR, ROLE_POLICE, ROLE_SPY, ROLE_WHORE, ROLE_BODYGUARD, ROLE_MAYOR, ROLE_JESTER}
+
+// maxRoleCount caps a single role in a host's setup
+const maxRoleCount = 10
+
+// Dying, by night or by the town's vote, is worth this many drinks
+const mafiaDeathDrinks = 2
+
+// Mafia phase timers. When one runs out the phase resolves with whatever actions came in.
+const (
+	defaultMafiaNightTime = 60 * time.Second
+	defaultMafiaDayTime   = 3 * time.Minute
+	minMafiaPhaseTime     = 15 * time.Second
+	maxMafiaPhaseTime     = 10 * time.Minute
+	mafiaTimerExtension   = 30 * time.Second // extend_timer without "seconds"
+)
+
+// defaultMafiaRoles is the set dealt when the host hasn't picked one
+func defaultMafiaRoles(players int) map[string]int {
+	counts := map[string]int{ROLE_MAFIA: 1}
+	if players == 4 {
+		counts[ROLE_DOCTOR] = 1
+	} else if players >= 5 {
+		counts[ROLE_DOCTOR] = 1
+		counts[ROLE_POLICE] = 1
+		counts[ROLE_SPY] = 1
+		counts[ROLE_WHORE] = 1
+	}
+	return counts
+}
+
+func isMafiaTeam(role string) bool {
+	return role == ROLE_MAFIA || role == ROLE_SPY
+}
+
+// voteWeight is how many votes a player's day vote is worth
+func voteWeight(role string) int {
+	if role == ROLE_MAYOR {
+		return 2
+	}
+	return 1
+}
+
 type MafiaGameState struct {
 	AlivePlayers []PlayerInfo `json:"alivePlayers"`
 	DeadPlayers  []PlayerInfo `json:"deadPlayers"`
@@ -759,11 +1494,16 @@ type MafiaGameState struct {
 	// Detailed breakdown of who voted for whom (visible during DAY)
 	Votes map[string]string `json:"votes"`
 
-	Phase         string            `json:"phase"` // "LOBBY", "NIGHT", "DAY", "GAME_OVER"
-	Message       string            `json:"message"`
-	MyRole        string            `json:"myRole,omitempty"`
-	Winner        string            `json:"winner,omitempty"`
-	RevealedRoles map[string]string `json:"revealedRoles,omitempty"`
+	Phase         string                `json:"phase"` // "LOBBY", "NIGHT", "DAY", "GAME_OVER"
+	Message       string                `json:"message"`
+	MyRole        string                `json:"myRole,omitempty"`
+	Winner        string                `json:"winner,omitempty"` // "MAFIA", "CIVILIANS" or "JESTER"
+	RevealedRoles map[string]string     `json:"revealedRoles,omitempty"`
+	RoleCounts    map[string]int        `json:"roleCounts,omitempty"`    // the host's role setup, shown in the lobby
+	TimeRemaining int                   `json:"timeRemaining,omitempty"` // seconds until NIGHT or DAY resolves on its own
+	NightSeconds  int                   `json:"nightSeconds,omitempty"`  // the phase timers, shown in the lobby
+	DaySeconds    int                   `json:"daySeconds,omitempty"`
+	Drinks        map[string]DrinkTally `json:"drinks,omitempty"` // PlayerID -> drinks this game
 }
 
 type MafiaLogic struct {
@@ -773,16 +1513,44 @@ type MafiaLogic struct {
 	NightActions map[string]string
 	Votes        map[string]string
 	Phase        string
+	LastMessage  string // last phase message, replayed to reconnecting players
+
+	Usernames     map[string]string // UserID -> username at the start, so players who left still show up in the result
+	VotesReceived map[string]int    // UserID -> day votes against them over the whole game
+
+	RoleCounts    map[string]int // Role -> how many, picked by the host. nil deals defaultMafiaRoles. Kept across resets.
+	LynchedJester string         // set when the town executes the Jester, who wins the game
+
+	NightTime time.Duration // picked by the host, zero means the default. Kept across resets.
+	DayTime   time.Duration
+
+	phaseTimer    Timer
+	phaseDeadline time.Time // zero while no timer runs
+	phaseTimerGen int       // bumped whenever the timer is stopped or replaced, so a stale one does nothing
+
+	Drinks drinkLedger
 }
 
 func (g *MafiaLogic) ResetState(s *Session) {
 	g.InitState(s)
 }
 
+// StopTimers ends the phase timer for good once the session is gone
+func (g *MafiaLogic) StopTimers() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopPhaseTimer()
+	g.Phase = "" // the wait after a lynch checks the phase and gives up
+}
+
 func (g *MafiaLogic) InitState(s *Session) interface{} {
 	g.mu.Lock()
+	g.stopPhaseTimer()
+
+	players := s.players()
 
-	if len(s.Clients) < 3 {
+	if len(players) < 3 {
 		g.Phase = "LOBBY"
 		Message := "Not enough players to start (Min 3)"
 		g.mu.Unlock()
@@ -792,17 +1560,36 @@ func (g *MafiaLogic) InitState(s *Session) interface{} {
 		}
 	}
 
+	counts := g.RoleCounts
+	if counts == nil {
+		counts = defaultMafiaRoles(len(players))
+	}
+	if problem := checkRoleCounts(counts, len(players)); problem != "" {
+		g.Phase = "LOBBY"
+		g.broadcastLobby(s, problem)
+		g.mu.Unlock()
+		return MafiaGameState{
+			Phase:   "LOBBY",
+			Message: problem,
+		}
+	}
+
 	g.Phase = "NIGHT"
+	g.LynchedJester = ""
 	g.Roles = make(map[string]string)
 	g.IsAlive = make(map[string]bool)
 	g.Votes = make(map[string]string)
 	g.NightActions = make(map[string]string)
+	g.Usernames = make(map[string]string)
+	g.VotesReceived = make(map[string]int)
+	g.Drinks = make(drinkLedger)
 
-	for client := range s.Clients {
+	for _, client := range players {
 		g.IsAlive[client.UserID] = true
+		g.Usernames[client.UserID] = client.Username
 	}
 
-	g.assignRoles(s)
+	g.assignRoles(s, players, counts)
 
 	g.mu.Unlock() // Unlock before startNightPhase because it locks internally
 
@@ -814,90 +1601,403 @@ func (g *MafiaLogic) InitState(s *Session) interface{} {
 	}
 }
 
-func (g *MafiaLogic) HandleMessage(s *Session, sender *Client, msg []byte) {
-	var payload struct {
-		Type     string `json:"type"`
-		TargetID string `json:"targetId"`
+// MafiaAction is a game_action in Mafia
+type MafiaAction struct {
+	Envelope
+	TargetID     string         `json:"targetId,omitempty"`     // a player ID, or "SKIP" when voting
+	Roles        map[string]int `json:"roles,omitempty"`        // set_roles: Role -> how many, civilians fill the rest
+	NightSeconds int            `json:"nightSeconds,omitempty"` // set_timers
+	DaySeconds   int            `json:"daySeconds,omitempty"`   // set_timers
+	Seconds      int            `json:"seconds,omitempty"`      // extend_timer
+}
+
+var mafiaActions = map[string]ActionSchema{
+	"night_action": {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"vote":         {Fields: map[string]FieldKind{"targetId": FieldString}, Required: []string{"targetId"}},
+	"set_roles":    {Fields: map[string]FieldKind{"roles": FieldObject}, Required: []string{"roles"}, HostOnly: true},
+	"set_timers":   {Fields: map[string]FieldKind{"nightSeconds": FieldInt, "daySeconds": FieldInt}, HostOnly: true},
+	"extend_timer": {Fields: map[string]FieldKind{"seconds": FieldInt}, HostOnly: true},
+	"skip_timer":   {HostOnly: true},
+}
+
+func (g *MafiaLogic) Actions() map[string]ActionSchema {
+	return mafiaActions
+}
+
+// setRoles stores the host's role setup for the next game. Caller must hold g.mu.
+func (g *MafiaLogic) setRoles(s *Session, roles map[string]int) error {
+	if g.Phase != "" && g.Phase != "LOBBY" && g.Phase != "GAME_OVER" {
+		return gameError(ErrCodeWrongPhase, "roles can only be changed between games")
+	}
+
+	counts := make(map[string]int)
+	for role, n := range roles {
+		if !slices.Contains(mafiaRoleOrder, role) {
+			return gameError(ErrCodeBadRequest, "%q is not a role you can pick, civilians fill the seats that are left", role)
+		}
+		if n < 0 || n > maxRoleCount {
+			return gameError(ErrCodeBadRequest, "%s count must be between 0 and %d", role, maxRoleCount)
+		}
+		if n > 0 {
+			counts[role] = n
+		}
+	}
+	if counts[ROLE_MAFIA] == 0 {
+		return gameError(ErrCodeBadRequest, "the game needs at least one MAFIA")
+	}
+
+	g.RoleCounts = counts
+	g.broadcastLobby(s, "The host changed the roles")
+	return nil
+}
+
+// setTimers stores the host's phase lengths for the next game, zero keeps what's there. Caller must hold g.mu.
+func (g *MafiaLogic) setTimers(s *Session, nightSeconds, daySeconds int) error {
+	if g.Phase != "" && g.Phase != "LOBBY" && g.Phase != "GAME_OVER" {
+		return gameError(ErrCodeWrongPhase, "timers can only be changed between games")
+	}
+
+	night := time.Duration(nightSeconds) * time.Second
+	day := time.Duration(daySeconds) * time.Second
+	for _, d := range []time.Duration{night, day} {
+		if d != 0 && (d < minMafiaPhaseTime || d > maxMafiaPhaseTime) {
+			return gameError(ErrCodeBadRequest, "timers must be between %d and %d seconds", int(minMafiaPhaseTime.Seconds()), int(maxMafiaPhaseTime.Seconds()))
+		}
+	}
+
+	if night != 0 {
+		g.NightTime = night
+	}
+	if day != 0 {
+		g.DayTime = day
+	}
+	g.broadcastLobby(s, "The host changed the timers")
+	return nil
+}
+
+func (g *MafiaLogic) nightTime() time.Duration {
+	if g.NightTime == 0 {
+		return defaultMafiaNightTime
+	}
+	return g.NightTime
+}
+
+func (g *MafiaLogic) dayTime() time.Duration {
+	if g.DayTime == 0 {
+		return defaultMafiaDayTime
+	}
+	return g.DayTime
+}
+
+// startPhaseTimer resolves the current phase after d. Caller must hold g.mu.
+func (g *MafiaLogic) startPhaseTimer(s *Session, d time.Duration) {
+	g.stopPhaseTimer()
+	gen := g.phaseTimerGen
+	g.phaseDeadline = s.Clock.Now().Add(d)
+	g.phaseTimer = s.Clock.AfterFunc(d, func() {
+		g.mu.Lock()
+		g.expirePhase(s, gen)
+	})
+}
+
+// stopPhaseTimer cancels the running timer, if any. Caller must hold g.mu.
+func (g *MafiaLogic) stopPhaseTimer() {
+	g.phaseTimerGen++
+	g.phaseDeadline = time.Time{}
+	if g.phaseTimer != nil {
+		g.phaseTimer.Stop()
+		g.phaseTimer = nil
+	}
+}
+
+// expirePhase resolves NIGHT or DAY with the actions that came in. Called with g.mu held and releases it,
+// does nothing if gen is from a timer that was stopped since.
+func (g *MafiaLogic) expirePhase(s *Session, gen int) error {
+	if gen != g.phaseTimerGen {
+		g.mu.Unlock()
+		return nil
+	}
+
+	switch g.Phase {
+	case "NIGHT":
+		g.mu.Unlock()
+		g.resolveNight(s)
+	case "DAY":
+		g.mu.Unlock()
+		g.resolveDay(s)
+	default:
+		g.mu.Unlock()
+		return gameError(ErrCodeWrongPhase, "there's no timer running")
+	}
+	return nil
+}
+
+// extendTimer gives the current phase more time. Caller must hold g.mu.
+func (g *MafiaLogic) extendTimer(s *Session, seconds int) error {
+	if g.phaseDeadline.IsZero() || (g.Phase != "NIGHT" && g.Phase != "DAY") {
+		return gameError(ErrCodeWrongPhase, "there's no timer running")
+	}
+
+	extra := mafiaTimerExtension
+	if seconds != 0 {
+		extra = time.Duration(seconds) * time.Second
+	}
+	if extra < 0 || extra > maxMafiaPhaseTime {
+		return gameError(ErrCodeBadRequest, "you can add up to %d seconds", int(maxMafiaPhaseTime.Seconds()))
+	}
+
+	g.startPhaseTimer(s, g.phaseDeadline.Sub(s.Clock.Now())+extra)
+	g.broadcastState(s, g.Phase, g.LastMessage)
+	return nil
+}
+
+// timeRemaining rounds up, so the countdown never shows 0 while the phase is still open. Caller must hold g.mu.
+func (g *MafiaLogic) timeRemaining(s *Session) int {
+	if g.phaseDeadline.IsZero() {
+		return 0
+	}
+	left := g.phaseDeadline.Sub(s.Clock.Now())
+	if left <= 0 {
+		return 0
+	}
+	return int((left + time.Second - 1) / time.Second)
+}
+
+// checkRoleCounts explains why a role setup can't be dealt to this many players, empty if it can
+func checkRoleCounts(counts map[string]int, players int) string {
+	special, mafiaTeam := 0, 0
+	for role, n := range counts {
+		special += n
+		if isMafiaTeam(role) {
+			mafiaTeam += n
+		}
+	}
+	if special > players {
+		return fmt.Sprintf("These roles need at least %d players", special)
+	}
+	if mafiaTeam*2 >= players {
+		return fmt.Sprintf("Too many on the mafia's side for %d players", players)
+	}
+	return ""
+}
+
+// broadcastLobby shows the role setup between games. Caller must hold g.mu.
+func (g *MafiaLogic) broadcastLobby(s *Session, msg string) {
+	counts := g.RoleCounts
+	if counts == nil {
+		counts = defaultMafiaRoles(len(s.players()))
+	}
+	g.LastMessage = msg
+	broadcast(s, GameStatePayload{
+		Action: "game_update",
+		GameState: MafiaGameState{
+			Phase:        g.lobbyPhase(),
+			Message:      msg,
+			RoleCounts:   counts,
+			NightSeconds: int(g.nightTime().Seconds()),
+			DaySeconds:   int(g.dayTime().Seconds()),
+		},
+	})
+}
+
+func (g *MafiaLogic) lobbyPhase() string {
+	if g.Phase == "" {
+		return "LOBBY"
+	}
+	return g.Phase
+}
+
+// inPlay reports whether userID was dealt into a game that's still going. Caller must hold g.mu.
+func (g *MafiaLogic) inPlay(userID string) bool {
+	if g.Phase != "NIGHT" && g.Phase != "DAY" && g.Phase != "RESULTS" {
+		return false
+	}
+	_, dealt := g.Roles[userID]
+	return dealt
+}
+
+// CanPost keeps the dead out of the living's chat, and gives the mafia a channel of their own at night
+func (g *MafiaLogic) CanPost(s *Session, sender *Client, channel string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	playing := g.inPlay(sender.UserID)
+
+	switch channel {
+	case ChatChannelAll:
+		if playing && !g.IsAlive[sender.UserID] {
+			return gameError(ErrCodeNotAllowed, "the dead can only talk to the dead")
+		}
+	case ChatChannelDead:
+		if playing && g.IsAlive[sender.UserID] {
+			return gameError(ErrCodeNotAllowed, "only the dead can talk here")
+		}
+	case ChatChannelMafia:
+		if !playing || !g.IsAlive[sender.UserID] || g.Roles[sender.UserID] != ROLE_MAFIA {
+			return gameError(ErrCodeNotAllowed, "only the mafia can talk here")
+		}
+		if g.Phase != "NIGHT" {
+			return gameError(ErrCodeWrongPhase, "the mafia only meets at night")
+		}
+	default:
+		return gameError(ErrCodeBadRequest, "there's no %q channel in Mafia", channel)
+	}
+	return nil
+}
+
+// CanRead lets spectators and the dead follow the dead chat, the mafia channel stays with the mafia
+func (g *MafiaLogic) CanRead(s *Session, reader *Client, channel string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch channel {
+	case ChatChannelAll:
+		return true
+	case ChatChannelDead:
+		return !g.inPlay(reader.UserID) || !g.IsAlive[reader.UserID]
+	case ChatChannelMafia:
+		return g.Roles[reader.UserID] == ROLE_MAFIA
 	}
+	return false
+}
+
+func (g *MafiaLogic) HandleMessage(s *Session, sender *Client, msg []byte) error {
+	var payload MafiaAction
 
 	if err := json.Unmarshal(msg, &payload); err != nil {
 		log.Println("Mafia JSON Error:", err)
-		return
+		return gameError(ErrCodeBadRequest, "invalid Mafia action: %v", err)
 	}
 
 	g.mu.Lock()
 
-	if payload.Type == "night_action" && g.Phase == "NIGHT" {
-		if !g.IsAlive[sender.UserID] {
+	switch payload.Type {
+	case "set_roles", "set_timers", "extend_timer", "skip_timer":
+		if !sender.isHost() {
 			g.mu.Unlock()
-			return
+			return gameError(ErrCodeNotAllowed, "only the host can do that")
 		}
+	}
 
-		role := g.Roles[sender.UserID]
-		if role != ROLE_CIVILIAN {
-			g.NightActions[sender.UserID] = payload.TargetID
-
-			if g.haveAllNightActionsBeenReceived() {
-				g.mu.Unlock()
-				g.resolveNight(s) // Transition: Night -> Day
-				return
-			}
+	switch payload.Type {
+	case "set_roles":
+		defer g.mu.Unlock()
+		return g.setRoles(s, payload.Roles)
+	case "set_timers":
+		defer g.mu.Unlock()
+		return g.setTimers(s, payload.NightSeconds, payload.DaySeconds)
+	case "extend_timer":
+		defer g.mu.Unlock()
+		return g.extendTimer(s, payload.Seconds)
+	case "skip_timer":
+		// Resolve as if time ran out
+		return g.expirePhase(s, g.phaseTimerGen)
+	}
+
+	switch payload.Type {
+	case "night_action":
+		if g.Phase != "NIGHT" {
+			g.mu.Unlock()
+			return gameError(ErrCodeWrongPhase, "night actions are only allowed at night")
+		}
+	case "vote":
+		if g.Phase != "DAY" {
+			g.mu.Unlock()
+			return gameError(ErrCodeWrongPhase, "voting is only allowed during the day")
 		}
+	}
+
+	if !g.IsAlive[sender.UserID] {
 		g.mu.Unlock()
-		return
+		return gameError(ErrCodeNotAllowed, "dead players can't act")
 	}
 
-	if payload.Type == "vote" && g.Phase == "DAY" {
-		if !g.IsAlive[sender.UserID] {
+	if payload.Type == "night_action" {
+		// Only living players in this game can be targeted
+		if !g.IsAlive[payload.TargetID] {
 			g.mu.Unlock()
-			return
+			return gameError(ErrCodeInvalidTarget, "that player isn't alive")
+		}
+
+		role := g.Roles[sender.UserID]
+		if nightPrompt(role) == "" {
+			g.mu.Unlock()
+			return gameError(ErrCodeNotAllowed, "your role has nothing to do at night")
+		}
+		if role == ROLE_BODYGUARD && payload.TargetID == sender.UserID {
+			g.mu.Unlock()
+			return gameError(ErrCodeInvalidTarget, "you can't guard yourself")
+		}
+
+		g.NightActions[sender.UserID] = payload.TargetID
+
+		if g.haveAllNightActionsBeenReceived() {
+			g.mu.Unlock()
+			g.resolveNight(s) // Transition: Night -> Day
+			return nil
 		}
+		g.mu.Unlock()
+		return nil
+	}
 
+	if payload.Type == "vote" {
 		if payload.TargetID != "SKIP" && !g.IsAlive[payload.TargetID] {
 			g.mu.Unlock()
-			return
+			return gameError(ErrCodeInvalidTarget, "you can only vote for a living player")
 		}
 
 		g.Votes[sender.UserID] = payload.TargetID
 
-		aliveCount := 0
-		for _, alive := range g.IsAlive {
-			if alive {
-				aliveCount++
-			}
-		}
+		aliveCount := g.aliveCount()
 
 		if len(g.Votes) >= aliveCount {
 			g.mu.Unlock()
 			g.resolveDay(s) // <--- THIS IS THE CALL
-			return
+			return nil
 		}
 
 		g.broadcastState(s, "DAY", fmt.Sprintf("Votes: %d/%d", len(g.Votes), aliveCount))
 		g.mu.Unlock()
-		return
+		return nil
 	}
 
 	g.mu.Unlock()
+	return gameError(ErrCodeUnknownAction, "%q is not a Mafia action", payload.Type)
 }
 
 func (g *MafiaLogic) resolveNight(s *Session) {
 	g.mu.Lock()
 
+	// The last night action, a player leaving and the timer can all try to end the night
+	if g.Phase != "NIGHT" {
+		g.mu.Unlock()
+		return
+	}
+	g.stopPhaseTimer()
+
+	// Go through actors in a fixed order so the outcome doesn't depend on map iteration
+	actors := make([]string, 0, len(g.NightActions))
+	for actorID := range g.NightActions {
+		actors = append(actors, actorID)
+	}
+	sort.Strings(actors)
+
 	blockedPlayers := make(map[string]bool)
 
-	for actorID, targetID := range g.NightActions {
+	for _, actorID := range actors {
 		if g.Roles[actorID] == ROLE_WHORE {
-			blockedPlayers[targetID] = true //blocked
+			blockedPlayers[g.NightActions[actorID]] = true //blocked
 		}
 	}
 
-	killedID := ""
-	healedID := ""
-	policeResult := ""
-	policeRecipient := ""
+	killVotes := make(map[string]int) // the mafia's targets, most votes gets killed
+	killOrder := []string{}           // first pick wins a tie
+	healed := make(map[string]bool)
+	guardedBy := make(map[string]string) // target -> bodyguard
+	policeResults := make(map[string]string)
 
-	for actorID, targetID := range g.NightActions {
+	for _, actorID := range actors {
+		targetID := g.NightActions[actorID]
 
 		if blockedPlayers[actorID] {
 			client := g.getClientByID(s, actorID)
@@ -911,43 +2011,66 @@ func (g *MafiaLogic) resolveNight(s *Session) {
 		role := g.Roles[actorID]
 		switch role {
 		case ROLE_MAFIA:
-			killedID = targetID
+			if killVotes[targetID] == 0 {
+				killOrder = append(killOrder, targetID)
+			}
+			killVotes[targetID]++
 		case ROLE_DOCTOR:
-			healedID = targetID
+			healed[targetID] = true
+		case ROLE_BODYGUARD:
+			if _, taken := guardedBy[targetID]; !taken {
+				guardedBy[targetID] = actorID
+			}
 		case ROLE_POLICE:
-			policeRecipient = actorID
 			targetRole := g.Roles[targetID]
 			isDetected := targetRole == ROLE_MAFIA
 			targetUsername := g.getUsername(s, targetID)
 
 			if isDetected {
-				policeResult = fmt.Sprintf("%s is MAFIA", targetUsername)
+				policeResults[actorID] = fmt.Sprintf("%s is MAFIA", targetUsername)
 			} else {
-				policeResult = fmt.Sprintf("%s is Innocent", targetUsername)
+				policeResults[actorID] = fmt.Sprintf("%s is Innocent", targetUsername)
 			}
 		}
 	}
 
+	killedID := ""
+	for _, targetID := range killOrder {
+		if killVotes[targetID] > killVotes[killedID] {
+			killedID = targetID
+		}
+	}
+
 	finalDeathMsg := "The night was quiet"
 
 	if killedID != "" {
-		if killedID == healedID {
+		bodyguardID, guarded := guardedBy[killedID]
+
+		if healed[killedID] {
 			finalDeathMsg = "The Doctor saved the victim"
 
 		} else if blockedPlayers[killedID] {
 			finalDeathMsg = "The Whore distracted the victim" // Ambiguous message
 			killedID = ""
+		} else if guarded && healed[bodyguardID] {
+			finalDeathMsg = "The Bodyguard fought off the attack"
+		} else if guarded {
+			// The bodyguard takes the hit
+			g.IsAlive[bodyguardID] = false
+			g.Drinks.owe(bodyguardID, mafiaDeathDrinks)
+			finalDeathMsg = fmt.Sprintf("%s died protecting someone in the night", g.getUsername(s, bodyguardID))
 		} else {
 			// Kill successful
 			g.IsAlive[killedID] = false
+			g.Drinks.owe(killedID, mafiaDeathDrinks)
 			finalDeathMsg = fmt.Sprintf("%s was killed in the night", g.getUsername(s, killedID))
 		}
 	}
 
 	// 5. Send Intel to Police/Spy
-	if policeRecipient != "" && policeResult != "" {
-		c := g.getClientByID(s, policeRecipient)
-		g.sendPrivateMessage(c, "intel", policeResult)
+	for policeID, result := range policeResults {
+		c := g.getClientByID(s, policeID)
+		g.sendPrivateMessage(c, "intel", result)
 	}
 
 	if g.checkWinCondition(s) {
@@ -955,24 +2078,31 @@ func (g *MafiaLogic) resolveNight(s *Session) {
 		return
 	}
 
-	g.mu.Unlock()
-
-	// Start Day
+	// Start Day before letting go of the lock, so no late night action sneaks in
 	g.startDayPhase(s, finalDeathMsg)
+	g.mu.Unlock()
 }
 
 func (g *MafiaLogic) resolveDay(s *Session) {
 	g.mu.Lock()
 
+	if g.Phase != "DAY" {
+		g.mu.Unlock()
+		return
+	}
+	g.stopPhaseTimer()
+
 	// 1. Tally Votes
 	voteCounts := make(map[string]int)
 	skipCount := 0 // Track skips
 
-	for _, target := range g.Votes {
+	for voterID, target := range g.Votes {
+		weight := voteWeight(g.Roles[voterID])
 		if target == "SKIP" {
-			skipCount++
+			skipCount += weight
 		} else {
-			voteCounts[target]++
+			voteCounts[target] += weight
+			g.VotesReceived[target] += weight
 		}
 	}
 
@@ -998,7 +2128,11 @@ func (g *MafiaLogic) resolveDay(s *Session) {
 		resultMsg = "Tie vote. No one was executed."
 	} else {
 		g.IsAlive[victimID] = false
+		g.Drinks.owe(victimID, mafiaDeathDrinks)
 		resultMsg = fmt.Sprintf("The town decided. %s was executed.", g.getUsername(s, victimID))
+		if g.Roles[victimID] == ROLE_JESTER {
+			g.LynchedJester = victimID
+		}
 	}
 
 	g.Phase = "RESULTS"
@@ -1007,10 +2141,16 @@ func (g *MafiaLogic) resolveDay(s *Session) {
 	g.mu.Unlock()
 
 	// 3. Wait 5 seconds, THEN check win or start night
+	wait := s.Clock.NewTimer(5 * time.Second)
 	go func() {
-		time.Sleep(5 * time.Second)
+		<-wait.C()
 
 		g.mu.Lock()
+		if g.Phase != "RESULTS" {
+			// The host reset the game while we were waiting
+			g.mu.Unlock()
+			return
+		}
 		if g.checkWinCondition(s) {
 			g.mu.Unlock()
 			return // Game Over broadcast sent inside checkWinCondition
@@ -1022,13 +2162,13 @@ func (g *MafiaLogic) resolveDay(s *Session) {
 	}()
 }
 
+// startDayPhase opens the vote. Caller must hold g.mu.
 func (g *MafiaLogic) startDayPhase(s *Session, morningMsg string) {
-	g.mu.Lock()
 	g.Phase = "DAY"
 	g.Votes = make(map[string]string) // Reset votes
+	g.startPhaseTimer(s, g.dayTime())
 
 	g.broadcastState(s, "DAY", morningMsg+" Discuss and Vote")
-	g.mu.Unlock()
 }
 func (g *MafiaLogic) checkWinCondition(s *Session) bool {
 	activeMafiaCount := 0
@@ -1051,48 +2191,81 @@ func (g *MafiaLogic) checkWinCondition(s *Session) bool {
 	}
 
 	winner := ""
+	message := ""
 
-	if activeMafiaCount == 0 {
+	if g.LynchedJester != "" {
+		winner = ROLE_JESTER
+		message = fmt.Sprintf("GAME OVER! %s was the Jester and wanted to be executed. JESTER WINS!", g.Usernames[g.LynchedJester])
+	} else if activeMafiaCount == 0 {
 		winner = "CIVILIANS"
 	} else if mafiaTeamCount >= civTeamCount {
 		winner = "MAFIA"
 	}
 
 	if winner != "" {
+		if message == "" {
+			message = fmt.Sprintf("GAME OVER! %s WIN!", winner)
+		}
+		if g.Phase != "GAME_OVER" {
+			s.recordResult(g.buildResult(winner))
+		}
 		g.Phase = "GAME_OVER"
+		g.stopPhaseTimer()
 
-		alive := []PlayerInfo{}
-		dead := []PlayerInfo{}
-
-		for client := range s.Clients {
-			p := PlayerInfo{ID: client.UserID, Username: client.Username}
-			if g.IsAlive[client.UserID] {
-				alive = append(alive, p)
-			} else {
-				dead = append(dead, p)
-			}
-		}
+		alive, dead := g.playerLists(s)
 
 		payload := GameStatePayload{
 			Action: "game_update",
 			GameState: MafiaGameState{
 				Phase:         "GAME_OVER",
-				Message:       fmt.Sprintf("GAME OVER! %s WIN!", winner),
+				Message:       message,
 				AlivePlayers:  alive,
 				DeadPlayers:   dead,
 				Votes:         g.Votes,
 				Winner:        winner,
 				RevealedRoles: g.Roles,
+				Drinks:        g.Drinks.tally(),
 			},
 		}
 
 		bytes, _ := json.Marshal(payload)
-		s.Broadcast <- bytes
+		toRun(s, s.Broadcast, bytes)
 		return true
 	}
 	return false
 }
 
+// buildResult credits everyone on the winning team, dead or alive. The Jester plays for themselves.
+func (g *MafiaLogic) buildResult(winner string) *drinkinggame.GameResult {
+	result := &drinkinggame.GameResult{WinningSide: winner}
+	for id, role := range g.Roles {
+		var won bool
+		switch {
+		case role == ROLE_JESTER:
+			won = winner == ROLE_JESTER
+		case isMafiaTeam(role):
+			won = winner == "MAFIA"
+		default:
+			won = winner == "CIVILIANS"
+		}
+		survived := 0
+		if g.IsAlive[id] {
+			survived = 1
+		}
+		result.Participants = append(result.Participants, drinkinggame.Participant{
+			UserID:   id,
+			Username: g.Usernames[id],
+			Role:     role,
+			Won:      won,
+			Stats: map[string]int{
+				"votes_received": g.VotesReceived[id],
+				"survived":       survived,
+			},
+		})
+	}
+	return result
+}
+
 func (g *MafiaLogic) haveAllNightActionsBeenReceived() bool {
 	for id, alive := range g.IsAlive {
 		if !alive { // If player is dead do nothing
@@ -1101,7 +2274,7 @@ func (g *MafiaLogic) haveAllNightActionsBeenReceived() bool {
 
 		role := g.Roles[id]
 
-		if role != ROLE_CIVILIAN && role != ROLE_SPY {
+		if nightPrompt(role) != "" {
 			if _, ok := g.NightActions[id]; !ok {
 				return false // Waiting for this person
 			}
@@ -1115,6 +2288,7 @@ func (g *MafiaLogic) startNightPhase(s *Session) {
 	g.Phase = "NIGHT"
 	g.NightActions = make(map[string]string)
 	g.Votes = make(map[string]string)
+	g.startPhaseTimer(s, g.nightTime())
 
 	g.broadcastState(s, "NIGHT", "Night has fallen")
 
@@ -1126,28 +2300,13 @@ func (g *MafiaLogic) startNightPhase(s *Session) {
 	}
 	mafiaListStr := strings.Join(mafiaNames, ", ")
 
-	for client := range s.Clients {
+	for _, client := range s.players() {
 		role := g.Roles[client.UserID]
 		if !g.IsAlive[client.UserID] {
 			continue
 		}
 
-		var prompt string
-
-		switch role {
-		case ROLE_MAFIA:
-			prompt = "Choose a player to KILL"
-		case ROLE_DOCTOR:
-			prompt = "Choose a player to SAVE"
-		case ROLE_POLICE:
-			prompt = "Choose a player to INVESTIGATE"
-		case ROLE_WHORE:
-			prompt = "Choose a player to FUCK"
-		default:
-			prompt = "Sleep tight..."
-		}
-
-		if prompt != "Sleep tight..." {
+		if prompt := nightPrompt(role); prompt != "" {
 			g.sendPrivateMessage(client, "action_request", prompt)
 		}
 
@@ -1160,20 +2319,165 @@ func (g *MafiaLogic) startNightPhase(s *Session) {
 	g.mu.Unlock()
 }
 
+// nightPrompt is the action request for roles that act at night, empty for everyone else
+func nightPrompt(role string) string {
+	switch role {
+	case ROLE_MAFIA:
+		return "Choose a player to KILL"
+	case ROLE_DOCTOR:
+		return "Choose a player to SAVE"
+	case ROLE_POLICE:
+		return "Choose a player to INVESTIGATE"
+	case ROLE_WHORE:
+		return "Choose a player to FUCK"
+	case ROLE_BODYGUARD:
+		return "Choose a player to PROTECT"
+	default:
+		return ""
+	}
+}
+
 func (g *MafiaLogic) sendPrivateMessage(c *Client, typeStr string, content string) {
+	if c == nil {
+		return
+	}
 	msg := map[string]interface{}{
 		"action":  typeStr,
 		"content": content,
 	}
 	data, _ := json.Marshal(msg)
-	c.Send <- data
+	c.trySend(data)
 }
 
-func (g *MafiaLogic) broadcastState(s *Session, phase string, msg string) {
+// PlayersChanged takes players who left out of the game and resolves the phase if
+// they were the ones everybody was waiting on. Anyone joining mid-game sits it out.
+func (g *MafiaLogic) PlayersChanged(s *Session) {
+	g.mu.Lock()
+
+	if g.Phase != "NIGHT" && g.Phase != "DAY" {
+		g.mu.Unlock()
+		return
+	}
+
+	present := make(map[string]bool)
+	for _, c := range s.players() {
+		present[c.UserID] = true
+	}
+
+	removed := false
+	for id, alive := range g.IsAlive {
+		if alive && !present[id] {
+			g.IsAlive[id] = false
+			delete(g.NightActions, id)
+			delete(g.Votes, id)
+			removed = true
+		}
+	}
+	if !removed {
+		g.mu.Unlock()
+		return
+	}
+
+	if g.checkWinCondition(s) {
+		g.mu.Unlock()
+		return
+	}
+
+	if g.Phase == "NIGHT" && g.haveAllNightActionsBeenReceived() {
+		g.mu.Unlock()
+		g.resolveNight(s)
+		return
+	}
+
+	if g.Phase == "DAY" && len(g.Votes) >= g.aliveCount() {
+		g.mu.Unlock()
+		g.resolveDay(s)
+		return
+	}
+
+	g.broadcastState(s, g.Phase, "A player left the game")
+	g.mu.Unlock()
+}
+
+func (g *MafiaLogic) aliveCount() int {
+	count := 0
+	for _, alive := range g.IsAlive {
+		if alive {
+			count++
+		}
+	}
+	return count
+}
+
+// SyncState gives a reconnecting player back their role, the board and any pending night prompt
+func (g *MafiaLogic) SyncState(s *Session, client *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.Roles == nil {
+		return
+	}
+
+	alive, dead := g.playerLists(s)
+	state := MafiaGameState{
+		Phase:         g.Phase,
+		Message:       g.LastMessage,
+		AlivePlayers:  alive,
+		DeadPlayers:   dead,
+		Votes:         g.Votes,
+		MyRole:        g.Roles[client.UserID],
+		TimeRemaining: g.timeRemaining(s),
+		Drinks:        g.Drinks.tally(),
+	}
+	if g.Phase == "GAME_OVER" {
+		state.RevealedRoles = g.Roles
+	}
+	if g.Phase == "LOBBY" || g.Phase == "GAME_OVER" {
+		state.RoleCounts = g.RoleCounts
+	}
+
+	bytes, _ := json.Marshal(GameStatePayload{Action: "game_update", GameState: state})
+	client.trySend(bytes)
+
+	if g.Phase == "NIGHT" && g.IsAlive[client.UserID] {
+		if _, acted := g.NightActions[client.UserID]; !acted {
+			if prompt := nightPrompt(g.Roles[client.UserID]); prompt != "" {
+				g.sendPrivateMessage(client, "action_request", prompt)
+			}
+		}
+	}
+}
+
+func (g *MafiaLogic) TakeDrinks(userID string, n int) (map[string]DrinkTally, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.Phase == "LOBBY" || g.Drinks == nil {
+		return nil, gameError(ErrCodeWrongPhase, "the game hasn't started")
+	}
+	g.Drinks.take(userID, n)
+	return g.Drinks.tally(), nil
+}
+
+func (g *MafiaLogic) FinalTally(userID string) (DrinkTally, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase != "GAME_OVER" {
+		return DrinkTally{}, false
+	}
+	if t := g.Drinks[userID]; t != nil {
+		return *t, true
+	}
+	return DrinkTally{}, true
+}
+
+// playerLists splits the players into alive and dead, spectators are in neither
+func (g *MafiaLogic) playerLists(s *Session) ([]PlayerInfo, []PlayerInfo) {
 	alive := []PlayerInfo{}
 	dead := []PlayerInfo{}
 
-	for client := range s.Clients {
+	for _, client := range s.players() {
 		p := PlayerInfo{ID: client.UserID, Username: client.Username}
 		if g.IsAlive[client.UserID] { //If the user is alive
 			alive = append(alive, p)
@@ -1181,49 +2485,56 @@ func (g *MafiaLogic) broadcastState(s *Session, phase string, msg string) {
 			dead = append(dead, p)
 		}
 	}
+	return alive, dead
+}
+
+func (g *MafiaLogic) broadcastState(s *Session, phase string, msg string) {
+	g.LastMessage = msg
+	alive, dead := g.playerLists(s)
 
 	payload := GameStatePayload{
 		Action: "game_update",
 		GameState: MafiaGameState{
-			Phase:        phase,
-			Message:      msg,
-			AlivePlayers: alive,
-			DeadPlayers:  dead,
-			Votes:        g.Votes,
+			Phase:         phase,
+			Message:       msg,
+			AlivePlayers:  alive,
+			DeadPlayers:   dead,
+			Votes:         g.Votes,
+			TimeRemaining: g.timeRemaining(s),
+			Drinks:        g.Drinks.tally(),
 		},
 	}
 
 	bytes, _ := json.Marshal(payload)
-	s.Broadcast <- bytes //sending the whole shit to the sessions broadcast channel, which then sends the state to every client
+	toRun(s, s.Broadcast, bytes) //sending the whole shit to the sessions broadcast channel, which then sends the state to every client
 }
-func (g *MafiaLogic) assignRoles(s *Session) {
-	ids := make([]string, 0, len(s.Clients))
-	for client := range s.Clients {
+
+// assignRoles deals counts out to the players, checkRoleCounts must have passed. Caller must hold g.mu.
+func (g *MafiaLogic) assignRoles(s *Session, players []*Client, counts map[string]int) {
+	ids := make([]string, 0, len(players))
+	for _, client := range players {
 		ids = append(ids, client.UserID)
 	}
 	count := len(ids)
 
-	rand.NewSource(time.Now().UnixNano())
-	rand.Shuffle(count, func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	// players() comes from a map, sort first so a seeded shuffle deals the same roles
+	sort.Strings(ids)
+	s.Rand.Shuffle(count, func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
 
 	// Default all to CIVILIAN
 	for _, id := range ids {
 		g.Roles[id] = ROLE_CIVILIAN
 	}
 
-	// 1. Always 1 Mafia
-	g.Roles[ids[0]] = ROLE_MAFIA
-
-	if count == 4 {
-		g.Roles[ids[1]] = ROLE_DOCTOR
-	} else if count >= 5 {
-		g.Roles[ids[1]] = ROLE_DOCTOR
-		g.Roles[ids[2]] = ROLE_POLICE
-		g.Roles[ids[3]] = ROLE_SPY
-		g.Roles[ids[4]] = ROLE_WHORE
+	next := 0
+	for _, role := range mafiaRoleOrder {
+		for n := 0; n < counts[role]; n++ {
+			g.Roles[ids[next]] = role
+			next++
+		}
 	}
 
-	for client := range s.Clients {
+	for _, client := range players {
 		role := g.Roles[client.UserID]
 
 		payload := GameStatePayload{
@@ -1235,12 +2546,12 @@ func (g *MafiaLogic) assignRoles(s *Session) {
 			},
 		}
 		bytes, _ := json.Marshal(payload)
-		client.Send <- bytes
+		client.trySend(bytes)
 	}
 }
 
 func (g *MafiaLogic) getUsername(s *Session, userID string) string {
-	for c := range s.Clients {
+	for _, c := range s.players() {
 		if c.UserID == userID {
 			return c.Username
 		}
@@ -1249,10 +2560,941 @@ func (g *MafiaLogic) getUsername(s *Session, userID string) string {
 }
 
 func (g *MafiaLogic) getClientByID(s *Session, userID string) *Client {
-	for c := range s.Clients {
+	for _, c := range s.players() {
 		if c.UserID == userID {
 			return c
 		}
 	}
 	return nil
 }
+
+var neverHaveIEverPacks = map[string][]string{
+	"classic": {
+		"Never have I ever lied about my age",
+		"Never have I ever fallen asleep at a party",
+		"Never have I ever sent a text to the wrong person",
+		"Never have I ever pretended to be sick to skip work or school",
+		"Never have I ever forgotten someone's name right after meeting them",
+		"Never have I ever stalked an ex on social media",
+		"Never have I ever broken something and blamed someone else",
+		"Never have I ever eaten food off the floor",
+		"Never have I ever gone a whole weekend without showering",
+		"Never have I ever cried at a movie",
+		"Never have I ever been kicked out of a bar",
+		"Never have I ever re-gifted a present",
+	},
+	"spicy": {
+		"Never have I ever kissed a stranger",
+		"Never have I ever sent a risky photo",
+		"Never have I ever had a crush on a friend's partner",
+		"Never have I ever skinny dipped",
+		"Never have I ever ghosted someone after a date",
+		"Never have I ever kissed someone in this room",
+		"Never have I ever lied in a game of Never Have I Ever",
+		"Never have I ever hooked up with an ex",
+		"Never have I ever woken up not knowing where I was",
+		"Never have I ever been on a blind date",
+	},
+	"party": {
+		"Never have I ever thrown up in a taxi",
+		"Never have I ever lost my phone on a night out",
+		"Never have I ever danced on a table",
+		"Never have I ever drunk texted my boss",
+		"Never have I ever started a night out on a Monday",
+		"Never have I ever done karaoke sober",
+		"Never have I ever snuck into a club",
+		"Never have I ever ordered food at 4am",
+		"Never have I ever ended up at an afterparty with strangers",
+		"Never have I ever missed a flight because of a hangover",
+	},
+}
+
+const defaultNeverHaveIEverPack = "classic"
+
+type NeverHaveIEverRound struct {
+	Prompt  string       `json:"prompt"`
+	Have    []PlayerInfo `json:"have"`    // Said "I have" and drank
+	HaveNot []PlayerInfo `json:"haveNot"` // Said "I haven't"
+}
+
+type NeverHaveIEverGameState struct {
+	Players       []PlayerInfo          `json:"players,omitempty"`
+	Phase         string                `json:"phase"` // "answering", "reveal", "game_over"
+	Pack          string                `json:"pack"`
+	Packs         []string              `json:"packs,omitempty"`
+	Prompt        string                `json:"prompt,omitempty"`
+	CurrentNumber int                   `json:"currentNumber,omitempty"`
+	TotalPrompts  int                   `json:"totalPrompts,omitempty"`
+	Answered      []string              `json:"answered"` // IDs of players who answered, not what they answered
+	Round         *NeverHaveIEverRound  `json:"round,omitempty"`
+	Drinks        map[string]DrinkTally `json:"drinks,omitempty"` // PlayerID -> drinks this game
+}
+
+type NeverHaveIEverLogic struct {
+	mu          sync.Mutex
+	Pack        string
+	Prompts     []string
+	PromptIndex int
+	Phase       string
+	Players     []PlayerInfo
+	Answers     map[string]bool // PlayerID -> true for "I have", cleared every prompt
+	Drinks      drinkLedger     // everyone who has, drinks when the answers are revealed
+	LastRound   *NeverHaveIEverRound
+}
+
+func (g *NeverHaveIEverLogic) InitState(s *Session) interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := neverHaveIEverPacks[g.Pack]; !ok {
+		g.Pack = defaultNeverHaveIEverPack
+	}
+
+	g.Players = sortedPlayers(s)
+	g.Drinks = make(drinkLedger)
+	g.loadPack(g.Pack, s.Rand)
+
+	g.broadcastGameState(s)
+
+	return g.buildGameState()
+}
+
+func (g *NeverHaveIEverLogic) ResetState(s *Session) {
+	g.InitState(s)
+}
+
+// loadPack shuffles a fresh copy of the pack and starts at the first prompt. Caller must hold g.mu.
+func (g *NeverHaveIEverLogic) loadPack(pack string, rng *rand.Rand) {
+	g.Pack = pack
+	g.Prompts = append([]string(nil), neverHaveIEverPacks[pack]...)
+	rng.Shuffle(len(g.Prompts), func(i, j int) {
+		g.Prompts[i], g.Prompts[j] = g.Prompts[j], g.Prompts[i]
+	})
+	g.PromptIndex = 0
+	g.Answers = make(map[string]bool)
+	g.LastRound = nil
+	g.Phase = "answering"
+}
+
+// NeverHaveIEverAction is a game_action in Never Have I Ever
+type NeverHaveIEverAction struct {
+	Envelope
+	Pack   string `json:"pack,omitempty"`
+	Answer string `json:"answer,omitempty"` // "have" or "havent"
+}
+
+var neverHaveIEverActions = map[string]ActionSchema{
+	"select_pack": {Fields: map[string]FieldKind{"pack": FieldString}, Required: []string{"pack"}, HostOnly: true},
+	"answer":      {Fields: map[string]FieldKind{"answer": FieldString}, Required: []string{"answer"}},
+	"reveal":      {HostOnly: true},
+	"next_prompt": {HostOnly: true},
+}
+
+func (g *NeverHaveIEverLogic) Actions() map[string]ActionSchema {
+	return neverHaveIEverActions
+}
+
+func (g *NeverHaveIEverLogic) HandleMessage(s *Session, sender *Client, msg []byte) error {
+	var request NeverHaveIEverAction
+
+	if err := json.Unmarshal(msg, &request); err != nil {
+		return gameError(ErrCodeBadRequest, "invalid Never Have I Ever action: %v", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" {
+		log.Println("Never Have I Ever: game not started yet")
+		return gameError(ErrCodeWrongPhase, "the game hasn't started")
+	}
+
+	switch request.Type {
+
+	case "select_pack":
+		if !sender.isHost() {
+			return gameError(ErrCodeNotAllowed, "only the host can pick the pack")
+		}
+		if _, ok := neverHaveIEverPacks[request.Pack]; !ok {
+			log.Printf("Never Have I Ever: unknown pack %q", request.Pack)
+			return gameError(ErrCodeBadRequest, "there's no %q pack", request.Pack)
+		}
+		g.loadPack(request.Pack, s.Rand)
+		g.broadcastGameState(s)
+
+	case "answer":
+		if g.Phase != "answering" {
+			return gameError(ErrCodeWrongPhase, "answers are closed for this prompt")
+		}
+		if g.GetPlayerInfoByID(sender.UserID) == nil {
+			return gameError(ErrCodeNotAllowed, "you joined after this round started")
+		}
+		if _, answered := g.Answers[sender.UserID]; answered {
+			return gameError(ErrCodeNotAllowed, "you already answered")
+		}
+
+		switch request.Answer {
+		case "have":
+			g.Answers[sender.UserID] = true
+		case "havent":
+			g.Answers[sender.UserID] = false
+		default:
+			log.Printf("Never Have I Ever: invalid answer %q from %s", request.Answer, sender.Username)
+			return gameError(ErrCodeBadRequest, `answer must be "have" or "havent"`)
+		}
+
+		if len(g.Answers) >= len(g.Players) {
+			g.reveal()
+		}
+		g.broadcastGameState(s)
+
+	case "reveal":
+		if !sender.isHost() {
+			return gameError(ErrCodeNotAllowed, "only the host can reveal")
+		}
+		if g.Phase != "answering" {
+			return gameError(ErrCodeWrongPhase, "nothing to reveal")
+		}
+		g.reveal()
+		g.broadcastGameState(s)
+
+	case "next_prompt":
+		if !sender.isHost() {
+			return gameError(ErrCodeNotAllowed, "only the host can move on")
+		}
+		if g.Phase != "reveal" {
+			return gameError(ErrCodeWrongPhase, "reveal the answers first")
+		}
+
+		g.PromptIndex++
+		g.Answers = make(map[string]bool)
+		g.LastRound = nil
+
+		if g.PromptIndex >= len(g.Prompts) {
+			g.Phase = "game_over"
+		} else {
+			g.Phase = "answering"
+		}
+		g.broadcastGameState(s)
+
+	default:
+		log.Printf("Unknown game action type: %s from %s\n", request.Type, sender.Username)
+		return gameError(ErrCodeUnknownAction, "%q is not a Never Have I Ever action", request.Type)
+	}
+	return nil
+}
+
+// reveal shows who has and who hasn't, and pours a drink for everyone who has. Caller must hold g.mu.
+func (g *NeverHaveIEverLogic) reveal() {
+	round := &NeverHaveIEverRound{
+		Prompt:  g.Prompts[g.PromptIndex],
+		Have:    []PlayerInfo{},
+		HaveNot: []PlayerInfo{},
+	}
+
+	for _, p := range g.Players {
+		have, answered := g.Answers[p.ID]
+		if !answered {
+			continue
+		}
+		if have {
+			round.Have = append(round.Have, p)
+			g.Drinks.owe(p.ID, 1)
+		} else {
+			round.HaveNot = append(round.HaveNot, p)
+		}
+	}
+
+	g.LastRound = round
+	g.Phase = "reveal"
+}
+
+func (g *NeverHaveIEverLogic) GetPlayerInfoByID(playerID string) *PlayerInfo {
+	for _, p := range g.Players {
+		if p.ID == playerID {
+			return &p
+		}
+	}
+	return nil
+}
+
+// buildGameState snapshots the game for the client. Caller must hold g.mu.
+func (g *NeverHaveIEverLogic) buildGameState() NeverHaveIEverGameState {
+	packs := make([]string, 0, len(neverHaveIEverPacks))
+	for name := range neverHaveIEverPacks {
+		packs = append(packs, name)
+	}
+	sort.Strings(packs)
+
+	answered := make([]string, 0, len(g.Answers))
+	for id := range g.Answers {
+		answered = append(answered, id)
+	}
+	sort.Strings(answered)
+
+	state := NeverHaveIEverGameState{
+		Players:      g.Players,
+		Phase:        g.Phase,
+		Pack:         g.Pack,
+		Packs:        packs,
+		TotalPrompts: len(g.Prompts),
+		Answered:     answered,
+		Round:        g.LastRound,
+		Drinks:       g.Drinks.tally(),
+	}
+
+	if g.PromptIndex < len(g.Prompts) {
+		state.Prompt = g.Prompts[g.PromptIndex]
+		state.CurrentNumber = g.PromptIndex + 1
+	}
+	return state
+}
+
+func (g *NeverHaveIEverLogic) broadcastGameState(s *Session) {
+	broadcast(s, GameStatePayload{
+		Action:    "game_update",
+		GameState: g.buildGameState(),
+	})
+}
+
+// PlayersChanged keeps the table in sync, tallies survive for anyone still playing
+func (g *NeverHaveIEverLogic) PlayersChanged(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" {
+		return
+	}
+
+	g.Players = sortedPlayers(s)
+	present := make(map[string]bool)
+	for _, p := range g.Players {
+		present[p.ID] = true
+	}
+	for id := range g.Answers {
+		if !present[id] {
+			delete(g.Answers, id)
+		}
+	}
+
+	if g.Phase == "answering" && len(g.Players) > 0 && len(g.Answers) >= len(g.Players) {
+		g.reveal()
+	}
+	g.broadcastGameState(s)
+}
+
+func (g *NeverHaveIEverLogic) TakeDrinks(userID string, n int) (map[string]DrinkTally, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.GetPlayerInfoByID(userID) == nil {
+		return nil, gameError(ErrCodeWrongPhase, "you're not in a game")
+	}
+	g.Drinks.take(userID, n)
+	return g.Drinks.tally(), nil
+}
+
+func (g *NeverHaveIEverLogic) FinalTally(userID string) (DrinkTally, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase != "game_over" {
+		return DrinkTally{}, false
+	}
+	if t := g.Drinks[userID]; t != nil {
+		return *t, true
+	}
+	return DrinkTally{}, true
+}
+
+func (g *NeverHaveIEverLogic) SyncState(s *Session, client *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" {
+		return
+	}
+
+	bytes, _ := json.Marshal(GameStatePayload{Action: "game_update", GameState: g.buildGameState()})
+	client.trySend(bytes)
+}
+
+// Pyramid rows bottom to top, a matching card in row N hands out N drinks
+var rideTheBusPyramidRows = []int{4, 3, 2, 1}
+
+const rideTheBusRounds = 4
+
+type PyramidCard struct {
+	Row  int         `json:"row"`
+	Card *ClientCard `json:"card,omitempty"` // nil while still face down
+}
+
+type RideTheBusGameState struct {
+	Players             []PlayerInfo            `json:"players,omitempty"`
+	Phase               string                  `json:"phase"` // "guessing", "pyramid", "bus", "game_over"
+	Round               int                     `json:"round,omitempty"`
+	CurrentPlayerTurnID *string                 `json:"currentPlayerTurnID,omitempty"`
+	Hands               map[string][]ClientCard `json:"hands"`
+	LastCard            *ClientCard             `json:"lastCard,omitempty"`
+	LastGuessCorrect    *bool                   `json:"lastGuessCorrect,omitempty"`
+	Pyramid             []PyramidCard           `json:"pyramid,omitempty"`
+	PendingAssignments  map[string]int          `json:"pendingAssignments,omitempty"` // PlayerID -> drinks they still get to hand out
+	BusRiderID          string                  `json:"busRiderId,omitempty"`
+	BusCards            []ClientCard            `json:"busCards,omitempty"`
+	Drinks              map[string]DrinkTally   `json:"drinks,omitempty"` // PlayerID -> drinks this game
+	DrinksAssigned      map[string]int          `json:"drinksAssigned"`
+	CardsRemaining      int                     `json:"cardsRemaining"`
+	Message             string                  `json:"message,omitempty"`
+}
+
+type RideTheBusLogic struct {
+	mu                 sync.Mutex
+	Deck               []utils.Card
+	Players            []PlayerInfo
+	TurnIndex          int // Index in Players of whoever guesses next during "guessing"
+	Phase              string
+	Round              int // 1-4: red/black, higher/lower, inside/outside, suit
+	Hands              map[string][]utils.Card
+	LastCard           *utils.Card
+	LastGuessCorrect   *bool
+	Pyramid            []utils.Card
+	PyramidFlipped     int
+	PendingAssignments map[string]int
+	BusRiderID         string
+	BusCards           []utils.Card // Cards the rider got right in the current attempt
+	Drinks             drinkLedger  // wrong guesses, drinks handed out at the pyramid and the bus ride
+	DrinksAssigned     map[string]int
+	Message            string
+
+	rng *rand.Rand // the session's RNG, kept for reshuffles
+}
+
+func (g *RideTheBusLogic) InitState(s *Session) interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rng = s.Rand
+	g.Deck = utils.NewShuffledDeck(g.rng)
+	g.Players = sortedPlayers(s)
+	g.TurnIndex = 0
+	g.Phase = "guessing"
+	g.Round = 1
+	g.Hands = make(map[string][]utils.Card)
+	g.LastCard = nil
+	g.LastGuessCorrect = nil
+	g.Pyramid = nil
+	g.PyramidFlipped = 0
+	g.PendingAssignments = make(map[string]int)
+	g.BusRiderID = ""
+	g.BusCards = nil
+	g.Drinks = make(drinkLedger)
+	g.DrinksAssigned = make(map[string]int)
+	g.Message = roundPrompt(1)
+
+	for _, p := range g.Players {
+		g.Hands[p.ID] = []utils.Card{}
+		g.DrinksAssigned[p.ID] = 0
+	}
+
+	g.broadcastGameState(s)
+
+	return g.buildGameState()
+}
+
+func (g *RideTheBusLogic) ResetState(s *Session) {
+	g.InitState(s)
+}
+
+// RideTheBusAction is a game_action in Ride the Bus
+type RideTheBusAction struct {
+	Envelope
+	Guess    string `json:"guess,omitempty"`
+	TargetID string `json:"targetId,omitempty"`
+	Amount   int    `json:"amount,omitempty"`
+}
+
+var rideTheBusActions = map[string]ActionSchema{
+	"guess":         {Fields: map[string]FieldKind{"guess": FieldString}, Required: []string{"guess"}},
+	"flip_card":     {HostOnly: true},
+	"assign_drinks": {Fields: map[string]FieldKind{"targetId": FieldString, "amount": FieldInt}, Required: []string{"targetId"}},
+}
+
+func (g *RideTheBusLogic) Actions() map[string]ActionSchema {
+	return rideTheBusActions
+}
+
+func (g *RideTheBusLogic) HandleMessage(s *Session, sender *Client, msg []byte) error {
+	var request RideTheBusAction
+
+	if err := json.Unmarshal(msg, &request); err != nil {
+		return gameError(ErrCodeBadRequest, "invalid Ride the Bus action: %v", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.Players) == 0 {
+		log.Println("No players in the game logic. Cannot handle messages.")
+		return gameError(ErrCodeWrongPhase, "the game hasn't started")
+	}
+
+	switch request.Type {
+
+	case "guess":
+		switch g.Phase {
+		case "guessing":
+			if !isPlayersTurn(g.Players, g.TurnIndex, sender.UserID) {
+				log.Printf("It's not %s's turn to guess.\n", sender.Username)
+				return gameError(ErrCodeNotYourTurn, "it's not your turn to guess")
+			}
+			if !validRideTheBusGuess(g.Round, request.Guess) {
+				return gameError(ErrCodeBadRequest, "%s", roundPrompt(g.Round))
+			}
+			g.handleRoundGuess(sender, request.Guess)
+		case "bus":
+			if sender.UserID != g.BusRiderID {
+				return gameError(ErrCodeNotYourTurn, "only the bus rider guesses now")
+			}
+			if !validRideTheBusGuess(len(g.BusCards)+1, request.Guess) {
+				return gameError(ErrCodeBadRequest, "%s", roundPrompt(len(g.BusCards)+1))
+			}
+			g.handleBusGuess(sender, request.Guess)
+		default:
+			return gameError(ErrCodeWrongPhase, "there's nothing to guess right now")
+		}
+		g.broadcastGameState(s)
+
+	case "flip_card":
+		if !sender.isHost() {
+			return gameError(ErrCodeNotAllowed, "only the host can flip cards")
+		}
+		if g.Phase != "pyramid" {
+			return gameError(ErrCodeWrongPhase, "the pyramid isn't out yet")
+		}
+		if g.PyramidFlipped >= len(g.Pyramid) {
+			g.startBus()
+		} else {
+			g.flipPyramidCard()
+		}
+		g.broadcastGameState(s)
+
+	case "assign_drinks":
+		if g.Phase != "pyramid" {
+			return gameError(ErrCodeWrongPhase, "drinks are handed out during the pyramid")
+		}
+		pending := g.PendingAssignments[sender.UserID]
+		if pending == 0 {
+			return gameError(ErrCodeNotAllowed, "you have no drinks to give out")
+		}
+		if request.TargetID == sender.UserID || g.GetPlayerInfoByID(request.TargetID) == nil {
+			log.Printf("%s tried to assign drinks to an invalid player %s\n", sender.Username, request.TargetID)
+			return gameError(ErrCodeInvalidTarget, "pick another player in the game")
+		}
+
+		amount := request.Amount
+		if amount <= 0 || amount > pending {
+			amount = pending
+		}
+
+		g.PendingAssignments[sender.UserID] -= amount
+		if g.PendingAssignments[sender.UserID] == 0 {
+			delete(g.PendingAssignments, sender.UserID)
+		}
+		g.DrinksAssigned[sender.UserID] += amount
+		g.Drinks.owe(request.TargetID, amount)
+
+		target := g.GetPlayerInfoByID(request.TargetID)
+		g.Message = fmt.Sprintf("%s gave %d drink(s) to %s", sender.Username, amount, target.Username)
+		g.broadcastGameState(s)
+
+	default:
+		log.Printf("Unknown game action type: %s from %s\n", request.Type, sender.Username)
+		return gameError(ErrCodeUnknownAction, "%q is not a Ride the Bus action", request.Type)
+	}
+	return nil
+}
+
+// handleRoundGuess deals the guessing player a card and moves the turn on. Caller must hold g.mu.
+func (g *RideTheBusLogic) handleRoundGuess(sender *Client, guess string) {
+	g.dealMissedCards(sender.UserID)
+	hand := g.Hands[sender.UserID]
+	card := g.drawCard()
+	correct := checkRideTheBusGuess(g.Round, hand, card, guess)
+
+	g.Hands[sender.UserID] = append(hand, card)
+	g.LastCard = &card
+	g.LastGuessCorrect = &correct
+
+	if correct {
+		g.Message = fmt.Sprintf("%s guessed right", sender.Username)
+	} else {
+		g.Drinks.owe(sender.UserID, 1)
+		g.Message = fmt.Sprintf("%s guessed wrong and drinks", sender.Username)
+	}
+
+	g.TurnIndex = nextTurnIndex(g.TurnIndex, g.Players)
+	if g.TurnIndex == 0 {
+		g.nextRound()
+	}
+}
+
+// nextRound starts the next round once everyone has guessed, or the pyramid after the last one.
+// Caller must hold g.mu.
+func (g *RideTheBusLogic) nextRound() {
+	g.TurnIndex = 0
+	g.Round++
+	if g.Round > rideTheBusRounds {
+		g.startPyramid()
+		return
+	}
+	if g.Message != "" {
+		g.Message += ". "
+	}
+	g.Message += roundPrompt(g.Round)
+}
+
+// dealMissedCards gives a player who joined late, or sat out a round, the cards for the rounds they missed,
+// so the round they guess in has the cards it compares against. Caller must hold g.mu.
+func (g *RideTheBusLogic) dealMissedCards(playerID string) {
+	for len(g.Hands[playerID]) < g.Round-1 {
+		g.Hands[playerID] = append(g.Hands[playerID], g.drawCard())
+	}
+}
+
+// handleBusGuess plays one step of the bus ride. A wrong guess costs a drink per step reached and starts over.
+// Caller must hold g.mu.
+func (g *RideTheBusLogic) handleBusGuess(sender *Client, guess string) {
+	step := len(g.BusCards) + 1
+	card := g.drawCard()
+	correct := checkRideTheBusGuess(step, g.BusCards, card, guess)
+
+	g.LastCard = &card
+	g.LastGuessCorrect = &correct
+
+	if !correct {
+		g.Drinks.owe(sender.UserID, step)
+		g.BusCards = nil
+		g.Message = fmt.Sprintf("Wrong! %s drinks %d and starts the bus again. %s", sender.Username, step, roundPrompt(1))
+		return
+	}
+
+	g.BusCards = append(g.BusCards, card)
+	if len(g.BusCards) == rideTheBusRounds {
+		g.Phase = "game_over"
+		g.Message = fmt.Sprintf("%s made it off the bus!", sender.Username)
+		return
+	}
+	g.Message = roundPrompt(len(g.BusCards) + 1)
+}
+
+// Caller must hold g.mu.
+func (g *RideTheBusLogic) startPyramid() {
+	g.Phase = "pyramid"
+	g.Pyramid = make([]utils.Card, 0, 10)
+	for _, size := range rideTheBusPyramidRows {
+		for i := 0; i < size; i++ {
+			g.Pyramid = append(g.Pyramid, g.drawCard())
+		}
+	}
+	g.PyramidFlipped = 0
+	g.PendingAssignments = make(map[string]int)
+	g.LastCard = nil
+	g.LastGuessCorrect = nil
+	g.Message = "The pyramid is ready. Host flips the cards"
+}
+
+// flipPyramidCard turns the next card over. Everyone holding the same rank plays those cards
+// and gets row-number drinks per card to hand out. Caller must hold g.mu.
+func (g *RideTheBusLogic) flipPyramidCard() {
+	card := g.Pyramid[g.PyramidFlipped]
+	row := pyramidRow(g.PyramidFlipped)
+	g.PyramidFlipped++
+
+	// Drinks nobody handed out before the next flip are forfeited
+	g.PendingAssignments = make(map[string]int)
+
+	matches := []string{}
+	for _, p := range g.Players {
+		kept := []utils.Card{}
+		for _, c := range g.Hands[p.ID] {
+			if c.Rank == card.Rank {
+				g.PendingAssignments[p.ID] += row
+			} else {
+				kept = append(kept, c)
+			}
+		}
+		if g.PendingAssignments[p.ID] > 0 {
+			matches = append(matches, p.Username)
+		}
+		g.Hands[p.ID] = kept
+	}
+
+	g.LastCard = &card
+	if len(matches) == 0 {
+		g.Message = fmt.Sprintf("Nobody has a %s", utils.GetRankName(card.Rank))
+	} else {
+		g.Message = fmt.Sprintf("%s can hand out drinks", strings.Join(matches, ", "))
+	}
+}
+
+// startBus puts the player left holding the most cards on the bus. Caller must hold g.mu.
+func (g *RideTheBusLogic) startBus() {
+	rider := g.Players[0]
+	for _, p := range g.Players[1:] {
+		if len(g.Hands[p.ID]) > len(g.Hands[rider.ID]) {
+			rider = p
+		}
+	}
+
+	g.Phase = "bus"
+	g.BusRiderID = rider.ID
+	g.BusCards = nil
+	g.PendingAssignments = make(map[string]int)
+	g.Deck = utils.NewShuffledDeck(g.rng)
+	g.LastCard = nil
+	g.LastGuessCorrect = nil
+	g.Message = fmt.Sprintf("%s is riding the bus! %s", rider.Username, roundPrompt(1))
+}
+
+// drawCard takes the top card, shuffling a new deck in if we ran out. Caller must hold g.mu.
+func (g *RideTheBusLogic) drawCard() utils.Card {
+	if len(g.Deck) == 0 {
+		g.Deck = utils.NewShuffledDeck(g.rng)
+	}
+	card := g.Deck[0]
+	g.Deck = g.Deck[1:]
+	return card
+}
+
+func pyramidRow(index int) int {
+	for row, size := range rideTheBusPyramidRows {
+		if index < size {
+			return row + 1
+		}
+		index -= size
+	}
+	return len(rideTheBusPyramidRows)
+}
+
+func roundPrompt(round int) string {
+	switch round {
+	case 1:
+		return "Red or black?"
+	case 2:
+		return "Higher or lower?"
+	case 3:
+		return "Inside or outside?"
+	case 4:
+		return "Guess the suit"
+	default:
+		return ""
+	}
+}
+
+// validRideTheBusGuess reports whether guess is one of the answers the round's question takes
+func validRideTheBusGuess(round int, guess string) bool {
+	guess = strings.ToLower(strings.TrimSpace(guess))
+	switch round {
+	case 1:
+		return guess == "red" || guess == "black"
+	case 2:
+		return guess == "higher" || guess == "lower"
+	case 3:
+		return guess == "inside" || guess == "outside"
+	case 4:
+		for _, suit := range []string{"H", "D", "C", "S"} {
+			if guess == strings.ToLower(suit) || guess == utils.GetSuitName(suit) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkRideTheBusGuess checks a guess for the given round against the cards already held.
+// Ties on higher/lower and inside/outside count as wrong.
+func checkRideTheBusGuess(round int, held []utils.Card, card utils.Card, guess string) bool {
+	guess = strings.ToLower(strings.TrimSpace(guess))
+	value := utils.GetRankValue(card.Rank)
+
+	switch round {
+	case 1:
+		return (guess == "red") == utils.IsRed(card.Suit) && (guess == "red" || guess == "black")
+	case 2:
+		if len(held) < 1 {
+			return false
+		}
+		first := utils.GetRankValue(held[0].Rank)
+		return (guess == "higher" && value > first) || (guess == "lower" && value < first)
+	case 3:
+		if len(held) < 2 {
+			return false
+		}
+		low, high := utils.GetRankValue(held[0].Rank), utils.GetRankValue(held[1].Rank)
+		if low > high {
+			low, high = high, low
+		}
+		return (guess == "inside" && value > low && value < high) || (guess == "outside" && (value < low || value > high))
+	case 4:
+		return guess == strings.ToLower(card.Suit) || guess == utils.GetSuitName(card.Suit)
+	default:
+		return false
+	}
+}
+
+func (g *RideTheBusLogic) GetPlayerInfoByID(playerID string) *PlayerInfo {
+	for _, p := range g.Players {
+		if p.ID == playerID {
+			return &p
+		}
+	}
+	return nil
+}
+
+// buildGameState snapshots the game for the client. Caller must hold g.mu.
+func (g *RideTheBusLogic) buildGameState() RideTheBusGameState {
+	hands := make(map[string][]ClientCard, len(g.Hands))
+	for id, cards := range g.Hands {
+		hands[id] = make([]ClientCard, 0, len(cards))
+		for _, c := range cards {
+			hands[id] = append(hands[id], *toClientCard(c, ""))
+		}
+	}
+
+	state := RideTheBusGameState{
+		Players:            g.Players,
+		Phase:              g.Phase,
+		Hands:              hands,
+		LastGuessCorrect:   g.LastGuessCorrect,
+		PendingAssignments: g.PendingAssignments,
+		BusRiderID:         g.BusRiderID,
+		Drinks:             g.Drinks.tally(),
+		DrinksAssigned:     g.DrinksAssigned,
+		CardsRemaining:     len(g.Deck),
+		Message:            g.Message,
+	}
+
+	if g.LastCard != nil {
+		state.LastCard = toClientCard(*g.LastCard, "")
+	}
+
+	switch g.Phase {
+	case "guessing":
+		state.Round = g.Round
+		state.CurrentPlayerTurnID = turnPlayerID(g.Players, g.TurnIndex)
+	case "pyramid":
+		state.Pyramid = make([]PyramidCard, len(g.Pyramid))
+		for i, c := range g.Pyramid {
+			state.Pyramid[i] = PyramidCard{Row: pyramidRow(i)}
+			if i < g.PyramidFlipped {
+				state.Pyramid[i].Card = toClientCard(c, fmt.Sprintf("Hand out %d drink(s) per match", pyramidRow(i)))
+			}
+		}
+	case "bus", "game_over":
+		state.CurrentPlayerTurnID = &g.BusRiderID
+		for _, c := range g.BusCards {
+			state.BusCards = append(state.BusCards, *toClientCard(c, ""))
+		}
+	}
+	return state
+}
+
+func (g *RideTheBusLogic) broadcastGameState(s *Session) {
+	broadcast(s, GameStatePayload{
+		Action:    "game_update",
+		GameState: g.buildGameState(),
+	})
+}
+
+// PlayersChanged deals newcomers in with the cards for the rounds already played and drops leavers
+// from the turn order. If the last player still to guess this round left, the next round starts.
+func (g *RideTheBusLogic) PlayersChanged(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.Phase == "game_over" {
+		return
+	}
+
+	current := turnPlayerID(g.Players, g.TurnIndex)
+	currentID := ""
+	if current != nil {
+		currentID = *current
+	}
+
+	g.Players = sortedPlayers(s)
+	present := make(map[string]bool)
+	for i, p := range g.Players {
+		present[p.ID] = true
+		if p.ID == currentID {
+			g.TurnIndex = i
+		}
+		if _, ok := g.Hands[p.ID]; !ok {
+			g.Hands[p.ID] = []utils.Card{}
+			g.DrinksAssigned[p.ID] = 0
+			if g.Phase == "guessing" {
+				g.dealMissedCards(p.ID)
+			}
+		}
+	}
+	for id := range g.Hands {
+		if !present[id] {
+			delete(g.Hands, id)
+			delete(g.PendingAssignments, id)
+		}
+	}
+
+	if len(g.Players) == 0 {
+		return
+	}
+	// Whoever left was the last one still to guess this round
+	if g.TurnIndex >= len(g.Players) {
+		g.TurnIndex = 0
+		if g.Phase == "guessing" {
+			g.Message = ""
+			g.nextRound()
+		}
+	}
+
+	if g.Phase == "bus" && !present[g.BusRiderID] {
+		g.Phase = "game_over"
+		g.Message = "The bus rider left the game"
+	}
+	g.broadcastGameState(s)
+}
+
+func (g *RideTheBusLogic) TakeDrinks(userID string, n int) (map[string]DrinkTally, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" || g.GetPlayerInfoByID(userID) == nil {
+		return nil, gameError(ErrCodeWrongPhase, "you're not in a game")
+	}
+	g.Drinks.take(userID, n)
+	return g.Drinks.tally(), nil
+}
+
+func (g *RideTheBusLogic) FinalTally(userID string) (DrinkTally, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase != "game_over" {
+		return DrinkTally{}, false
+	}
+	if t := g.Drinks[userID]; t != nil {
+		return *t, true
+	}
+	return DrinkTally{}, true
+}
+
+func (g *RideTheBusLogic) SyncState(s *Session, client *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.Phase == "" {
+		return
+	}
+
+	bytes, _ := json.Marshal(GameStatePayload{Action: "game_update", GameState: g.buildGameState()})
+	client.trySend(bytes)
+}
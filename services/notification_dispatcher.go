@@ -2,24 +2,40 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"outDrinkMeAPI/internal/types/notification"
+	"slices"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// PushNotificationProvider delivers a push to a user's devices and reports how it went on each platform.
+// It only returns an error when nothing could be delivered.
 type PushNotificationProvider interface {
-	SendPush(ctx context.Context, tokens []notification.DeviceToken, title, body string, data map[string]any) error
+	SendPush(ctx context.Context, tokens []notification.DeviceToken, msg notification.PushMessage) (notification.PushReport, error)
+}
+
+// EmailNotificationProvider emails a notification to its user, in the notification type's template
+type EmailNotificationProvider interface {
+	SendNotificationEmail(ctx context.Context, to notification.EmailRecipient, notif *notification.Notification) error
 }
 
 // NotificationDispatcher handles sending notifications through various channels
 type NotificationDispatcher struct {
-	service      *NotificationService
-	pushProvider PushNotificationProvider
-	workers      int
-	jobQueue     chan *DispatchJob
-	stopChan     chan struct{}
-	wg           sync.WaitGroup
+	service       *NotificationService
+	pushProvider  PushNotificationProvider
+	emailProvider EmailNotificationProvider
+	retry         RetryPolicy
+	workers       int
+	jobQueue      chan *DispatchJob
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
 }
 
 type DispatchJob struct {
@@ -30,6 +46,7 @@ type DispatchJob struct {
 func NewNotificationDispatcher(service *NotificationService) *NotificationDispatcher {
 	dispatcher := &NotificationDispatcher{
 		service:  service,
+		retry:    DefaultRetryPolicy,
 		workers:  5, // 5 workers is plenty for now
 		jobQueue: make(chan *DispatchJob, 100),
 		stopChan: make(chan struct{}),
@@ -40,6 +57,9 @@ func NewNotificationDispatcher(service *NotificationService) *NotificationDispat
 	// Start scheduled notification processor
 	go dispatcher.processScheduledNotifications()
 
+	// Start retrying failed notifications
+	go dispatcher.retryFailedNotifications()
+
 	// Start cleanup job
 	go dispatcher.cleanupExpiredNotifications()
 
@@ -51,6 +71,11 @@ func (d *NotificationDispatcher) SetPushProvider(provider PushNotificationProvid
 	d.pushProvider = provider
 }
 
+// Allow injecting the SMTP provider from main.go, without one no emails are sent
+func (d *NotificationDispatcher) SetEmailProvider(provider EmailNotificationProvider) {
+	d.emailProvider = provider
+}
+
 // Start worker pool
 func (d *NotificationDispatcher) startWorkers() {
 	for i := 0; i < d.workers; i++ {
@@ -78,25 +103,82 @@ func (d *NotificationDispatcher) processJob(job *DispatchJob) {
 	notif := job.Notification
 	prefs := job.Preferences
 
+	// The notification only fails if every channel we tried failed
+	var errs []error
+	delivered := false
+
 	// 1. Send Push (If enabled, has tokens, and provider exists)
 	if prefs.PushEnabled && len(prefs.DeviceTokens) > 0 && d.pushProvider != nil {
 		// This calls the code in internal/notification/fcm.go
-		err := d.pushProvider.SendPush(ctx, prefs.DeviceTokens, notif.Title, notif.Body, notif.Data)
+		report, err := d.pushProvider.SendPush(ctx, prefs.DeviceTokens, d.pushMessage(ctx, notif))
+		if report.Failed() > 0 {
+			log.Printf("Push for notification %s partly failed: %s", notif.ID, report)
+		}
 
 		if err != nil {
 			log.Printf("Push failed for user %s: %v", notif.UserID, err)
-			d.markAsFailed(ctx, notif.ID.String(), err)
-			return
+			errs = append(errs, fmt.Errorf("push: %w", err))
+		} else {
+			delivered = true
 		}
 	} else {
 		log.Printf("Skipping push: Enabled=%v, Tokens=%d, ProviderSet=%v",
 			prefs.PushEnabled, len(prefs.DeviceTokens), d.pushProvider != nil)
 	}
 
-	// 2. Mark as Sent in DB
+	// 2. Send Email (If enabled and provider exists)
+	if prefs.EmailEnabled && d.emailProvider != nil {
+		if err := d.sendEmail(ctx, notif); err != nil {
+			log.Printf("Email failed for user %s: %v", notif.UserID, err)
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		} else {
+			delivered = true
+		}
+	}
+
+	if !delivered && len(errs) > 0 {
+		d.markAsFailed(ctx, notif, errors.Join(errs...))
+		return
+	}
+
+	// 3. Mark as Sent in DB
 	d.markAsSent(ctx, notif.ID.String())
 }
 
+// sendEmail emails notif to the address on the user's account
+func (d *NotificationDispatcher) sendEmail(ctx context.Context, notif *notification.Notification) error {
+	to, err := d.service.emailRecipient(ctx, notif.UserID)
+	if err != nil {
+		return err
+	}
+	if to.Email == "" {
+		return fmt.Errorf("user has no email address")
+	}
+	return d.emailProvider.SendNotificationEmail(ctx, to, notif)
+}
+
+// pushMessage builds the push for notif. The badge is the user's unread count, which includes notif itself.
+func (d *NotificationDispatcher) pushMessage(ctx context.Context, notif *notification.Notification) notification.PushMessage {
+	msg := notification.PushMessage{
+		Title:    notif.Title,
+		Body:     notif.Body,
+		Data:     notif.Data,
+		Priority: notif.Priority,
+		ThreadID: string(notif.Type),
+	}
+	if notif.ActionURL != nil {
+		msg.Link = *notif.ActionURL
+	}
+
+	unread, err := d.service.unreadCount(ctx, notif.UserID)
+	if err != nil {
+		log.Printf("Sending push for notification %s without a badge: %v", notif.ID, err)
+	} else {
+		msg.Badge = &unread
+	}
+	return msg
+}
+
 // Dispatch a notification (add to queue)
 func (d *NotificationDispatcher) DispatchNotification(ctx context.Context, notif *notification.Notification, prefs *notification.NotificationPreferences) {
 	job := &DispatchJob{
@@ -109,46 +191,281 @@ func (d *NotificationDispatcher) DispatchNotification(ctx context.Context, notif
 		log.Printf("Notification %s queued for dispatch", notif.ID)
 	case <-time.After(5 * time.Second):
 		log.Printf("Failed to queue notification %s: queue full", notif.ID)
+		d.requeue(ctx, notif, "dispatch queue full")
 	}
 }
 
+// How often scheduled notifications are checked. Quiet hours end on the minute, so this keeps them close.
+const scheduledNotificationInterval = time.Minute
+
+// How long a notification taken from the database belongs to the dispatcher that took it. It's sent or
+// failed well within that, if it's still waiting afterwards its instance went down and another one takes it.
+const notificationLease = 5 * time.Minute
+
 // Process scheduled notifications (runs periodically)
 func (d *NotificationDispatcher) processScheduledNotifications() {
-	ticker := time.NewTicker(2 * time.Hour)
+	ticker := time.NewTicker(scheduledNotificationInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			d.processDueNotifications()
+			d.processDigests()
 		case <-d.stopChan:
 			return
 		}
 	}
 }
 
+// processDueNotifications dispatches pending notifications whose time has come, held back by quiet hours
+// or scheduled by the caller. Each batch is claimed with a notificationLease, so the next tick or another
+// instance doesn't send them again while they're still in the queue, but does if this instance goes down
+// before they're sent. They count against the rate limit like any other, so a night's worth held by quiet
+// hours doesn't all go out at once.
 func (d *NotificationDispatcher) processDueNotifications() {
 	ctx := context.Background()
 
+	const batchSize = 100
+	query := `
+		UPDATE notifications
+		SET claimed_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'pending'
+			  AND scheduled_for IS NOT NULL
+			  AND scheduled_for <= NOW()
+			  AND (claimed_at IS NULL OR claimed_at < NOW() - make_interval(secs => $2))
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			ORDER BY scheduled_for
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, type, priority, status, title, body, data,
+			   actor_id, scheduled_for, action_url, created_at, expires_at, retry_count
+	`
+
+	count := 0
+	for {
+		due, err := d.claimDue(ctx, query, batchSize, notificationLease.Seconds())
+		if err != nil {
+			log.Printf("Failed to fetch scheduled notifications: %v", err)
+			break
+		}
+
+		for _, notif := range due {
+			// Get user preferences
+			prefs, err := d.service.GetUserPreferencesByUUID(ctx, notif.UserID)
+			if err != nil {
+				log.Printf("Failed to get preferences for user %s: %v", notif.UserID, err)
+				d.markAsFailed(ctx, notif, err)
+				continue
+			}
+
+			if d.holdIfRateLimited(ctx, notif, prefs) {
+				continue
+			}
+			d.service.incrementRateLimit(ctx, notif.UserID)
+			d.DispatchNotification(ctx, notif, prefs)
+			count++
+		}
+
+		if len(due) < batchSize {
+			break
+		}
+	}
+
+	if count > 0 {
+		log.Printf("Processed %d scheduled notifications", count)
+	}
+}
+
+// holdIfRateLimited moves a due notification over to the next digest if the user is at their limit, the way
+// CreateNotification does. Its TTL moves along with it.
+func (d *NotificationDispatcher) holdIfRateLimited(ctx context.Context, notif *notification.Notification, prefs *notification.NotificationPreferences) bool {
+	reopens, limited := d.service.checkRateLimit(ctx, notif.UserID, prefs)
+	if !limited {
+		return false
+	}
+
+	return d.holdForDigest(ctx, []uuid.UUID{notif.ID}, reopens)
+}
+
+// holdForDigest puts notifications back to wait for a digest at the given time, moving their TTL along
+func (d *NotificationDispatcher) holdForDigest(ctx context.Context, ids []uuid.UUID, at time.Time) bool {
+	query := `
+		UPDATE notifications
+		SET digest_at = $2, expires_at = expires_at + ($2 - NOW()), scheduled_for = NULL, claimed_at = NULL
+		WHERE id = ANY($1)
+	`
+	if _, err := d.service.db.Exec(ctx, query, ids, at); err != nil {
+		log.Printf("Failed to hold %d notifications for a digest: %v", len(ids), err)
+		return false
+	}
+	return true
+}
+
+// processDigests sends the notifications the rate limit held back once the user's window reopens. Several of
+// one type go out as a single push, e.g. "Ivan and 4 others posted to the Mix", the rest stay in the in-app list.
+// They're claimed with a notificationLease like scheduled ones.
+func (d *NotificationDispatcher) processDigests() {
+	ctx := context.Background()
+
 	query := `
-		SELECT id, user_id, type, priority, status, title, body, data,
-			   actor_id, scheduled_for, action_url, created_at, expires_at
-		FROM notifications
-		WHERE status = 'pending'
-		  AND scheduled_for IS NOT NULL
-		  AND scheduled_for <= NOW()
-		  AND (expires_at IS NULL OR expires_at > NOW())
-		LIMIT 100
+		UPDATE notifications
+		SET claimed_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'pending'
+			  AND digest_at IS NOT NULL
+			  AND digest_at <= NOW()
+			  AND (claimed_at IS NULL OR claimed_at < NOW() - make_interval(secs => $1))
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, type, priority, status, title, body, data,
+			   actor_id, scheduled_for, action_url, created_at, expires_at, retry_count
 	`
 
-	rows, err := d.service.db.Query(ctx, query)
+	held, err := d.claimDue(ctx, query, notificationLease.Seconds())
 	if err != nil {
-		log.Printf("Failed to fetch scheduled notifications: %v", err)
+		log.Printf("Failed to fetch held notifications: %v", err)
 		return
 	}
+
+	// User -> type -> notifications
+	groups := make(map[uuid.UUID]map[notification.NotificationType][]*notification.Notification)
+	for _, notif := range held {
+		if groups[notif.UserID] == nil {
+			groups[notif.UserID] = make(map[notification.NotificationType][]*notification.Notification)
+		}
+		groups[notif.UserID][notif.Type] = append(groups[notif.UserID][notif.Type], notif)
+	}
+
+	digests := 0
+	for userID, byType := range groups {
+		prefs, err := d.service.GetUserPreferencesByUUID(ctx, userID)
+		if err != nil {
+			log.Printf("Failed to get preferences for user %s: %v", userID, err)
+			continue
+		}
+		digests += d.sendDigests(ctx, userID, byType, prefs)
+	}
+
+	if digests > 0 {
+		log.Printf("Sent %d notification digests", digests)
+	}
+}
+
+// sendDigests sends a user's digests, one per type, the type waiting longest first. Each one counts against the
+// rate limit, the types that don't fit wait for the next window. Quiet hours may have started since they were
+// held, then they wait for those to end, unless one of them is urgent.
+func (d *NotificationDispatcher) sendDigests(ctx context.Context, userID uuid.UUID, byType map[notification.NotificationType][]*notification.Notification, prefs *notification.NotificationPreferences) int {
+	types := make([]notification.NotificationType, 0, len(byType))
+	for notifType, notifs := range byType {
+		sort.Slice(notifs, func(i, j int) bool { return notifs[i].CreatedAt.Before(notifs[j].CreatedAt) })
+		types = append(types, notifType)
+	}
+	sort.Slice(types, func(i, j int) bool { return byType[types[i]][0].CreatedAt.Before(byType[types[j]][0].CreatedAt) })
+
+	quietUntil, quiet := prefs.QuietUntil(time.Now())
+
+	sent := 0
+	for i, notifType := range types {
+		notifs := byType[notifType]
+
+		urgent := slices.ContainsFunc(notifs, func(n *notification.Notification) bool { return n.Priority == notification.PriorityUrgent })
+		if quiet && !urgent {
+			d.holdForDigest(ctx, notificationIDs(notifs), quietUntil)
+			continue
+		}
+
+		if reopens, limited := d.service.checkRateLimit(ctx, userID, prefs); limited {
+			for _, waiting := range types[i:] {
+				d.holdForDigest(ctx, notificationIDs(byType[waiting]), reopens)
+			}
+			break
+		}
+
+		d.service.incrementRateLimit(ctx, userID)
+		if d.sendDigest(ctx, notifType, notifs, prefs) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// sendDigest dispatches notifs, oldest first, as one notification. The newest one carries the digest: its title
+// and body are replaced with the digest's, so a retry sends the digest again, and the others are marked sent
+// once it's delivered (see markAsSent).
+func (d *NotificationDispatcher) sendDigest(ctx context.Context, notifType notification.NotificationType, notifs []*notification.Notification, prefs *notification.NotificationPreferences) bool {
+	latest := notifs[len(notifs)-1]
+	if len(notifs) == 1 {
+		d.DispatchNotification(ctx, latest, prefs)
+		return true
+	}
+
+	actors := make([]string, 0, len(notifs))
+	for i := len(notifs) - 1; i >= 0; i-- {
+		if name, ok := notifs[i].Data["username"].(string); ok {
+			actors = append(actors, name)
+		}
+	}
+	others := notificationIDs(notifs[:len(notifs)-1])
+
+	digest := *latest
+	digest.Title = notification.DigestMessage(notifType, actors, len(notifs))
+	digest.Body = fmt.Sprintf("%d new notifications, tap to catch up", len(notifs))
+
+	tx, err := d.service.db.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to store digest %s: %v", latest.ID, err)
+		return false
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE notifications SET title = $2, body = $3, message = $3 WHERE id = $1`, latest.ID, digest.Title, digest.Body)
+	if err != nil {
+		log.Printf("Failed to store digest %s: %v", latest.ID, err)
+		return false
+	}
+	// A digest that was cut short and is in this one now hands over the notifications it carried
+	_, err = tx.Exec(ctx, `
+		UPDATE notifications
+		SET digest_id = $1, digest_at = NULL, claimed_at = NULL
+		WHERE id = ANY($2) OR digest_id = ANY($2)
+	`, latest.ID, others)
+	if err != nil {
+		log.Printf("Failed to attach notifications to digest %s: %v", latest.ID, err)
+		return false
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("Failed to store digest %s: %v", latest.ID, err)
+		return false
+	}
+
+	d.DispatchNotification(ctx, &digest, prefs)
+	return true
+}
+
+func notificationIDs(notifs []*notification.Notification) []uuid.UUID {
+	ids := make([]uuid.UUID, len(notifs))
+	for i, notif := range notifs {
+		ids[i] = notif.ID
+	}
+	return ids
+}
+
+// claimDue runs query and reads the notifications it returns. The rows are closed before anything
+// is dispatched, so a full job queue doesn't hold a connection.
+func (d *NotificationDispatcher) claimDue(ctx context.Context, query string, args ...any) ([]*notification.Notification, error) {
+	rows, err := d.service.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	count := 0
+	var due []*notification.Notification
 	for rows.Next() {
 		notif := &notification.Notification{}
 		var dataStr string
@@ -156,28 +473,18 @@ func (d *NotificationDispatcher) processDueNotifications() {
 		err := rows.Scan(
 			&notif.ID, &notif.UserID, &notif.Type, &notif.Priority, &notif.Status,
 			&notif.Title, &notif.Body, &dataStr, &notif.ActorID, &notif.ScheduledFor,
-			&notif.ActionURL, &notif.CreatedAt, &notif.ExpiresAt,
+			&notif.ActionURL, &notif.CreatedAt, &notif.ExpiresAt, &notif.RetryCount,
 		)
 		if err != nil {
 			log.Printf("Failed to scan scheduled notification: %v", err)
 			continue
 		}
-
-		// Get user preferences
-		prefs, err := d.service.GetUserPreferencesByUUID(ctx, notif.UserID)
-		if err != nil {
-			log.Printf("Failed to get preferences for user %s: %v", notif.UserID, err)
-			continue
+		if len(dataStr) > 0 {
+			_ = json.Unmarshal([]byte(dataStr), &notif.Data)
 		}
-
-		// Dispatch
-		d.DispatchNotification(ctx, notif, prefs)
-		count++
-	}
-
-	if count > 0 {
-		log.Printf("Processed %d scheduled notifications", count)
+		due = append(due, notif)
 	}
+	return due, rows.Err()
 }
 
 // Cleanup expired notifications (runs daily)
@@ -235,12 +542,12 @@ func (d *NotificationDispatcher) performCleanup() {
 	}
 }
 
-// Mark notification as sent
+// markAsSent marks the notification sent, along with any still pending that went out in it as a digest
 func (d *NotificationDispatcher) markAsSent(ctx context.Context, notificationID string) {
 	query := `
 		UPDATE notifications
-		SET status = 'sent', sent_at = NOW()
-		WHERE id = $1
+		SET status = 'sent', sent_at = NOW(), claimed_at = NULL, next_attempt_at = NULL
+		WHERE id = $1 OR (digest_id = $1 AND status = 'pending')
 	`
 
 	_, err := d.service.db.Exec(ctx, query, notificationID)
@@ -249,34 +556,44 @@ func (d *NotificationDispatcher) markAsSent(ctx context.Context, notificationID
 	}
 }
 
-// Replace the existing markAsFailed function with this updated version
-func (d *NotificationDispatcher) markAsFailed(ctx context.Context, notificationID string, err error) {
-	// Fix: We now take a single 'error' instead of '[]error'
-	failureReason := err.Error()
+// markAsFailed records the failure and, if the retry policy allows another attempt, when it's due.
+// retryFailedNotifications picks it up from there.
+func (d *NotificationDispatcher) markAsFailed(ctx context.Context, notif *notification.Notification, err error) {
+	failures := notif.RetryCount + 1
+	failedAt := time.Now()
+
+	var nextAttempt *time.Time
+	if next, ok := d.retry.NextAttempt(notif.Priority, failures, failedAt); ok {
+		nextAttempt = &next
+	}
 
 	query := `
 		UPDATE notifications
-		SET status = 'failed', failed_at = NOW(), failure_reason = $2, retry_count = retry_count + 1
+		SET status = 'failed', failed_at = $3, failure_reason = $2, retry_count = $4, next_attempt_at = $5, claimed_at = NULL
 		WHERE id = $1
 	`
-
-	_, dbErr := d.service.db.Exec(ctx, query, notificationID, failureReason)
+	_, dbErr := d.service.db.Exec(ctx, query, notif.ID, err.Error(), failedAt, failures, nextAttempt)
 	if dbErr != nil {
-		log.Printf("Failed to mark notification %s as failed: %v", notificationID, dbErr)
+		log.Printf("Failed to mark notification %s as failed: %v", notif.ID, dbErr)
+		return
 	}
 
-	// Schedule retry for high/urgent priority notifications (max 3 retries)
-	var retryCount int
-	var priority notification.NotificationPriority
-	// Note: Ensure you are using the correct package for NotificationPriority
-	// It might be 'notification.PriorityHigh' depending on your imports
-	d.service.db.QueryRow(ctx, "SELECT retry_count, priority FROM notifications WHERE id = $1", notificationID).Scan(&retryCount, &priority)
+	if nextAttempt == nil {
+		log.Printf("Notification %s failed for good after %d attempts: %v", notif.ID, failures, err)
+		return
+	}
+	log.Printf("Scheduled retry %d for notification %s at %s", failures, notif.ID, nextAttempt.Format(time.RFC3339))
+}
 
-	if retryCount < 3 && (priority == notification.PriorityHigh || priority == notification.PriorityUrgent) {
-		// Schedule retry in 5 minutes
-		retryTime := time.Now().Add(5 * time.Minute)
-		d.service.db.Exec(ctx, "UPDATE notifications SET scheduled_for = $2, status = 'pending' WHERE id = $1", notificationID, retryTime)
-		log.Printf("Scheduled retry for notification %s at %s", notificationID, retryTime)
+// requeue hands a notification that was never tried to the retry loop's next tick. It doesn't use up an attempt.
+func (d *NotificationDispatcher) requeue(ctx context.Context, notif *notification.Notification, reason string) {
+	query := `
+		UPDATE notifications
+		SET status = 'failed', failure_reason = $2, next_attempt_at = NOW(), claimed_at = NULL
+		WHERE id = $1
+	`
+	if _, err := d.service.db.Exec(ctx, query, notif.ID, reason); err != nil {
+		log.Printf("Failed to requeue notification %s: %v", notif.ID, err)
 	}
 }
 
@@ -292,16 +609,20 @@ func (d *NotificationDispatcher) Stop() {
 
 type MockPushProvider struct{}
 
-func (m *MockPushProvider) SendPush(ctx context.Context, tokens []notification.DeviceToken, title, body string, data map[string]any) error {
-	log.Printf("MOCK PUSH: Sending to %d devices: %s - %s", len(tokens), title, body)
+func (m *MockPushProvider) SendPush(ctx context.Context, tokens []notification.DeviceToken, msg notification.PushMessage) (notification.PushReport, error) {
+	log.Printf("MOCK PUSH: Sending to %d devices: %s - %s", len(tokens), msg.Title, msg.Body)
 	// In production, integrate with FCM, APNs, etc.
-	return nil
+	report := notification.PushReport{}
+	for _, t := range tokens {
+		report.Add(t.Platform, nil)
+	}
+	return report, nil
 }
 
 type MockEmailProvider struct{}
 
-func (m *MockEmailProvider) SendEmail(ctx context.Context, to, subject, body string) error {
-	log.Printf("MOCK EMAIL: To %s, Subject: %s", to, subject)
+func (m *MockEmailProvider) SendNotificationEmail(ctx context.Context, to notification.EmailRecipient, notif *notification.Notification) error {
+	log.Printf("MOCK EMAIL: To %s, Subject: %s", to.Email, notif.Title)
 	// In production, integrate with SendGrid, AWS SES, etc.
 	return nil
 }
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"outDrinkMeAPI/internal/types/notification"
+	"time"
+)
+
+// RetryPolicy decides if and when a failed notification is tried again. The wait doubles after every
+// failure, from BaseDelay up to MaxDelay, and is spread by Jitter so a provider outage doesn't end in
+// every retry landing at once.
+type RetryPolicy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64                                   // the wait moves by up to this fraction either way, 0.2 is ±20%
+	MaxAttempts map[notification.NotificationPriority]int // deliveries tried in all, priorities left out get one
+	Rand        func() float64                            // in [0, 1), nil uses math/rand
+}
+
+// DefaultRetryPolicy tries urgent notifications for about an hour and low priority ones once more
+var DefaultRetryPolicy = RetryPolicy{
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  30 * time.Minute,
+	Jitter:    0.2,
+	MaxAttempts: map[notification.NotificationPriority]int{
+		notification.PriorityLow:    2,
+		notification.PriorityMedium: 3,
+		notification.PriorityHigh:   5,
+		notification.PriorityUrgent: 8,
+	},
+}
+
+// How often failed notifications are checked for a retry that's due
+const retryInterval = 15 * time.Second
+
+// NextAttempt is when a notification that has failed failures times, the last at failedAt, should be tried
+// again. ok is false once it's out of attempts.
+func (p RetryPolicy) NextAttempt(priority notification.NotificationPriority, failures int, failedAt time.Time) (time.Time, bool) {
+	maxAttempts := p.MaxAttempts[priority]
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	if failures < 1 || failures >= maxAttempts {
+		return time.Time{}, false
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		random := rand.Float64
+		if p.Rand != nil {
+			random = p.Rand
+		}
+		delay += time.Duration(float64(delay) * p.Jitter * (2*random() - 1))
+	}
+	return failedAt.Add(delay), true
+}
+
+// SetRetryPolicy replaces DefaultRetryPolicy. Call before serving.
+func (s *NotificationService) SetRetryPolicy(policy RetryPolicy) {
+	s.dispatcher.retry = policy
+}
+
+// retryFailedNotifications re-queues failed notifications whose next attempt is due (runs periodically)
+func (d *NotificationDispatcher) retryFailedNotifications() {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.processRetries()
+		case <-d.stopChan:
+			return
+		}
+	}
+}
+
+// processRetries claims due retries with a notificationLease, so no other tick or instance sends them too
+// unless this one goes down first. They stay failed until the attempt marks them sent or failed again.
+// Notifications past expires_at are left failed.
+func (d *NotificationDispatcher) processRetries() {
+	ctx := context.Background()
+
+	query := `
+		UPDATE notifications
+		SET claimed_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE status = 'failed'
+			  AND next_attempt_at IS NOT NULL
+			  AND next_attempt_at <= NOW()
+			  AND (claimed_at IS NULL OR claimed_at < NOW() - make_interval(secs => $1))
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			ORDER BY next_attempt_at
+			LIMIT 100
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, type, priority, status, title, body, data,
+			   actor_id, scheduled_for, action_url, created_at, expires_at, retry_count
+	`
+
+	due, err := d.claimDue(ctx, query, notificationLease.Seconds())
+	if err != nil {
+		log.Printf("Failed to fetch notifications to retry: %v", err)
+		return
+	}
+
+	for _, notif := range due {
+		prefs, err := d.service.GetUserPreferencesByUUID(ctx, notif.UserID)
+		if err != nil {
+			log.Printf("Failed to get preferences for user %s: %v", notif.UserID, err)
+			d.markAsFailed(ctx, notif, err)
+			continue
+		}
+
+		log.Printf("Retrying notification %s, attempt %d", notif.ID, notif.RetryCount+1)
+		d.DispatchNotification(ctx, notif, prefs)
+	}
+}
@@ -62,16 +62,7 @@ func (s *NotificationService) CreateNotification(ctx context.Context, req *notif
 
 	expiresAt := time.Now().Add(time.Duration(template.TTLHours) * time.Hour)
 
-	// 3. Check Rate Limits
-	canSend, err := s.checkRateLimit(ctx, req.UserID)
-	if err != nil {
-		return nil, err
-	}
-	if !canSend {
-		return nil, fmt.Errorf("rate limit exceeded")
-	}
-
-	// 4. Get Preferences
+	// 3. Get Preferences
 	prefs, err := s.GetUserPreferencesByUUID(ctx, req.UserID)
 	if err != nil {
 		prefs, err = s.createDefaultPreferences(ctx, req.UserID)
@@ -80,20 +71,45 @@ func (s *NotificationService) CreateNotification(ctx context.Context, req *notif
 		}
 	}
 
-	// 5. Check if specific type is disabled by user
+	// 4. Check if specific type is disabled by user
 	if enabled, exists := prefs.EnabledTypes[string(req.Type)]; exists && !enabled {
 		return nil, nil // Silently skip
 	}
 
-	// 6. Insert Notification
+	// 5. Hold it until the user's quiet hours are over, urgent ones go out anyway.
+	// The TTL then counts from when it's delivered, not from now.
+	scheduledFor := req.ScheduledFor
+	if priority != notification.PriorityUrgent {
+		sendAt := time.Now()
+		if scheduledFor != nil {
+			sendAt = *scheduledFor
+		}
+		if until, quiet := prefs.QuietUntil(sendAt); quiet {
+			scheduledFor = &until
+			expiresAt = until.Add(time.Duration(template.TTLHours) * time.Hour)
+		}
+	}
+
+	// 6. Check Rate Limits. Over the hourly or daily limit it isn't dropped, it waits for the window
+	// to reopen and goes out in a digest with the others held back (see processDigests). Scheduled ones
+	// are checked when they're due instead.
+	var digestAt *time.Time
+	if scheduledFor == nil {
+		if reopens, limited := s.checkRateLimit(ctx, req.UserID, prefs); limited {
+			digestAt = &reopens
+			expiresAt = reopens.Add(time.Duration(template.TTLHours) * time.Hour)
+		}
+	}
+
+	// 7. Insert Notification
 	dataJSON, _ := json.Marshal(req.Data)
 
 	// FIXED: Added 'retry_count' to fields and '0' to values
 	query := `
 		INSERT INTO notifications (
 			user_id, type, priority, status, title, body, message, data, 
-			actor_id, scheduled_for, action_url, expires_at, retry_count
-		) VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9, $10, $11, 0)
+			actor_id, scheduled_for, action_url, expires_at, retry_count, digest_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8, $9, $10, $11, 0, $12)
 		RETURNING id, user_id, type, priority, status, title, body, data, 
 				  actor_id, scheduled_for, sent_at, read_at, failed_at, 
 				  failure_reason, retry_count, action_url, created_at, expires_at
@@ -105,8 +121,8 @@ func (s *NotificationService) CreateNotification(ctx context.Context, req *notif
 	err = s.db.QueryRow(
 		ctx, query,
 		req.UserID, req.Type, priority, notification.StatusPending,
-		title, body, dataJSON, req.ActorID, req.ScheduledFor,
-		req.ActionURL, expiresAt,
+		title, body, dataJSON, req.ActorID, scheduledFor,
+		req.ActionURL, expiresAt, digestAt,
 	).Scan(
 		&notif.ID, &notif.UserID, &notif.Type, &notif.Priority, &notif.Status,
 		&notif.Title, &notif.Body, &dataStr, &notif.ActorID, &notif.ScheduledFor,
@@ -122,11 +138,10 @@ func (s *NotificationService) CreateNotification(ctx context.Context, req *notif
 		_ = json.Unmarshal([]byte(dataStr), &notif.Data)
 	}
 
-	// 7. Update Rate Limit Counter
-	s.incrementRateLimit(ctx, req.UserID)
-
-	// 8. Dispatch
-	if req.ScheduledFor == nil {
+	// 8. Dispatch and count it against the limits. Scheduled ones are picked up by processDueNotifications,
+	// rate limited ones by processDigests.
+	if scheduledFor == nil && digestAt == nil {
+		s.incrementRateLimit(ctx, req.UserID)
 		go s.dispatcher.DispatchNotification(context.Background(), notif, prefs)
 	}
 
@@ -139,6 +154,10 @@ func (s *NotificationService) SetPushProvider(provider PushNotificationProvider)
 	s.dispatcher.SetPushProvider(provider)
 }
 
+func (s *NotificationService) SetEmailProvider(provider EmailNotificationProvider) {
+	s.dispatcher.SetEmailProvider(provider)
+}
+
 func (s *NotificationService) GetNotifications(ctx context.Context, clerkID string, page, pageSize int, unreadOnly bool) (*notification.NotificationListResponse, error) {
 	userID, err := s.getUserID(ctx, clerkID)
 	if err != nil {
@@ -208,9 +227,22 @@ func (s *NotificationService) GetUnreadCount(ctx context.Context, clerkID string
 		return 0, err
 	}
 
+	return s.unreadCount(ctx, userID)
+}
+
+func (s *NotificationService) emailRecipient(ctx context.Context, userID uuid.UUID) (notification.EmailRecipient, error) {
+	var to notification.EmailRecipient
+	err := s.db.QueryRow(ctx, "SELECT COALESCE(email, ''), username FROM users WHERE id = $1", userID).Scan(&to.Email, &to.Username)
+	if err != nil {
+		return to, fmt.Errorf("failed to get email for user %s: %w", userID, err)
+	}
+	return to, nil
+}
+
+func (s *NotificationService) unreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
 	var unreadCount int
 	query := "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
-	err = s.db.QueryRow(ctx, query, userID).Scan(&unreadCount)
+	err := s.db.QueryRow(ctx, query, userID).Scan(&unreadCount)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get unread count: %w", err)
 	}
@@ -480,25 +512,28 @@ func (s *NotificationService) createDefaultPreferences(ctx context.Context, user
 	return s.GetUserPreferencesByUUID(ctx, userID)
 }
 
-func (s *NotificationService) checkRateLimit(ctx context.Context, userID uuid.UUID) (bool, error) {
-	prefs, err := s.GetUserPreferencesByUUID(ctx, userID)
-	if err != nil {
-		return true, nil // Allow if preferences not found (fail open)
-	}
+// checkRateLimit reports whether the user is at MaxNotificationsPerHour or MaxNotificationsPerDay, and when
+// they'll have room again. The day is the user's own and is counted from the hourly windows it's made of.
+func (s *NotificationService) checkRateLimit(ctx context.Context, userID uuid.UUID, prefs *notification.NotificationPreferences) (time.Time, bool) {
+	now := time.Now()
+	hourStart := now.Truncate(time.Hour)
+	// Windows start on the UTC hour, in a half hour timezone the one across midnight counts towards the next day
+	dayStart, dayEnd := prefs.Day(now)
 
-	hourStart := time.Now().Truncate(time.Hour)
-	var hourCount int
+	var hourCount, dayCount int
 	query := `
-		SELECT COALESCE(notification_count, 0)
+		SELECT COALESCE(SUM(notification_count) FILTER (WHERE window_start = $2), 0),
+			   COALESCE(SUM(notification_count), 0)
 		FROM notification_rate_limits
-		WHERE user_id = $1 AND window_start = $2
+		WHERE user_id = $1 AND window_start >= $3 AND window_start < $4
 	`
-	s.db.QueryRow(ctx, query, userID, hourStart).Scan(&hourCount)
-
-	if hourCount >= prefs.MaxNotificationsPerHour {
-		return false, nil
+	err := s.db.QueryRow(ctx, query, userID, hourStart, dayStart, dayEnd).Scan(&hourCount, &dayCount)
+	if err != nil {
+		log.Printf("Failed to check rate limit for user %s: %v", userID, err)
+		return time.Time{}, false // fail open
 	}
-	return true, nil
+
+	return prefs.RateLimited(now, hourCount, dayCount)
 }
 
 func (s *NotificationService) incrementRateLimit(ctx context.Context, userID uuid.UUID) {
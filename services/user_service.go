@@ -843,6 +843,37 @@ func (s *UserService) AddDrinking(
 	return nil
 }
 
+// LogGameDrinks adds the drinks a player had in a drinking game to their daily_drinking entry for date,
+// logging the day as a drinking day if they hadn't yet. An entry that's already there keeps its photo,
+// location and buddies.
+func (s *UserService) LogGameDrinks(ctx context.Context, clerkID string, drinks int, date time.Time) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT id FROM users WHERE clerk_id = $1`, clerkID).Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO daily_drinking (user_id, date, drank_today, logged_at, game_drinks)
+        VALUES ($1, $2, TRUE, NOW(), $3)
+        ON CONFLICT (user_id, date)
+        DO UPDATE SET
+            drank_today = TRUE,
+            game_drinks = daily_drinking.game_drinks + EXCLUDED.game_drinks
+    `, userID, date, drinks)
+	if err != nil {
+		return fmt.Errorf("failed to log game drinks: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (s *UserService) GetMemoryWall(ctx context.Context, postIDStr string) ([]canvas.CanvasItem, error) {
 	postID, err := uuid.Parse(postIDStr)
 	if err != nil {
@@ -1457,7 +1488,7 @@ func (s *UserService) GetCalendar(ctx context.Context, clerkID string, year int,
 
 	// 3. Query using the determined targetUserID
 	query := `
-	SELECT date, drank_today
+	SELECT date, drank_today, game_drinks
 	FROM daily_drinking
 	WHERE user_id = $1
 		AND date >= $2
@@ -1473,13 +1504,16 @@ func (s *UserService) GetCalendar(ctx context.Context, clerkID string, year int,
 
 	// 4. Map Results
 	dayMap := make(map[string]bool)
+	gameDrinks := make(map[string]int)
 	for rows.Next() {
 		var date time.Time
 		var drank bool
-		if err := rows.Scan(&date, &drank); err != nil {
+		var drinks int
+		if err := rows.Scan(&date, &drank, &drinks); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 		dayMap[date.Format("2006-01-02")] = drank
+		gameDrinks[date.Format("2006-01-02")] = drinks
 	}
 
 	// 5. Build Calendar Response
@@ -1491,6 +1525,7 @@ func (s *UserService) GetCalendar(ctx context.Context, clerkID string, year int,
 		day := &calendar.CalendarDay{
 			Date:       d,
 			DrankToday: dayMap[dateStr],
+			GameDrinks: gameDrinks[dateStr],
 			IsToday:    dateStr == today,
 		}
 		days = append(days, day)
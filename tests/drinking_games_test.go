@@ -0,0 +1,2500 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"outDrinkMeAPI/internal/bots"
+	drinkinggame "outDrinkMeAPI/internal/types/drinking_game"
+	"outDrinkMeAPI/middleware"
+	"outDrinkMeAPI/services"
+	"outDrinkMeAPI/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Fake clock ---
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+	fn    func()
+	done  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) services.Timer {
+	return c.add(d, nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) services.Timer {
+	return c.add(d, f)
+}
+
+func (c *fakeClock) add(d time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1), fn: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves time forward and fires every timer that came due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	var due, pending []*fakeTimer
+	for _, t := range c.timers {
+		switch {
+		case t.done:
+		case !t.when.After(now):
+			t.done = true
+			due = append(due, t)
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	for _, t := range due {
+		if t.fn != nil {
+			go t.fn()
+		} else {
+			t.c <- now
+		}
+	}
+}
+
+// pending counts the timers that haven't fired or been stopped
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if !t.done {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.done
+	t.done = true
+	return active
+}
+
+// --- In-memory clients ---
+
+type gameMessage struct {
+	Action    string                         `json:"action"`
+	Content   string                         `json:"content"`
+	Channel   string                         `json:"channel"`
+	UserID    string                         `json:"userId"`
+	Messages  []services.ChatMessage         `json:"messages"` // chat_history
+	Tally     map[string]services.DrinkTally `json:"tally"`    // drink_tally
+	GameState json.RawMessage                `json:"gameState"`
+}
+
+type testClient struct {
+	*services.Client
+	msgs chan gameMessage
+}
+
+// pump drains Send like WritePump would, so the session never drops a slow test client
+func (c *testClient) pump(send chan []byte) {
+	for data := range send {
+		var msg gameMessage
+		if err := json.Unmarshal(data, &msg); err == nil {
+			c.msgs <- msg
+		}
+	}
+}
+
+func (c *testClient) waitFor(t *testing.T, what string, match func(gameMessage) bool) gameMessage {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-c.msgs:
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("%s never got %s", c.Username, what)
+			return gameMessage{}
+		}
+	}
+}
+
+// quiet checks nothing matching shows up for a little while
+func (c *testClient) quiet(t *testing.T, what string, match func(gameMessage) bool) {
+	t.Helper()
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case msg := <-c.msgs:
+			if match(msg) {
+				t.Fatalf("%s got unexpected %s", c.Username, what)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+type resultSink struct {
+	results chan *drinkinggame.GameResult
+}
+
+func (r *resultSink) RecordResult(ctx context.Context, result *drinkinggame.GameResult) error {
+	r.results <- result
+	return nil
+}
+
+func (r *resultSink) wait(t *testing.T) *drinkinggame.GameResult {
+	t.Helper()
+	select {
+	case result := <-r.results:
+		return result
+	case <-time.After(2 * time.Second):
+		t.Fatal("game result was never recorded")
+		return nil
+	}
+}
+
+type testGame struct {
+	session *services.Session
+	clock   *fakeClock
+	results *resultSink
+	clients []*testClient
+	byID    map[string]*testClient
+}
+
+// newTestGame runs a seeded session with players p1..pN on a fake clock
+func newTestGame(t *testing.T, gameType, hostID string, seed int64, names ...string) *testGame {
+	t.Helper()
+
+	manager := services.NewDrinnkingGameManager()
+	sink := &resultSink{results: make(chan *drinkinggame.GameResult, 4)}
+	manager.SetResultRecorder(sink)
+
+	session := services.NewSession("test-"+gameType, gameType, hostID, "host", services.NewSessionSettings(true, "", 0), manager)
+	session.Rand = services.NewRand(seed)
+	clock := newFakeClock()
+	session.Clock = clock
+	go session.Run()
+
+	g := &testGame{session: session, clock: clock, results: sink, byID: make(map[string]*testClient)}
+	for i, name := range names {
+		g.join(t, fmt.Sprintf("p%d", i+1), name, false)
+	}
+	g.settle(t)
+	return g
+}
+
+func (g *testGame) join(t *testing.T, id, name string, spectator bool) *testClient {
+	client := services.NewClient(g.session, nil, id, name)
+	client.IsSpectator = spectator
+	tc := &testClient{Client: client, msgs: make(chan gameMessage, 4096)}
+	go tc.pump(client.Send)
+
+	g.session.Register <- client
+	g.clients = append(g.clients, tc)
+	g.byID[id] = tc
+	return tc
+}
+
+// settle waits until Run has handled every join, so client fields are safe to read
+func (g *testGame) settle(t *testing.T) {
+	t.Helper()
+	g.session.TriggerList <- true
+	for _, c := range g.clients {
+		c.waitFor(t, "the player list", func(m gameMessage) bool { return m.Action == "update_player_list" })
+	}
+}
+
+func (g *testGame) act(c *testClient, payload string) {
+	g.session.GameEngine.HandleMessage(g.session, c.Client, []byte(payload))
+}
+
+func decode[T any](t *testing.T, m gameMessage) T {
+	t.Helper()
+	var state T
+	if err := json.Unmarshal(m.GameState, &state); err != nil {
+		t.Fatalf("bad game state %s: %v", m.GameState, err)
+	}
+	return state
+}
+
+func participant(t *testing.T, result *drinkinggame.GameResult, userID string) drinkinggame.Participant {
+	t.Helper()
+	for _, p := range result.Participants {
+		if p.UserID == userID {
+			return p
+		}
+	}
+	t.Fatalf("%s missing from the game result", userID)
+	return drinkinggame.Participant{}
+}
+
+// --- Kings Cup ---
+
+func TestKingsCupFullGame(t *testing.T) {
+	const seed = 7
+	g := newTestGame(t, "kings-cup", "p1", seed, "Ana", "Bob", "Cem")
+	host := g.byID["p1"]
+
+	g.session.GameEngine.InitState(g.session)
+
+	isKingsCup := func(m gameMessage) bool { return m.Action == "game_update" }
+	state := decode[services.KingsCupGameState](t, host.waitFor(t, "the opening deal", func(m gameMessage) bool {
+		return isKingsCup(m) && decode[services.KingsCupGameState](t, m).GameStarted
+	}))
+
+	// The same seed has to deal the same deck
+	expected := utils.NewShuffledDeck(services.NewRand(seed))
+	drawn := 0
+	turns := map[string]int{}
+
+	for !state.GameOver {
+		if state.CurrentPlayerTurnID == nil {
+			t.Fatal("no one's turn mid game")
+		}
+		turn := *state.CurrentPlayerTurnID
+		turns[turn]++
+		drawer := g.byID[turn]
+
+		g.act(drawer, `{"type":"draw_card"}`)
+		drawn++
+
+		afterDraw := decode[services.KingsCupGameState](t, host.waitFor(t, "the drawn card", func(m gameMessage) bool {
+			return isKingsCup(m) && decode[services.KingsCupGameState](t, m).CardsRemaining == 52-drawn
+		}))
+		card := afterDraw.CurrentCard
+		want := expected[drawn-1]
+		if card == nil || card.Value != want.Rank || card.Suit != utils.GetSuitName(want.Suit) {
+			t.Fatalf("draw %d: got %+v, want %+v", drawn, card, want)
+		}
+
+		switch card.Value {
+		case "8":
+			buddy := "p1"
+			if turn == "p1" {
+				buddy = "p2"
+			}
+			g.act(drawer, fmt.Sprintf(`{"type":"choose_buddy","chosen_buddie_id":%q}`, buddy))
+		case "K":
+			g.act(drawer, `{"type":"set_rule","new_rule":"No first names"}`)
+		}
+
+		state = decode[services.KingsCupGameState](t, host.waitFor(t, "the next turn", func(m gameMessage) bool {
+			st := decode[services.KingsCupGameState](t, m)
+			return isKingsCup(m) && st.CardsRemaining == 52-drawn && st.CurrentPlayerTurnID != nil && *st.CurrentPlayerTurnID != turn
+		}))
+	}
+
+	if drawn != 52 {
+		t.Fatalf("game ended after %d cards", drawn)
+	}
+	if state.KingsInCup != 4 || state.KingCupDrinker == nil {
+		t.Fatalf("expected 4 kings and a King's Cup drinker, got %d / %v", state.KingsInCup, state.KingCupDrinker)
+	}
+	for _, id := range []string{"p1", "p2", "p3"} {
+		if turns[id] < 17 {
+			t.Errorf("%s only drew %d times, turns aren't rotating", id, turns[id])
+		}
+	}
+
+	result := g.results.wait(t)
+	total, kings := 0, 0
+	for _, p := range result.Participants {
+		total += p.Stats["cards_drawn"]
+		kings += p.Stats["kings_drawn"]
+		if p.Won {
+			t.Errorf("Kings Cup has no winner, %s was marked as one", p.UserID)
+		}
+	}
+	if total != 52 || kings != 4 {
+		t.Fatalf("result counts %d cards and %d kings", total, kings)
+	}
+	if participant(t, result, state.KingCupDrinker.ID).Stats["kings_cup"] != 1 {
+		t.Error("King's Cup drinker not marked in the result")
+	}
+}
+
+func TestKingsCupTurnTimer(t *testing.T) {
+	const seed = 7
+	g := newTestGame(t, "kings-cup", "p1", seed, "Ana", "Bob", "Cem")
+	engine := g.session.GameEngine
+	host := g.byID["p1"]
+
+	expectCode(t, engine.HandleMessage(g.session, g.byID["p2"].Client, []byte(`{"type":"set_turn_timer","seconds":20}`)), services.ErrCodeNotAllowed)
+	expectCode(t, engine.HandleMessage(g.session, host.Client, []byte(`{"type":"set_turn_timer","seconds":5}`)), services.ErrCodeBadRequest)
+	if err := engine.HandleMessage(g.session, host.Client, []byte(`{"type":"set_turn_timer","seconds":20}`)); err != nil {
+		t.Fatalf("setting the timer: %v", err)
+	}
+
+	engine.InitState(g.session)
+	state := decode[services.KingsCupGameState](t, host.waitFor(t, "the opening deal", func(m gameMessage) bool {
+		return decode[services.KingsCupGameState](t, m).GameStarted
+	}))
+	if state.TurnSeconds != 20 || state.TimeRemaining != 20 {
+		t.Fatalf("got %ds turns with %ds left, want 20 and 20", state.TurnSeconds, state.TimeRemaining)
+	}
+
+	g.clock.Advance(19 * time.Second)
+	host.quiet(t, "a card before the time ran out", func(m gameMessage) bool {
+		return decode[services.KingsCupGameState](t, m).CardsRemaining < 52
+	})
+
+	// Nobody touches their phone: every turn plays itself, 8s and Kings included
+	expected := utils.NewShuffledDeck(services.NewRand(seed))
+	buddies, kings := 0, 0
+	wait := time.Second // the first turn already used 19 of its 20 seconds
+	for drawn := 1; drawn <= 52 && (buddies == 0 || kings == 0); drawn++ {
+		turn := *state.CurrentPlayerTurnID
+		rank := expected[drawn-1].Rank
+
+		g.clock.Advance(wait)
+		wait = 20 * time.Second
+		state = decode[services.KingsCupGameState](t, host.waitFor(t, fmt.Sprintf("auto draw %d", drawn), func(m gameMessage) bool {
+			st := decode[services.KingsCupGameState](t, m)
+			if st.CardsRemaining != 52-drawn {
+				return false
+			}
+			if rank == "8" || rank == "K" {
+				return st.CurrentCard != nil
+			}
+			return *st.CurrentPlayerTurnID != turn
+		}))
+		if !strings.Contains(state.Notice, "ran out of time") {
+			t.Fatalf("draw %d: notice %q", drawn, state.Notice)
+		}
+		if rank != "8" && rank != "K" {
+			continue
+		}
+
+		// Picking a buddy or a rule gets a fresh clock, then times out too
+		if state.TimeRemaining != 20 || *state.CurrentPlayerTurnID != turn {
+			t.Fatalf("%s: %s should have 20s to finish it, got %ds for %v", rank, turn, state.TimeRemaining, *state.CurrentPlayerTurnID)
+		}
+		g.clock.Advance(20 * time.Second)
+		state = decode[services.KingsCupGameState](t, host.waitFor(t, "the "+rank+" to time out", func(m gameMessage) bool {
+			st := decode[services.KingsCupGameState](t, m)
+			return st.CurrentCard == nil && *st.CurrentPlayerTurnID != turn
+		}))
+		if rank == "8" {
+			buddies++
+			if len(state.Buddies[turn]) == 0 || !strings.Contains(state.Notice, "is their buddy") {
+				t.Fatalf("%s timed out on an 8 without a random buddy: %+v, %q", turn, state.Buddies, state.Notice)
+			}
+		} else {
+			kings++
+			if len(state.CustomRules[turn]) != 0 {
+				t.Fatalf("%s timed out on a King but a rule was set", turn)
+			}
+		}
+	}
+	if buddies == 0 || kings == 0 {
+		t.Fatalf("the deck never dealt an 8 and a King")
+	}
+}
+
+func TestKingsCupSkipsDroppedDrawer(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	session := manager.CreateSession(context.Background(), "dropped-drawer", "kings-cup", "a", "a", services.NewSessionSettings(true, "", 0))
+	players := map[string]*wsPlayer{}
+	for _, id := range []string{"a", "b", "c"} {
+		players[id] = dialGame(t, manager, session.ID, id, false)
+	}
+
+	kingsCup := func(m map[string]interface{}) services.KingsCupGameState {
+		var st services.KingsCupGameState
+		raw, _ := json.Marshal(m["gameState"])
+		json.Unmarshal(raw, &st)
+		return st
+	}
+	turnIs := func(id string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool {
+			st := kingsCup(m)
+			return m["action"] == "game_update" && st.CurrentPlayerTurnID != nil && *st.CurrentPlayerTurnID == id
+		}
+	}
+
+	players["a"].send(t, `{"action":"start_game"}`)
+	players["b"].waitFor(t, "a's first turn", turnIs("a"))
+
+	// a drops mid turn, the table shouldn't have to wait out the grace period
+	players["a"].conn.Close()
+	state := kingsCup(players["b"].waitFor(t, "the turn to pass to b", turnIs("b")))
+	if !strings.Contains(state.Notice, "dropped out") {
+		t.Errorf("notice %q should say a dropped out", state.Notice)
+	}
+
+	// From here on a is skipped until they come back
+	for i, turn := range []string{"b", "c", "b", "c"} {
+		next := map[string]string{"b": "c", "c": "b"}[turn]
+		p := players[turn]
+		p.send(t, `{"action":"game_action","type":"draw_card"}`)
+		drawn := kingsCup(p.waitFor(t, turn+"'s card", func(m map[string]interface{}) bool {
+			return m["action"] == "game_update" && kingsCup(m).CardsRemaining == 51-i
+		}))
+		switch drawn.CurrentCard.Value {
+		case "8":
+			p.send(t, `{"action":"game_action","type":"choose_buddy","chosen_buddie_id":"`+next+`"}`)
+		case "K":
+			p.send(t, `{"action":"game_action","type":"set_rule","new_rule":"Left hand only"}`)
+		}
+		p.waitFor(t, next+"'s turn after "+turn, turnIs(next))
+	}
+}
+
+// --- BurnBook ---
+
+func TestBurnBookFullGame(t *testing.T) {
+	g := newTestGame(t, "burn-book", "p1", 1, "Ana", "Bob", "Cem")
+	p1, p2, p3 := g.byID["p1"], g.byID["p2"], g.byID["p3"]
+
+	g.session.GameEngine.InitState(g.session)
+	for _, q := range []string{"Most likely to text an ex?", "Worst dancer?", "First to fall asleep?"} {
+		g.act(p1, fmt.Sprintf(`{"type":"submit_question","payload":%q}`, q))
+	}
+	g.act(p1, `{"type":"start_voting"}`)
+
+	votingOn := func(n int) func(gameMessage) bool {
+		return func(m gameMessage) bool {
+			st := decode[services.BurnBookGameState](t, m)
+			return m.Action == "game_update" && st.Phase == "voting" && st.CurrentNumber == n
+		}
+	}
+
+	// Question 1: everyone votes, so it moves on without waiting for the timer. Nobody can vote for themselves.
+	p1.waitFor(t, "question 1", votingOn(1))
+	expectCode(t, g.session.GameEngine.HandleMessage(g.session, p2.Client, []byte(`{"type":"vote_player","targetId":"p2"}`)), services.ErrCodeInvalidTarget)
+	g.act(p1, `{"type":"vote_player","targetId":"p2"}`)
+	g.act(p2, `{"type":"vote_player","targetId":"p1"}`)
+	g.act(p3, `{"type":"vote_player","targetId":"p2"}`)
+	p1.waitFor(t, "question 2 after everyone voted", votingOn(2))
+
+	// Question 2: nobody votes, the timer moves it on
+	g.clock.Advance(29 * time.Second)
+	p1.quiet(t, "question 3 before the time ran out", votingOn(3))
+	g.clock.Advance(time.Second)
+	p1.waitFor(t, "question 3 after the timer", votingOn(3))
+
+	// Question 3
+	g.act(p1, `{"type":"vote_player","targetId":"p2"}`)
+	g.act(p2, `{"type":"vote_player","targetId":"p3"}`)
+	g.act(p3, `{"type":"vote_player","targetId":"p2"}`)
+	p1.waitFor(t, "the results screen", func(m gameMessage) bool {
+		return decode[services.BurnBookGameState](t, m).Phase == "results_wait"
+	})
+
+	wantWinners := []string{"p2", "", "p2"}
+	for i, want := range wantWinners {
+		g.act(p1, `{"type":"next_reveal"}`)
+		state := decode[services.BurnBookGameState](t, p1.waitFor(t, fmt.Sprintf("reveal %d", i+1), func(m gameMessage) bool {
+			return decode[services.BurnBookGameState](t, m).Phase == "results"
+		}))
+		if state.RoundResults == nil || state.RoundResults.WinnerID != want {
+			t.Fatalf("reveal %d: got %+v, want winner %q", i+1, state.RoundResults, want)
+		}
+	}
+	g.act(p1, `{"type":"next_reveal"}`)
+	p1.waitFor(t, "game over", func(m gameMessage) bool {
+		return decode[services.BurnBookGameState](t, m).Phase == "game_over"
+	})
+
+	result := g.results.wait(t)
+	if got := participant(t, result, "p2"); !got.Won || got.Stats["votes_received"] != 4 {
+		t.Errorf("p2 should win with 4 votes, got %+v", got)
+	}
+	if got := participant(t, result, "p3"); got.Won || got.Stats["votes_received"] != 1 {
+		t.Errorf("p3 should lose with 1 vote, got %+v", got)
+	}
+	if got := participant(t, result, "p1"); got.Stats["votes_cast"] != 2 {
+		t.Errorf("p1 voted twice, got %+v", got)
+	}
+}
+
+func TestBurnBookHostOnlyActions(t *testing.T) {
+	g := newTestGame(t, "burn-book", "p1", 1, "Ana", "Bob")
+	p2 := g.byID["p2"]
+
+	g.session.GameEngine.InitState(g.session)
+	g.act(p2, `{"type":"submit_question","payload":"Who owes everyone money?"}`)
+	g.act(p2, `{"type":"start_voting"}`)
+
+	p2.quiet(t, "voting started by a non-host", func(m gameMessage) bool {
+		return decode[services.BurnBookGameState](t, m).Phase == "voting"
+	})
+}
+
+// fakePacks serves question packs from memory
+type fakePacks struct {
+	packs     map[string]drinkinggame.QuestionPack
+	questions map[string][]string
+	premium   map[string]bool // clerk IDs with premium
+}
+
+func (f *fakePacks) LoadPack(ctx context.Context, packID, hostID string) (*drinkinggame.QuestionPack, []string, error) {
+	pack, ok := f.packs[packID]
+	if !ok || !pack.IsActive {
+		return nil, nil, services.ErrPackNotFound
+	}
+	if pack.IsPremium && !f.premium[hostID] {
+		return &pack, nil, services.ErrPackPremiumOnly
+	}
+	return &pack, f.questions[packID], nil
+}
+
+func newFakePacks() *fakePacks {
+	f := &fakePacks{
+		packs: map[string]drinkinggame.QuestionPack{
+			"spicy":    {ID: "spicy", Name: "Spicy", IsActive: true},
+			"vip":      {ID: "vip", Name: "VIP", IsActive: true, IsPremium: true},
+			"retired":  {ID: "retired", Name: "Retired", IsActive: false},
+			"two-only": {ID: "two-only", Name: "Two", IsActive: true},
+		},
+		questions: map[string][]string{
+			"two-only": {"Two A?", "Two B?"},
+			"vip":      {"VIP A?"},
+		},
+		premium: map[string]bool{},
+	}
+	for i := 1; i <= 15; i++ {
+		f.questions["spicy"] = append(f.questions["spicy"], fmt.Sprintf("Spicy %d?", i))
+	}
+	return f
+}
+
+func TestBurnBookQuestionPacks(t *testing.T) {
+	g := newTestGame(t, "burn-book", "p1", 1, "Ana", "Bob")
+	p1, p2 := g.byID["p1"], g.byID["p2"]
+	engine := g.session.GameEngine
+	packs := newFakePacks()
+	g.session.Manager.SetQuestionPacks(packs)
+
+	engine.InitState(g.session)
+
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"vip"}`)), services.ErrCodeNotAllowed)
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"retired"}`)), services.ErrCodeInvalidTarget)
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"nope"}`)), services.ErrCodeInvalidTarget)
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"remove_pack","packId":"spicy"}`)), services.ErrCodeInvalidTarget)
+
+	for _, pack := range []string{"spicy", "two-only"} {
+		if err := engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"`+pack+`"}`)); err != nil {
+			t.Fatalf("adding %s: %v", pack, err)
+		}
+	}
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"spicy"}`)), services.ErrCodeBadRequest)
+
+	state := decode[services.BurnBookGameState](t, p2.waitFor(t, "both packs", func(m gameMessage) bool {
+		return len(decode[services.BurnBookGameState](t, m).Packs) == 2
+	}))
+	if state.Phase != "collecting" || state.Packs[0].ID != "spicy" || state.Packs[1].ID != "two-only" {
+		t.Fatalf("got %+v, want spicy and two-only picked", state)
+	}
+
+	// Premium hosts get premium packs
+	packs.premium["p1"] = true
+	if err := engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"vip"}`)); err != nil {
+		t.Fatalf("premium host adding vip: %v", err)
+	}
+	if err := engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"remove_pack","packId":"vip"}`)); err != nil {
+		t.Fatalf("removing vip: %v", err)
+	}
+
+	g.act(p2, `{"type":"submit_question","payload":"Who still owes me a drink?"}`)
+	g.act(p1, `{"type":"start_voting"}`)
+
+	state = decode[services.BurnBookGameState](t, p1.waitFor(t, "voting", func(m gameMessage) bool {
+		return decode[services.BurnBookGameState](t, m).Phase == "voting"
+	}))
+	// Ten from spicy, both from two-only, and the one Bob wrote
+	if state.TotalQuestions != 13 {
+		t.Fatalf("got %d questions, want 13", state.TotalQuestions)
+	}
+
+	questions := engine.(*services.BurnBookLogic).Questions
+	seen := map[string]bool{}
+	spicy := 0
+	for _, q := range questions {
+		if seen[q] {
+			t.Errorf("%q asked twice", q)
+		}
+		seen[q] = true
+		if strings.HasPrefix(q, "Spicy") {
+			spicy++
+		}
+	}
+	if spicy != 10 || !seen["Two A?"] || !seen["Two B?"] || !seen["Who still owes me a drink?"] || seen["VIP A?"] {
+		t.Errorf("questions weren't mixed right: %q", questions)
+	}
+
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"add_pack","packId":"spicy"}`)), services.ErrCodeWrongPhase)
+}
+
+func TestBurnBookPacksNeedASource(t *testing.T) {
+	g := newTestGame(t, "burn-book", "p1", 1, "Ana", "Bob")
+	engine := g.session.GameEngine
+
+	engine.InitState(g.session)
+	expectCode(t, engine.HandleMessage(g.session, g.byID["p1"].Client, []byte(`{"type":"add_pack","packId":"spicy"}`)), services.ErrCodeNotAllowed)
+	expectCode(t, engine.HandleMessage(g.session, g.byID["p1"].Client, []byte(`{"type":"start_voting"}`)), services.ErrCodeWrongPhase)
+}
+
+// --- Never Have I Ever ---
+
+func nhieState(t *testing.T, c *testClient, what string, match func(services.NeverHaveIEverGameState) bool) services.NeverHaveIEverGameState {
+	t.Helper()
+	return decode[services.NeverHaveIEverGameState](t, c.waitFor(t, what, func(m gameMessage) bool {
+		return m.Action == "game_update" && match(decode[services.NeverHaveIEverGameState](t, m))
+	}))
+}
+
+func TestNeverHaveIEverPacks(t *testing.T) {
+	g := newTestGame(t, "never-have-i-ever", "p1", 1, "Ana", "Bob")
+	engine := g.session.GameEngine
+	host, p2 := g.byID["p1"], g.byID["p2"]
+
+	expectCode(t, engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"answer","answer":"have"}`)), services.ErrCodeWrongPhase)
+
+	engine.InitState(g.session)
+	state := nhieState(t, host, "the first prompt", func(st services.NeverHaveIEverGameState) bool { return st.Phase == "answering" })
+	if state.Pack != "classic" || state.CurrentNumber != 1 || state.Prompt == "" {
+		t.Fatalf("should start on the classic pack, got %+v", state)
+	}
+	if len(state.Packs) < 2 {
+		t.Fatalf("packs on offer %v", state.Packs)
+	}
+
+	expectCode(t, engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"select_pack","pack":"party"}`)), services.ErrCodeNotAllowed)
+	expectCode(t, engine.HandleMessage(g.session, host.Client, []byte(`{"type":"select_pack","pack":"nope"}`)), services.ErrCodeBadRequest)
+
+	// Picking a pack starts it over, answers and all
+	if err := engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"answer","answer":"have"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.HandleMessage(g.session, host.Client, []byte(`{"type":"select_pack","pack":"party"}`)); err != nil {
+		t.Fatal(err)
+	}
+	state = nhieState(t, host, "the party pack", func(st services.NeverHaveIEverGameState) bool { return st.Pack == "party" })
+	if state.CurrentNumber != 1 || len(state.Answered) != 0 || !strings.Contains(state.Prompt, "Never have I ever") {
+		t.Fatalf("party pack didn't start over: %+v", state)
+	}
+}
+
+func TestNeverHaveIEverAnswersAndReveal(t *testing.T) {
+	g := newTestGame(t, "never-have-i-ever", "p1", 1, "Ana", "Bob", "Cem")
+	engine := g.session.GameEngine
+	p1, p2, p3 := g.byID["p1"], g.byID["p2"], g.byID["p3"]
+	answer := func(c *testClient, a string) error {
+		return engine.HandleMessage(g.session, c.Client, []byte(fmt.Sprintf(`{"type":"answer","answer":%q}`, a)))
+	}
+
+	engine.InitState(g.session)
+	nhieState(t, p1, "the first prompt", func(st services.NeverHaveIEverGameState) bool { return st.Phase == "answering" })
+
+	expectCode(t, answer(p1, "maybe"), services.ErrCodeBadRequest)
+	if err := answer(p1, "have"); err != nil {
+		t.Fatal(err)
+	}
+	expectCode(t, answer(p1, "havent"), services.ErrCodeNotAllowed)
+	if err := answer(p2, "havent"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everyone sees who answered, but not what
+	state := nhieState(t, p3, "two answers", func(st services.NeverHaveIEverGameState) bool { return len(st.Answered) == 2 })
+	if state.Phase != "answering" || state.Round != nil {
+		t.Fatalf("revealed before everyone answered: %+v", state)
+	}
+	expectCode(t, engine.HandleMessage(g.session, p1.Client, []byte(`{"type":"next_prompt"}`)), services.ErrCodeWrongPhase)
+
+	// The last answer reveals the round, everyone who has drinks
+	if err := answer(p3, "have"); err != nil {
+		t.Fatal(err)
+	}
+	state = nhieState(t, p1, "the reveal", func(st services.NeverHaveIEverGameState) bool { return st.Phase == "reveal" })
+	have := []string{}
+	for _, p := range state.Round.Have {
+		have = append(have, p.ID)
+	}
+	if strings.Join(have, ",") != "p1,p3" || len(state.Round.HaveNot) != 1 || state.Round.HaveNot[0].ID != "p2" {
+		t.Fatalf("round %+v", state.Round)
+	}
+	if state.Drinks["p1"].Owed != 1 || state.Drinks["p2"].Owed != 0 || state.Drinks["p3"].Owed != 1 {
+		t.Fatalf("tally %v", state.Drinks)
+	}
+	expectCode(t, answer(p2, "have"), services.ErrCodeWrongPhase)
+	expectCode(t, engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"next_prompt"}`)), services.ErrCodeNotAllowed)
+}
+
+func TestNeverHaveIEverPlaysToTheEnd(t *testing.T) {
+	g := newTestGame(t, "never-have-i-ever", "p1", 1, "Ana", "Bob")
+	engine := g.session.GameEngine
+	host, p2 := g.byID["p1"], g.byID["p2"]
+
+	engine.InitState(g.session)
+	state := nhieState(t, host, "the first prompt", func(st services.NeverHaveIEverGameState) bool { return st.Phase == "answering" })
+	total := state.TotalPrompts
+
+	expectCode(t, engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"reveal"}`)), services.ErrCodeNotAllowed)
+
+	seen := map[string]bool{}
+	for n := 1; n <= total; n++ {
+		if state.CurrentNumber != n || seen[state.Prompt] {
+			t.Fatalf("prompt %d: got number %d, %q", n, state.CurrentNumber, state.Prompt)
+		}
+		seen[state.Prompt] = true
+
+		// Only p2 answers, the host reveals without waiting for themselves
+		if err := engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"answer","answer":"have"}`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.HandleMessage(g.session, host.Client, []byte(`{"type":"reveal"}`)); err != nil {
+			t.Fatal(err)
+		}
+		nhieState(t, host, fmt.Sprintf("reveal %d", n), func(st services.NeverHaveIEverGameState) bool {
+			return st.Phase == "reveal" && st.Drinks["p2"].Owed == n
+		})
+
+		if err := engine.HandleMessage(g.session, host.Client, []byte(`{"type":"next_prompt"}`)); err != nil {
+			t.Fatal(err)
+		}
+		state = nhieState(t, host, fmt.Sprintf("prompt %d", n+1), func(st services.NeverHaveIEverGameState) bool {
+			return st.Phase == "game_over" || (st.Phase == "answering" && st.CurrentNumber == n+1)
+		})
+	}
+
+	if state.Phase != "game_over" || state.Drinks["p2"].Owed != total || state.Drinks["p1"].Owed != 0 {
+		t.Fatalf("after %d prompts: %+v", total, state)
+	}
+	expectCode(t, engine.HandleMessage(g.session, p2.Client, []byte(`{"type":"answer","answer":"have"}`)), services.ErrCodeWrongPhase)
+	expectCode(t, engine.HandleMessage(g.session, host.Client, []byte(`{"type":"reveal"}`)), services.ErrCodeWrongPhase)
+
+	// p2 drinks some of what they owe and logs it
+	sink := &drinkSink{logged: make(map[string]int), days: make(map[string]time.Time)}
+	g.session.Manager.SetDrinkLogger(sink)
+	if err := g.session.TakeDrinks(p2.Client, 2); err != nil {
+		t.Fatal(err)
+	}
+	if tally := host.waitFor(t, "the tally", isTally).Tally; tally["p2"] != (services.DrinkTally{Owed: total - 2, Taken: 2}) {
+		t.Fatalf("tally %+v", tally)
+	}
+	if err := g.session.LogDrinks(p2.Client, "1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := sink.drinks("p2"); got != 2 {
+		t.Fatalf("logged %d drinks, want 2", got)
+	}
+	expectCode(t, g.session.LogDrinks(host.Client, "2", ""), services.ErrCodeBadRequest)
+}
+
+// --- Ride the Bus ---
+
+func rtbState(t *testing.T, c *testClient, what string, match func(services.RideTheBusGameState) bool) services.RideTheBusGameState {
+	t.Helper()
+	return decode[services.RideTheBusGameState](t, c.waitFor(t, what, func(m gameMessage) bool {
+		return m.Action == "game_update" && match(decode[services.RideTheBusGameState](t, m))
+	}))
+}
+
+// rightGuess is the answer that wins a round, ok is false on a tie nothing wins
+func rightGuess(round int, held []utils.Card, card utils.Card) (guess string, ok bool) {
+	value := utils.GetRankValue(card.Rank)
+	switch round {
+	case 1:
+		if utils.IsRed(card.Suit) {
+			return "red", true
+		}
+		return "black", true
+	case 2:
+		first := utils.GetRankValue(held[0].Rank)
+		return map[bool]string{true: "higher", false: "lower"}[value > first], value != first
+	case 3:
+		low, high := utils.GetRankValue(held[0].Rank), utils.GetRankValue(held[1].Rank)
+		if low > high {
+			low, high = high, low
+		}
+		return map[bool]string{true: "inside", false: "outside"}[value > low && value < high], value != low && value != high
+	default:
+		return utils.GetSuitName(card.Suit), true
+	}
+}
+
+func TestRideTheBusRejectsBadGuesses(t *testing.T) {
+	g := newTestGame(t, "ride-the-bus", "p1", 3, "Ana", "Bob")
+	engine := g.session.GameEngine
+	p1, p2 := g.byID["p1"], g.byID["p2"]
+	guess := func(c *testClient, guess string) error {
+		return engine.HandleMessage(g.session, c.Client, []byte(fmt.Sprintf(`{"type":"guess","guess":%q}`, guess)))
+	}
+
+	engine.InitState(g.session)
+	rtbState(t, p1, "the first round", func(st services.RideTheBusGameState) bool { return st.Round == 1 })
+
+	// Nonsense and the wrong round's answers neither deal a card nor cost a drink
+	expectCode(t, guess(p1, "purple"), services.ErrCodeBadRequest)
+	expectCode(t, guess(p1, "higher"), services.ErrCodeBadRequest)
+	expectCode(t, guess(p2, "red"), services.ErrCodeNotYourTurn)
+	if err := guess(p1, " Red "); err != nil {
+		t.Fatal(err)
+	}
+	state := rtbState(t, p1, "p1's card", func(st services.RideTheBusGameState) bool { return st.CardsRemaining == 51 })
+	if *state.CurrentPlayerTurnID != "p2" || len(state.Hands["p1"]) != 1 {
+		t.Fatalf("after p1's guess: %+v", state)
+	}
+
+	if err := guess(p2, "black"); err != nil {
+		t.Fatal(err)
+	}
+	rtbState(t, p1, "round 2", func(st services.RideTheBusGameState) bool { return st.Round == 2 })
+	expectCode(t, guess(p1, "red"), services.ErrCodeBadRequest)
+	expectCode(t, guess(p1, "spades"), services.ErrCodeBadRequest)
+}
+
+func TestRideTheBusFullGame(t *testing.T) {
+	const seed = 3
+	g := newTestGame(t, "ride-the-bus", "p1", seed, "Ana", "Bob")
+	engine := g.session.GameEngine
+	host := g.byID["p1"]
+	act := func(c *testClient, payload string) {
+		t.Helper()
+		if err := engine.HandleMessage(g.session, c.Client, []byte(payload)); err != nil {
+			t.Fatalf("%s: %v", payload, err)
+		}
+	}
+
+	// The bus gets a fresh deck from the same RNG
+	rng := services.NewRand(seed)
+	deck := utils.NewShuffledDeck(rng)
+	busDeck := utils.NewShuffledDeck(rng)
+
+	engine.InitState(g.session)
+	state := rtbState(t, host, "the first round", func(st services.RideTheBusGameState) bool { return st.Round == 1 })
+
+	hands := map[string][]utils.Card{}
+	drinks := map[string]int{}
+	dealt := 0
+	for round := 1; round <= 4; round++ {
+		for _, id := range []string{"p1", "p2"} {
+			if *state.CurrentPlayerTurnID != id {
+				t.Fatalf("round %d: %s's turn, want %s", round, *state.CurrentPlayerTurnID, id)
+			}
+			card := deck[dealt]
+			guess, ok := rightGuess(round, hands[id], card)
+			act(g.byID[id], fmt.Sprintf(`{"type":"guess","guess":%q}`, guess))
+			dealt++
+			hands[id] = append(hands[id], card)
+			if !ok {
+				drinks[id]++
+			}
+
+			// The last guess lays out the pyramid straight away
+			state = rtbState(t, host, fmt.Sprintf("card %d", dealt), func(st services.RideTheBusGameState) bool {
+				return st.CardsRemaining == 52-dealt || st.Phase == "pyramid"
+			})
+			if state.Drinks[id].Owed != drinks[id] || (state.Phase == "guessing" && *state.LastGuessCorrect != ok) {
+				t.Fatalf("round %d, %s guessed %s on %+v: drinks %d, state %+v", round, id, guess, card, state.Drinks[id].Owed, state)
+			}
+		}
+	}
+	if state.Phase != "pyramid" || len(state.Hands["p1"]) != 4 || len(state.Hands["p2"]) != 4 {
+		t.Fatalf("after 4 rounds: %+v", state)
+	}
+
+	// Each pyramid card lets whoever holds its rank hand out row-number drinks per card
+	pyramid := deck[dealt : dealt+10]
+	for i, card := range pyramid {
+		row := []int{1, 1, 1, 1, 2, 2, 2, 3, 3, 4}[i]
+		act(host, `{"type":"flip_card"}`)
+		state = rtbState(t, host, fmt.Sprintf("flip %d", i+1), func(st services.RideTheBusGameState) bool {
+			return st.Phase == "pyramid" && st.Pyramid[i].Card != nil
+		})
+
+		for _, id := range []string{"p1", "p2"} {
+			owed := 0
+			kept := hands[id][:0]
+			for _, c := range hands[id] {
+				if c.Rank == card.Rank {
+					owed += row
+				} else {
+					kept = append(kept, c)
+				}
+			}
+			hands[id] = kept
+			if state.PendingAssignments[id] != owed {
+				t.Fatalf("flip %d (%s): %s can hand out %d, want %d", i+1, card.Rank, id, state.PendingAssignments[id], owed)
+			}
+			if owed == 0 {
+				continue
+			}
+			other := map[string]string{"p1": "p2", "p2": "p1"}[id]
+			expectCode(t, engine.HandleMessage(g.session, g.byID[id].Client, []byte(fmt.Sprintf(`{"type":"assign_drinks","targetId":%q}`, id))), services.ErrCodeInvalidTarget)
+			act(g.byID[id], fmt.Sprintf(`{"type":"assign_drinks","targetId":%q}`, other))
+			drinks[other] += owed
+			state = rtbState(t, host, "the drinks handed out", func(st services.RideTheBusGameState) bool {
+				return st.Drinks[other].Owed == drinks[other]
+			})
+		}
+	}
+
+	// Whoever is left holding the most cards rides the bus, ties go to the first player
+	rider := "p1"
+	if len(hands["p2"]) > len(hands["p1"]) {
+		rider = "p2"
+	}
+	act(host, `{"type":"flip_card"}`)
+	state = rtbState(t, host, "the bus", func(st services.RideTheBusGameState) bool { return st.Phase == "bus" })
+	if state.BusRiderID != rider {
+		t.Fatalf("%s is on the bus, want %s", state.BusRiderID, rider)
+	}
+	expectCode(t, engine.HandleMessage(g.session, g.byID[map[string]string{"p1": "p2", "p2": "p1"}[rider]].Client, []byte(`{"type":"guess","guess":"red"}`)), services.ErrCodeNotYourTurn)
+
+	// A wrong first guess costs a drink and starts the ride over, then the rider gets off
+	var busCards []utils.Card
+	drawn := 0
+	first := busDeck[drawn]
+	wrong := map[bool]string{true: "black", false: "red"}[utils.IsRed(first.Suit)]
+	act(g.byID[rider], fmt.Sprintf(`{"type":"guess","guess":%q}`, wrong))
+	drawn++
+	drinks[rider]++
+	state = rtbState(t, host, "the wrong bus guess", func(st services.RideTheBusGameState) bool { return st.Drinks[rider].Owed == drinks[rider] })
+	if len(state.BusCards) != 0 {
+		t.Fatalf("bus cards after a wrong guess: %v", state.BusCards)
+	}
+
+	for state.Phase == "bus" {
+		if drawn >= len(busDeck) {
+			t.Fatal("the bus never ended")
+		}
+		card := busDeck[drawn]
+		step := len(busCards) + 1
+		guess, ok := rightGuess(step, busCards, card)
+		act(g.byID[rider], fmt.Sprintf(`{"type":"guess","guess":%q}`, guess))
+		drawn++
+		if ok {
+			busCards = append(busCards, card)
+		} else {
+			busCards = nil
+			drinks[rider] += step
+		}
+		state = rtbState(t, host, fmt.Sprintf("bus card %d", drawn), func(st services.RideTheBusGameState) bool {
+			return st.CardsRemaining == 52-drawn
+		})
+		if state.Drinks[rider].Owed != drinks[rider] || len(state.BusCards) != len(busCards) {
+			t.Fatalf("bus card %d: drinks %d, %d cards, want %d and %d", drawn, state.Drinks[rider].Owed, len(state.BusCards), drinks[rider], len(busCards))
+		}
+	}
+	if state.Phase != "game_over" || len(busCards) != 4 {
+		t.Fatalf("ended in %s with %d bus cards", state.Phase, len(busCards))
+	}
+
+	// Drinking pays off what the game handed out
+	if err := g.session.TakeDrinks(g.byID[rider].Client, 1); err != nil {
+		t.Fatal(err)
+	}
+	tally := host.waitFor(t, "the tally", isTally).Tally
+	if tally[rider] != (services.DrinkTally{Owed: max(drinks[rider]-1, 0), Taken: 1}) {
+		t.Fatalf("tally %+v, %s owed %d", tally, rider, drinks[rider])
+	}
+}
+
+func TestRideTheBusPlayersComingAndGoing(t *testing.T) {
+	g := newTestGame(t, "ride-the-bus", "p1", 3, "Ana", "Bob", "Cem")
+	engine := g.session.GameEngine
+	p1 := g.byID["p1"]
+	guess := func(c *testClient, guess string) {
+		t.Helper()
+		if err := engine.HandleMessage(g.session, c.Client, []byte(fmt.Sprintf(`{"type":"guess","guess":%q}`, guess))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine.InitState(g.session)
+	rtbState(t, p1, "the first round", func(st services.RideTheBusGameState) bool { return st.Round == 1 })
+	guess(p1, "red")
+	guess(g.byID["p2"], "red")
+	rtbState(t, p1, "p3's turn", func(st services.RideTheBusGameState) bool {
+		return st.CurrentPlayerTurnID != nil && *st.CurrentPlayerTurnID == "p3"
+	})
+
+	// The last player to guess leaves, the round is over rather than starting again
+	g.session.Moderation <- &services.ModerationRequest{Sender: p1.Client, Action: "kick_player", TargetID: "p3"}
+	state := rtbState(t, p1, "round 2", func(st services.RideTheBusGameState) bool { return st.Round == 2 })
+	if *state.CurrentPlayerTurnID != "p1" || len(state.Hands["p1"]) != 1 || len(state.Hands["p2"]) != 1 {
+		t.Fatalf("after p3 left: %+v", state)
+	}
+
+	// Someone joining in round 2 gets the round 1 card they missed, so their guesses can be right
+	late := g.join(t, "p4", "Dan", false)
+	g.session.TriggerList <- true
+	late.waitFor(t, "the player list", func(m gameMessage) bool { return m.Action == "update_player_list" })
+	state = rtbState(t, p1, "p4 dealt in", func(st services.RideTheBusGameState) bool { return len(st.Hands["p4"]) == 1 })
+	if state.Round != 2 {
+		t.Fatalf("joining moved the round to %d", state.Round)
+	}
+}
+
+// --- Mafia ---
+
+type mafiaGame struct {
+	*testGame
+	byRole map[string]*testClient
+}
+
+// newMafiaGame deals roles with a fixed seed. The host is a spectator so it can kick anyone.
+func newMafiaGame(t *testing.T, seed int64, names ...string) *mafiaGame {
+	t.Helper()
+	m := newMafiaLobby(t, seed, names...)
+	m.deal(t)
+	return m
+}
+
+// newMafiaLobby seats everyone without starting, so the roles can be set up first
+func newMafiaLobby(t *testing.T, seed int64, names ...string) *mafiaGame {
+	t.Helper()
+	g := newTestGame(t, "mafia", "host", seed, names...)
+	g.join(t, "host", "Host", true)
+	g.settle(t)
+	return &mafiaGame{testGame: g, byRole: make(map[string]*testClient)}
+}
+
+func (m *mafiaGame) deal(t *testing.T) {
+	t.Helper()
+	m.session.GameEngine.InitState(m.session)
+	for id, role := range m.engine().Roles {
+		if role != services.ROLE_CIVILIAN {
+			m.byRole[role] = m.byID[id]
+		}
+	}
+}
+
+func (m *mafiaGame) engine() *services.MafiaLogic {
+	return m.session.GameEngine.(*services.MafiaLogic)
+}
+
+// withRole lists everyone dealt role, sorted by ID
+func (m *mafiaGame) withRole(role string) []*testClient {
+	var ids []string
+	for id, r := range m.engine().Roles {
+		if r == role {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	clients := make([]*testClient, len(ids))
+	for i, id := range ids {
+		clients[i] = m.byID[id]
+	}
+	return clients
+}
+
+func (m *mafiaGame) night(role, target string) {
+	m.act(m.byRole[role], fmt.Sprintf(`{"type":"night_action","targetId":%q}`, target))
+}
+
+func (m *mafiaGame) vote(c *testClient, target string) {
+	m.act(c, fmt.Sprintf(`{"type":"vote","targetId":%q}`, target))
+}
+
+func (m *mafiaGame) host() *testClient {
+	return m.byID["host"]
+}
+
+func (m *mafiaGame) waitPhase(t *testing.T, phase string) services.MafiaGameState {
+	t.Helper()
+	return decode[services.MafiaGameState](t, m.host().waitFor(t, phase, func(msg gameMessage) bool {
+		return msg.Action == "game_update" && decode[services.MafiaGameState](t, msg).Phase == phase
+	}))
+}
+
+// sevenPlayers deals every special role plus two civilians, so one death doesn't end the game
+func sevenPlayers() []string {
+	return []string{"Ana", "Bob", "Cem", "Dia", "Eli", "Fay", "Gus"}
+}
+
+func (m *mafiaGame) players() []*testClient {
+	var players []*testClient
+	for _, c := range m.clients {
+		if !c.IsSpectator {
+			players = append(players, c)
+		}
+	}
+	return players
+}
+
+func isDead(state services.MafiaGameState, id string) bool {
+	for _, p := range state.DeadPlayers {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMafiaSeededRolesAreReproducible(t *testing.T) {
+	a := newMafiaGame(t, 42, sevenPlayers()...)
+	b := newMafiaGame(t, 42, sevenPlayers()...)
+
+	rolesA := a.session.GameEngine.(*services.MafiaLogic).Roles
+	rolesB := b.session.GameEngine.(*services.MafiaLogic).Roles
+	for id, role := range rolesA {
+		if rolesB[id] != role {
+			t.Fatalf("same seed dealt %s %s and %s", id, role, rolesB[id])
+		}
+	}
+}
+
+func TestMafiaResolveNight(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions func(m *mafiaGame) map[string]string // role -> target user ID
+		message string
+		killed  string // role of whoever should be dead, empty for nobody
+		intel   string // what the police should learn
+	}{
+		{
+			name: "doctor saves the victim",
+			actions: func(m *mafiaGame) map[string]string {
+				return map[string]string{
+					services.ROLE_MAFIA:  m.byRole[services.ROLE_POLICE].UserID,
+					services.ROLE_DOCTOR: m.byRole[services.ROLE_POLICE].UserID,
+					services.ROLE_WHORE:  m.byRole[services.ROLE_SPY].UserID,
+					services.ROLE_POLICE: m.byRole[services.ROLE_MAFIA].UserID,
+				}
+			},
+			message: "The Doctor saved the victim",
+			intel:   "is MAFIA",
+		},
+		{
+			name: "whore blocks the mafia",
+			actions: func(m *mafiaGame) map[string]string {
+				return map[string]string{
+					services.ROLE_MAFIA:  m.byRole[services.ROLE_DOCTOR].UserID,
+					services.ROLE_DOCTOR: m.byRole[services.ROLE_POLICE].UserID,
+					services.ROLE_WHORE:  m.byRole[services.ROLE_MAFIA].UserID,
+					services.ROLE_POLICE: m.byRole[services.ROLE_SPY].UserID,
+				}
+			},
+			message: "The night was quiet",
+			intel:   "is Innocent",
+		},
+		{
+			name: "whore distracts the victim",
+			actions: func(m *mafiaGame) map[string]string {
+				return map[string]string{
+					services.ROLE_MAFIA:  m.byRole[services.ROLE_DOCTOR].UserID,
+					services.ROLE_DOCTOR: m.byRole[services.ROLE_SPY].UserID,
+					services.ROLE_WHORE:  m.byRole[services.ROLE_DOCTOR].UserID,
+					services.ROLE_POLICE: m.byRole[services.ROLE_WHORE].UserID,
+				}
+			},
+			message: "The Whore distracted the victim",
+			intel:   "is Innocent",
+		},
+		{
+			name: "mafia kills",
+			actions: func(m *mafiaGame) map[string]string {
+				return map[string]string{
+					services.ROLE_MAFIA:  m.byRole[services.ROLE_POLICE].UserID,
+					services.ROLE_DOCTOR: m.byRole[services.ROLE_SPY].UserID,
+					services.ROLE_WHORE:  m.byRole[services.ROLE_DOCTOR].UserID,
+					services.ROLE_POLICE: m.byRole[services.ROLE_MAFIA].UserID,
+				}
+			},
+			message: "was killed in the night",
+			killed:  services.ROLE_POLICE,
+			intel:   "is MAFIA",
+		},
+	}
+
+	// Order the roles so the night actions always go in the same order
+	roles := []string{services.ROLE_WHORE, services.ROLE_DOCTOR, services.ROLE_POLICE, services.ROLE_MAFIA}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMafiaGame(t, 3, sevenPlayers()...)
+			actions := tt.actions(m)
+			for _, role := range roles {
+				m.night(role, actions[role])
+			}
+
+			state := m.waitPhase(t, "DAY")
+			if !strings.Contains(state.Message, tt.message) {
+				t.Errorf("morning message %q, want %q", state.Message, tt.message)
+			}
+
+			for role, c := range m.byRole {
+				if dead := isDead(state, c.UserID); dead != (role == tt.killed) {
+					t.Errorf("%s dead=%v", role, dead)
+				}
+			}
+
+			police := m.byRole[services.ROLE_POLICE]
+			police.waitFor(t, "investigation result", func(msg gameMessage) bool {
+				return msg.Action == "intel" && strings.Contains(msg.Content, tt.intel)
+			})
+		})
+	}
+}
+
+func TestMafiaBlockedPlayerIsTold(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+	mafia := m.byRole[services.ROLE_MAFIA]
+
+	m.night(services.ROLE_WHORE, mafia.UserID)
+	m.night(services.ROLE_DOCTOR, mafia.UserID)
+	m.night(services.ROLE_POLICE, mafia.UserID)
+	m.night(services.ROLE_MAFIA, m.byRole[services.ROLE_DOCTOR].UserID)
+
+	mafia.waitFor(t, "the blocked notice", func(msg gameMessage) bool {
+		return msg.Action == "system_message" && strings.Contains(msg.Content, "blocked")
+	})
+}
+
+func TestMafiaIgnoresBadNightTargets(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+
+	m.night(services.ROLE_WHORE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_POLICE, m.byRole[services.ROLE_SPY].UserID)
+	// Not a player in this game, or the spectating host: neither can be targeted
+	m.night(services.ROLE_MAFIA, "nobody")
+	m.night(services.ROLE_MAFIA, "host")
+
+	m.host().quiet(t, "a day started by a bad target", func(msg gameMessage) bool {
+		return msg.Action == "game_update" && decode[services.MafiaGameState](t, msg).Phase == "DAY"
+	})
+
+	m.night(services.ROLE_MAFIA, m.byRole[services.ROLE_POLICE].UserID)
+	m.waitPhase(t, "DAY")
+}
+
+func TestMafiaLeaverEndsTheNightOnce(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+	whore := m.byRole[services.ROLE_WHORE]
+
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_POLICE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_MAFIA, m.byRole[services.ROLE_DOCTOR].UserID)
+
+	// The whore was the last one everyone waited for
+	m.session.Moderation <- &services.ModerationRequest{Sender: m.host().Client, Action: "kick_player", TargetID: whore.UserID}
+
+	state := m.waitPhase(t, "DAY")
+	for _, p := range state.AlivePlayers {
+		if p.ID == whore.UserID {
+			t.Error("player who left should be out of the game")
+		}
+	}
+	m.host().quiet(t, "a second day", func(msg gameMessage) bool {
+		return msg.Action == "game_update" && decode[services.MafiaGameState](t, msg).Phase == "DAY"
+	})
+}
+
+func TestMafiaCiviliansWin(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+	mafia := m.byRole[services.ROLE_MAFIA]
+
+	// Night 1: the doctor saves the target
+	m.night(services.ROLE_WHORE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_DOCTOR].UserID)
+	m.night(services.ROLE_POLICE, mafia.UserID)
+	m.night(services.ROLE_MAFIA, m.byRole[services.ROLE_DOCTOR].UserID)
+	m.waitPhase(t, "DAY")
+
+	// Day 1: everyone skips, night comes after the results pause
+	for _, c := range m.players() {
+		m.vote(c, "SKIP")
+	}
+	results := m.waitPhase(t, "RESULTS")
+	if !strings.Contains(results.Message, "SKIP") {
+		t.Errorf("results message %q", results.Message)
+	}
+	m.clock.Advance(5 * time.Second)
+	m.waitPhase(t, "NIGHT")
+
+	// Night 2: quiet again
+	m.night(services.ROLE_WHORE, mafia.UserID)
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_POLICE].UserID)
+	m.night(services.ROLE_POLICE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_MAFIA, m.byRole[services.ROLE_POLICE].UserID)
+	m.waitPhase(t, "DAY")
+
+	// Day 2: the town lynches the mafia
+	for _, c := range m.players() {
+		if c == mafia {
+			m.vote(c, "SKIP")
+		} else {
+			m.vote(c, mafia.UserID)
+		}
+	}
+	m.waitPhase(t, "RESULTS")
+	m.clock.Advance(5 * time.Second)
+
+	over := m.waitPhase(t, "GAME_OVER")
+	if over.Winner != "CIVILIANS" {
+		t.Fatalf("winner %q", over.Winner)
+	}
+
+	result := m.results.wait(t)
+	if result.WinningSide != "CIVILIANS" {
+		t.Errorf("recorded winning side %q", result.WinningSide)
+	}
+	for role, c := range m.byRole {
+		p := participant(t, result, c.UserID)
+		mafiaTeam := role == services.ROLE_MAFIA || role == services.ROLE_SPY
+		if p.Won == mafiaTeam {
+			t.Errorf("%s won=%v", role, p.Won)
+		}
+	}
+	if participant(t, result, mafia.UserID).Stats["votes_received"] != 6 {
+		t.Error("mafia should have 6 votes against them")
+	}
+}
+
+func TestMafiaWinsWhenTheyMatchTheTown(t *testing.T) {
+	m := newMafiaGame(t, 3, "Ana", "Bob", "Cem")
+	engine := m.session.GameEngine.(*services.MafiaLogic)
+
+	var civilians []string
+	for id, role := range engine.Roles {
+		if role == services.ROLE_CIVILIAN {
+			civilians = append(civilians, id)
+		}
+	}
+	sort.Strings(civilians)
+
+	m.night(services.ROLE_MAFIA, civilians[0])
+
+	over := m.waitPhase(t, "GAME_OVER")
+	if over.Winner != "MAFIA" {
+		t.Fatalf("winner %q", over.Winner)
+	}
+	result := m.results.wait(t)
+	if !participant(t, result, m.byRole[services.ROLE_MAFIA].UserID).Won {
+		t.Error("mafia should be credited with the win")
+	}
+}
+
+// --- Protocol ---
+
+type wsPlayer struct {
+	conn *websocket.Conn
+}
+
+// dialGame seats a user in the session over a real WebSocket, the way the handler does
+func dialGame(t *testing.T, manager *services.DrinnkingGameManager, sessionID, userID string, spectator bool) *wsPlayer {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		info, ok := manager.FindSession(r.Context(), sessionID)
+		if !ok {
+			conn.Close()
+			return
+		}
+		manager.Attach(info, services.JoinRequest{UserID: userID, Username: userID, Spectator: spectator, PasswordOK: true}, conn)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	p := &wsPlayer{conn: conn}
+	p.send(t, `{"action":"join_room"}`)
+	p.waitFor(t, "session_joined", func(m map[string]interface{}) bool { return m["action"] == "session_joined" })
+	return p
+}
+
+func (p *wsPlayer) send(t *testing.T, msg string) {
+	t.Helper()
+	if err := p.conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func (p *wsPlayer) waitFor(t *testing.T, what string, match func(map[string]interface{}) bool) map[string]interface{} {
+	t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := p.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("never got %s: %v", what, err)
+		}
+		// The write pump can batch several messages into one frame
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg map[string]interface{}
+			if json.Unmarshal([]byte(line), &msg) == nil && match(msg) {
+				return msg
+			}
+		}
+	}
+}
+
+func (p *wsPlayer) expectError(t *testing.T, requestID, code string) map[string]interface{} {
+	t.Helper()
+	frame := p.waitFor(t, "error "+code, func(m map[string]interface{}) bool {
+		id, _ := m["requestId"].(string)
+		return m["action"] == "error" && id == requestID
+	})
+	if frame["code"] != code {
+		t.Fatalf("request %s: got error %v (%v), want %s", requestID, frame["code"], frame["message"], code)
+	}
+	if frame["message"] == "" {
+		t.Errorf("request %s: error frame has no message", requestID)
+	}
+	return frame
+}
+
+func TestWebSocketProtocolValue(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "bearer, tok123, game-password, c2VjcmV0")
+
+	if got := middleware.WebSocketProtocolValue(r, "bearer"); got != "tok123" {
+		t.Errorf("token %q", got)
+	}
+	if got := middleware.WebSocketProtocolValue(r, "game-password"); got != "c2VjcmV0" {
+		t.Errorf("password %q", got)
+	}
+	if got := middleware.WebSocketProtocolValue(r, "c2VjcmV0"); got != "" {
+		t.Errorf("the last entry has no value, got %q", got)
+	}
+}
+
+func TestProtocolErrorFrames(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	session := manager.CreateSession(context.Background(), "protocol-test", "kings-cup", "host", "host", services.NewSessionSettings(true, "", 0))
+	defer manager.DeleteSession(session.ID)
+
+	host := dialGame(t, manager, session.ID, "host", false)
+	guest := dialGame(t, manager, session.ID, "guest", false)
+	watcher := dialGame(t, manager, session.ID, "watcher", true)
+
+	host.send(t, `{"v":1,"requestId":"start","action":"start_game"}`)
+	state := host.waitFor(t, "the first turn", func(m map[string]interface{}) bool {
+		gs, ok := m["gameState"].(map[string]interface{})
+		return ok && gs["currentPlayerTurnID"] != nil
+	})
+
+	tests := []struct {
+		name   string
+		player *wsPlayer
+		msg    string
+		id     string
+		code   string
+	}{
+		{"not JSON", guest, `{"requestId":"1","action":`, "", services.ErrCodeBadRequest},
+		{"newer protocol", guest, `{"v":99,"requestId":"2","action":"game_action","type":"draw_card"}`, "2", services.ErrCodeUnsupportedVersion},
+		{"wrong field type", guest, `{"requestId":"3","action":"game_action","type":7}`, "3", services.ErrCodeBadRequest},
+		{"missing game type", guest, `{"requestId":"4","action":"game_action"}`, "4", services.ErrCodeBadRequest},
+		{"unknown game action", guest, `{"requestId":"5","action":"game_action","type":"flip_table"}`, "5", services.ErrCodeUnknownAction},
+		{"missing required field", guest, `{"requestId":"6","action":"game_action","type":"set_rule"}`, "6", services.ErrCodeBadRequest},
+		{"spectator playing", watcher, `{"requestId":"7","action":"game_action","type":"draw_card"}`, "7", services.ErrCodeNotAllowed},
+		{"guest starting", guest, `{"requestId":"8","action":"start_game"}`, "8", services.ErrCodeNotAllowed},
+		{"guest kicking", guest, `{"requestId":"9","action":"kick_player","targetId":"host"}`, "9", services.ErrCodeNotAllowed},
+		{"kicking nobody", host, `{"requestId":"10","action":"kick_player","targetId":"ghost"}`, "10", services.ErrCodeInvalidTarget},
+		{"unknown action", guest, `{"requestId":"11","action":"dance"}`, "11", services.ErrCodeUnknownAction},
+		{"empty chat", guest, `{"requestId":"12","action":"chat","content":""}`, "12", services.ErrCodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.player.send(t, tt.msg)
+			frame := tt.player.expectError(t, tt.id, tt.code)
+			if frame["v"] != float64(services.ProtocolVersion) {
+				t.Errorf("error frame version %v", frame["v"])
+			}
+		})
+	}
+
+	// Whoever isn't up gets told it's not their turn, the player who is can draw
+	turn := state["gameState"].(map[string]interface{})["currentPlayerTurnID"]
+	waiting, drawing := guest, host
+	if turn == "guest" {
+		waiting, drawing = host, guest
+	}
+
+	waiting.send(t, `{"v":1,"requestId":"turn","action":"game_action","type":"draw_card"}`)
+	waiting.expectError(t, "turn", services.ErrCodeNotYourTurn)
+
+	drawing.send(t, `{"v":1,"requestId":"draw","action":"game_action","type":"draw_card"}`)
+	drawing.waitFor(t, "the drawn card", func(m map[string]interface{}) bool {
+		gs, ok := m["gameState"].(map[string]interface{})
+		return ok && gs["cardsRemaining"] == float64(51)
+	})
+}
+
+func TestMafiaRejectsVotesForTheDead(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+	police := m.byRole[services.ROLE_POLICE]
+
+	m.night(services.ROLE_WHORE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_POLICE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_MAFIA, police.UserID)
+	m.waitPhase(t, "DAY")
+
+	engine := m.session.GameEngine
+	check := func(c *testClient, payload, code string) {
+		t.Helper()
+		err := engine.HandleMessage(m.session, c.Client, []byte(payload))
+		var gameErr *services.GameError
+		if !errors.As(err, &gameErr) || gameErr.Code != code {
+			t.Errorf("%s: got %v, want %s", payload, err, code)
+		}
+	}
+
+	mafia := m.byRole[services.ROLE_MAFIA]
+	check(mafia, fmt.Sprintf(`{"type":"vote","targetId":%q}`, police.UserID), services.ErrCodeInvalidTarget)
+	check(police, `{"type":"vote","targetId":"SKIP"}`, services.ErrCodeNotAllowed)
+	check(mafia, fmt.Sprintf(`{"type":"night_action","targetId":%q}`, m.byRole[services.ROLE_DOCTOR].UserID), services.ErrCodeWrongPhase)
+
+	if err := engine.HandleMessage(m.session, mafia.Client, []byte(`{"type":"vote","targetId":"SKIP"}`)); err != nil {
+		t.Errorf("valid vote rejected: %v", err)
+	}
+}
+
+// --- Chat ---
+
+func isChat(content string) func(gameMessage) bool {
+	return func(m gameMessage) bool { return m.Action == "chat" && m.Content == content }
+}
+
+func expectCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var gameErr *services.GameError
+	if !errors.As(err, &gameErr) || gameErr.Code != code {
+		t.Fatalf("got %v, want %s", err, code)
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	filter := services.NewChatFilter([]string{"heck", " darn ", "", "heckin", "блин"})
+
+	tests := map[string]string{
+		"what the heck":       "what the ****",
+		"HECK no, Darn it":    "**** no, **** it",
+		"checkmate":           "checkmate",
+		"nothing to see here": "nothing to see here",
+		"heck heck":           "**** ****",
+		"heckin good":         "****** good",
+		"hecking":             "hecking",
+		"ну блин!":            "ну ****!",
+		"Блин, опять":         "****, опять",
+		"блины на завтрак":    "блины на завтрак",
+		"héck":                "héck",
+	}
+	for in, want := range tests {
+		if got := filter.Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := services.NewChatFilter(nil).Clean("heck"); got != "heck" {
+		t.Errorf("empty filter changed the message to %q", got)
+	}
+}
+
+func TestChatIsFilteredAndRateLimited(t *testing.T) {
+	g := newTestGame(t, "kings-cup", "p1", 1, "Ana", "Bob")
+	g.session.Manager.SetChatFilter(services.NewChatFilter([]string{"heck"}))
+	p1, p2 := g.byID["p1"], g.byID["p2"]
+
+	if err := g.session.PostChat(p1.Client, "", "oh heck, my turn"); err != nil {
+		t.Fatal(err)
+	}
+	msg := p2.waitFor(t, "the filtered message", func(m gameMessage) bool { return m.Action == "chat" })
+	if msg.Content != "oh ****, my turn" || msg.Channel != services.ChatChannelAll || msg.UserID != "p1" {
+		t.Fatalf("got %+v", msg)
+	}
+
+	expectCode(t, g.session.PostChat(p1.Client, "", "   "), services.ErrCodeBadRequest)
+	expectCode(t, g.session.PostChat(p1.Client, "mafia", "psst"), services.ErrCodeBadRequest)
+
+	// Empty messages are refused before the limit, anything else counts against the burst of 5
+	for i := 0; i < 3; i++ {
+		if err := g.session.PostChat(p1.Client, "", "cheers"); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	expectCode(t, g.session.PostChat(p1.Client, "", "cheers"), services.ErrCodeRateLimited)
+
+	// Everyone has their own limit
+	if err := g.session.PostChat(p2.Client, "", "cheers"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatHistoryReplayedToLateJoiners(t *testing.T) {
+	g := newTestGame(t, "kings-cup", "p1", 1, "Ana", "Bob")
+
+	for i, c := range []*testClient{g.byID["p1"], g.byID["p2"], g.byID["p1"]} {
+		if err := g.session.PostChat(c.Client, "", fmt.Sprintf("message %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	late := g.join(t, "p3", "Cem", true)
+	history := late.waitFor(t, "the chat history", func(m gameMessage) bool { return m.Action == "chat_history" })
+	if len(history.Messages) != 3 {
+		t.Fatalf("replayed %d messages, want 3", len(history.Messages))
+	}
+	for i, msg := range history.Messages {
+		if msg.Content != fmt.Sprintf("message %d", i) || msg.ID != int64(i+1) {
+			t.Errorf("message %d replayed as %+v", i, msg)
+		}
+	}
+}
+
+func TestMafiaChatChannels(t *testing.T) {
+	m := newMafiaGame(t, 3, sevenPlayers()...)
+	host := m.host()
+	mafia := m.byRole[services.ROLE_MAFIA]
+	police := m.byRole[services.ROLE_POLICE]
+	doctor := m.byRole[services.ROLE_DOCTOR]
+
+	// At night the mafia talks among themselves
+	if err := m.session.PostChat(mafia.Client, services.ChatChannelMafia, "police first"); err != nil {
+		t.Fatal(err)
+	}
+	mafia.waitFor(t, "their own message", isChat("police first"))
+	doctor.quiet(t, "the mafia's chat", isChat("police first"))
+	expectCode(t, m.session.PostChat(doctor.Client, services.ChatChannelMafia, "hello?"), services.ErrCodeNotAllowed)
+
+	m.night(services.ROLE_WHORE, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_DOCTOR, m.byRole[services.ROLE_SPY].UserID)
+	m.night(services.ROLE_POLICE, mafia.UserID)
+	m.night(services.ROLE_MAFIA, police.UserID)
+	m.waitPhase(t, "DAY")
+
+	expectCode(t, m.session.PostChat(mafia.Client, services.ChatChannelMafia, "nice"), services.ErrCodeWrongPhase)
+
+	// The police is dead and knows who did it, but can only tell the dead
+	expectCode(t, m.session.PostChat(police.Client, services.ChatChannelAll, "it was the mafia!"), services.ErrCodeNotAllowed)
+	if err := m.session.PostChat(police.Client, services.ChatChannelDead, "it was them"); err != nil {
+		t.Fatal(err)
+	}
+	host.waitFor(t, "the dead chat as a spectator", isChat("it was them"))
+	doctor.quiet(t, "the dead chat", isChat("it was them"))
+	expectCode(t, m.session.PostChat(doctor.Client, services.ChatChannelDead, "boo"), services.ErrCodeNotAllowed)
+
+	// Late joiners only get what they are allowed to read
+	late := m.join(t, "late", "Late", true)
+	history := late.waitFor(t, "the chat history", func(msg gameMessage) bool { return msg.Action == "chat_history" })
+	if len(history.Messages) != 1 || history.Messages[0].Channel != services.ChatChannelDead {
+		t.Fatalf("late spectator was replayed %+v", history.Messages)
+	}
+}
+
+// --- Mafia role setups ---
+
+func (m *mafiaGame) waitLobby(t *testing.T, message string) {
+	t.Helper()
+	m.host().waitFor(t, message, func(msg gameMessage) bool {
+		state := decode[services.MafiaGameState](t, msg)
+		return msg.Action == "game_update" && state.Phase == "LOBBY" && state.Message == message
+	})
+}
+
+func (m *mafiaGame) setRoles(t *testing.T, roles string) error {
+	t.Helper()
+	return m.session.GameEngine.HandleMessage(m.session, m.host().Client, []byte(`{"type":"set_roles","roles":`+roles+`}`))
+}
+
+func TestMafiaHostPicksRoles(t *testing.T) {
+	m := newMafiaLobby(t, 5, sevenPlayers()...)
+
+	expectCode(t, m.setRoles(t, `{"CIVILIAN":3,"MAFIA":1}`), services.ErrCodeBadRequest)
+	expectCode(t, m.setRoles(t, `{"DOCTOR":1}`), services.ErrCodeBadRequest)
+	expectCode(t, m.setRoles(t, `{"MAFIA":-1}`), services.ErrCodeBadRequest)
+	expectCode(t, m.session.GameEngine.HandleMessage(m.session, m.byID["p1"].Client, []byte(`{"type":"set_roles","roles":{"MAFIA":1}}`)), services.ErrCodeNotAllowed)
+
+	if err := m.setRoles(t, `{"MAFIA":2,"BODYGUARD":1,"MAYOR":1,"JESTER":1}`); err != nil {
+		t.Fatal(err)
+	}
+	lobby := decode[services.MafiaGameState](t, m.host().waitFor(t, "the new setup", func(msg gameMessage) bool {
+		return msg.Action == "game_update" && decode[services.MafiaGameState](t, msg).RoleCounts != nil
+	}))
+	if lobby.Phase != "LOBBY" || lobby.RoleCounts[services.ROLE_MAFIA] != 2 {
+		t.Fatalf("lobby shows %+v", lobby)
+	}
+
+	m.deal(t)
+	want := map[string]int{
+		services.ROLE_MAFIA:     2,
+		services.ROLE_BODYGUARD: 1,
+		services.ROLE_MAYOR:     1,
+		services.ROLE_JESTER:    1,
+		services.ROLE_CIVILIAN:  2,
+	}
+	for role, n := range want {
+		if got := len(m.withRole(role)); got != n {
+			t.Errorf("dealt %d %s, want %d", got, role, n)
+		}
+	}
+
+	expectCode(t, m.setRoles(t, `{"MAFIA":1}`), services.ErrCodeWrongPhase)
+}
+
+func TestMafiaRoleSetupMustFitTheTable(t *testing.T) {
+	m := newMafiaLobby(t, 5, "Ana", "Bob", "Cem", "Dia")
+
+	if err := m.setRoles(t, `{"MAFIA":1,"DOCTOR":1,"POLICE":1,"JESTER":1,"MAYOR":1}`); err != nil {
+		t.Fatal(err)
+	}
+	m.session.GameEngine.InitState(m.session)
+	m.waitLobby(t, "These roles need at least 5 players")
+
+	if err := m.setRoles(t, `{"MAFIA":1,"SPY":1}`); err != nil {
+		t.Fatal(err)
+	}
+	m.session.GameEngine.InitState(m.session)
+	m.waitLobby(t, "Too many on the mafia's side for 4 players")
+	if len(m.engine().Roles) != 0 {
+		t.Error("roles were dealt for a setup that doesn't fit")
+	}
+}
+
+func TestMafiaBodyguard(t *testing.T) {
+	tests := []struct {
+		name      string
+		healGuard bool
+		message   string
+		guardDies bool
+	}{
+		{"dies in the victim's place", false, "died protecting someone", true},
+		{"survives when the doctor heals them", true, "The Bodyguard fought off the attack", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMafiaLobby(t, 5, sevenPlayers()...)
+			if err := m.setRoles(t, `{"MAFIA":1,"DOCTOR":1,"BODYGUARD":1}`); err != nil {
+				t.Fatal(err)
+			}
+			m.deal(t)
+
+			guard := m.byRole[services.ROLE_BODYGUARD]
+			victim := m.withRole(services.ROLE_CIVILIAN)[0]
+
+			expectCode(t, m.session.GameEngine.HandleMessage(m.session, guard.Client, []byte(fmt.Sprintf(`{"type":"night_action","targetId":%q}`, guard.UserID))), services.ErrCodeInvalidTarget)
+
+			heal := m.withRole(services.ROLE_CIVILIAN)[1].UserID
+			if tt.healGuard {
+				heal = guard.UserID
+			}
+			m.night(services.ROLE_BODYGUARD, victim.UserID)
+			m.night(services.ROLE_DOCTOR, heal)
+			m.night(services.ROLE_MAFIA, victim.UserID)
+
+			state := m.waitPhase(t, "DAY")
+			if !strings.Contains(state.Message, tt.message) {
+				t.Errorf("morning message %q, want %q", state.Message, tt.message)
+			}
+			if isDead(state, victim.UserID) {
+				t.Error("the guarded player died")
+			}
+			if isDead(state, guard.UserID) != tt.guardDies {
+				t.Errorf("bodyguard dead=%v", !tt.guardDies)
+			}
+		})
+	}
+}
+
+func TestMafiaMayorVotesTwice(t *testing.T) {
+	m := newMafiaLobby(t, 5, "Ana", "Bob", "Cem", "Dia", "Eli")
+	if err := m.setRoles(t, `{"MAFIA":1,"MAYOR":1}`); err != nil {
+		t.Fatal(err)
+	}
+	m.deal(t)
+
+	mafia, mayor := m.byRole[services.ROLE_MAFIA], m.byRole[services.ROLE_MAYOR]
+	civilians := m.withRole(services.ROLE_CIVILIAN)
+
+	m.night(services.ROLE_MAFIA, civilians[0].UserID)
+	m.waitPhase(t, "DAY")
+
+	// One vote each for three players would be a tie, the mayor's counts twice
+	m.vote(mayor, mafia.UserID)
+	m.vote(civilians[1], civilians[2].UserID)
+	m.vote(civilians[2], "SKIP")
+	m.vote(mafia, civilians[1].UserID)
+
+	results := m.waitPhase(t, "RESULTS")
+	if !strings.Contains(results.Message, "was executed") || !isDead(results, mafia.UserID) {
+		t.Fatalf("results %q", results.Message)
+	}
+
+	m.clock.Advance(5 * time.Second)
+	if over := m.waitPhase(t, "GAME_OVER"); over.Winner != "CIVILIANS" {
+		t.Fatalf("winner %q", over.Winner)
+	}
+	if got := participant(t, m.results.wait(t), mafia.UserID).Stats["votes_received"]; got != 2 {
+		t.Errorf("mafia has %d votes against them, want 2", got)
+	}
+}
+
+func TestMafiaJesterWinsWhenLynched(t *testing.T) {
+	m := newMafiaLobby(t, 5, "Ana", "Bob", "Cem", "Dia", "Eli")
+	if err := m.setRoles(t, `{"MAFIA":1,"JESTER":1}`); err != nil {
+		t.Fatal(err)
+	}
+	m.deal(t)
+
+	jester := m.byRole[services.ROLE_JESTER]
+	killed := m.withRole(services.ROLE_CIVILIAN)[0]
+	m.night(services.ROLE_MAFIA, killed.UserID)
+	m.waitPhase(t, "DAY")
+
+	for _, c := range m.players() {
+		switch c {
+		case killed:
+		case jester:
+			m.vote(c, "SKIP")
+		default:
+			m.vote(c, jester.UserID)
+		}
+	}
+	m.waitPhase(t, "RESULTS")
+	m.clock.Advance(5 * time.Second)
+
+	over := m.waitPhase(t, "GAME_OVER")
+	if over.Winner != services.ROLE_JESTER {
+		t.Fatalf("winner %q", over.Winner)
+	}
+
+	result := m.results.wait(t)
+	for _, p := range result.Participants {
+		if p.Won != (p.UserID == jester.UserID) {
+			t.Fatalf("%s won=%v, want only the jester to win", p.UserID, p.Won)
+		}
+	}
+	if !participant(t, result, jester.UserID).Won {
+		t.Fatal("the jester didn't win")
+	}
+}
+
+// --- Mafia phase timers ---
+
+func (m *mafiaGame) hostAction(payload string) error {
+	return m.session.GameEngine.HandleMessage(m.session, m.host().Client, []byte(payload))
+}
+
+func (m *mafiaGame) quietPhase(t *testing.T, phase string) {
+	t.Helper()
+	m.host().quiet(t, phase, func(msg gameMessage) bool {
+		return msg.Action == "game_update" && decode[services.MafiaGameState](t, msg).Phase == phase
+	})
+}
+
+func TestMafiaTimersResolveWithWhatCameIn(t *testing.T) {
+	m := newMafiaLobby(t, 3, sevenPlayers()...)
+	m.deal(t)
+
+	night := m.waitPhase(t, "NIGHT")
+	if night.TimeRemaining != 60 {
+		t.Errorf("night starts with %ds", night.TimeRemaining)
+	}
+
+	// Only the mafia acts, the others are AFK
+	police := m.byRole[services.ROLE_POLICE]
+	m.night(services.ROLE_MAFIA, police.UserID)
+
+	m.clock.Advance(59 * time.Second)
+	m.quietPhase(t, "DAY")
+	m.clock.Advance(time.Second)
+
+	day := m.waitPhase(t, "DAY")
+	if !isDead(day, police.UserID) {
+		t.Error("the mafia's kill should go through when the night times out")
+	}
+	if day.TimeRemaining != 180 {
+		t.Errorf("day starts with %ds", day.TimeRemaining)
+	}
+
+	// Two votes out of six are enough once the day runs out
+	mafia := m.byRole[services.ROLE_MAFIA]
+	m.vote(m.byRole[services.ROLE_DOCTOR], mafia.UserID)
+	m.vote(m.byRole[services.ROLE_WHORE], mafia.UserID)
+
+	m.clock.Advance(3 * time.Minute)
+	results := m.waitPhase(t, "RESULTS")
+	if !isDead(results, mafia.UserID) {
+		t.Fatalf("results %q", results.Message)
+	}
+	if results.TimeRemaining != 0 {
+		t.Errorf("results show a timer of %ds", results.TimeRemaining)
+	}
+}
+
+func TestMafiaHostExtendsAndSkipsTimers(t *testing.T) {
+	m := newMafiaLobby(t, 3, sevenPlayers()...)
+
+	expectCode(t, m.hostAction(`{"type":"set_timers","nightSeconds":5}`), services.ErrCodeBadRequest)
+	expectCode(t, m.hostAction(`{"type":"extend_timer"}`), services.ErrCodeWrongPhase)
+	expectCode(t, m.session.GameEngine.HandleMessage(m.session, m.byID["p1"].Client, []byte(`{"type":"skip_timer"}`)), services.ErrCodeNotAllowed)
+	if err := m.hostAction(`{"type":"set_timers","nightSeconds":20,"daySeconds":40}`); err != nil {
+		t.Fatal(err)
+	}
+
+	m.deal(t)
+	if night := m.waitPhase(t, "NIGHT"); night.TimeRemaining != 20 {
+		t.Errorf("night starts with %ds, want the host's 20", night.TimeRemaining)
+	}
+	expectCode(t, m.hostAction(`{"type":"set_timers","nightSeconds":30}`), services.ErrCodeWrongPhase)
+
+	m.clock.Advance(10 * time.Second)
+	if err := m.hostAction(`{"type":"extend_timer"}`); err != nil {
+		t.Fatal(err)
+	}
+	if extended := m.waitPhase(t, "NIGHT"); extended.TimeRemaining != 40 {
+		t.Errorf("extended night has %ds, want 40", extended.TimeRemaining)
+	}
+
+	// The original 20 seconds are up, the extension keeps the night going
+	m.clock.Advance(10 * time.Second)
+	m.quietPhase(t, "DAY")
+
+	if err := m.hostAction(`{"type":"skip_timer"}`); err != nil {
+		t.Fatal(err)
+	}
+	day := m.waitPhase(t, "DAY")
+	if day.Message != "The night was quiet Discuss and Vote" || day.TimeRemaining != 40 {
+		t.Fatalf("day %q with %ds", day.Message, day.TimeRemaining)
+	}
+
+	// The night's timer is gone, its old deadline passing doesn't end the day
+	m.clock.Advance(30 * time.Second)
+	m.quietPhase(t, "RESULTS")
+
+	if err := m.hostAction(`{"type":"skip_timer"}`); err != nil {
+		t.Fatal(err)
+	}
+	if results := m.waitPhase(t, "RESULTS"); !strings.Contains(results.Message, "SKIP") {
+		t.Errorf("a day with no votes ended with %q", results.Message)
+	}
+	expectCode(t, m.hostAction(`{"type":"skip_timer"}`), services.ErrCodeWrongPhase)
+}
+
+// --- Session reaper ---
+
+func newReaperManager(limits services.SessionLimits) (*services.DrinnkingGameManager, *fakeClock) {
+	manager := services.NewDrinnkingGameManager()
+	clock := newFakeClock()
+	manager.Clock = clock
+	manager.SetSessionLimits(limits)
+	return manager, clock
+}
+
+func waitGone(t *testing.T, manager *services.DrinnkingGameManager, sessionID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := manager.GetSession(sessionID); !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session %s was never removed", sessionID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReaperClosesIdleSessions(t *testing.T) {
+	manager, clock := newReaperManager(services.SessionLimits{IdleTimeout: 10 * time.Minute, Warning: time.Minute})
+	session := manager.CreateSession(context.Background(), "idle", "burn-book", "p1", "p1", services.NewSessionSettings(true, "", 0))
+	p1 := dialGame(t, manager, session.ID, "p1", false)
+
+	closing := func(m map[string]interface{}) bool { return m["action"] == "session_closing" }
+
+	clock.Advance(9*time.Minute + 30*time.Second)
+	manager.ReapSessions()
+	if left := p1.waitFor(t, "the idle warning", closing)["secondsLeft"]; left != float64(30) {
+		t.Fatalf("got %v seconds left, want 30", left)
+	}
+
+	// Saying something resets the clock
+	p1.send(t, `{"action":"chat","content":"still here"}`)
+	p1.waitFor(t, "the chat echo", func(m map[string]interface{}) bool { return m["action"] == "chat" })
+	clock.Advance(time.Minute)
+	manager.ReapSessions()
+	if _, ok := manager.GetSession(session.ID); !ok {
+		t.Fatal("session was closed while in use")
+	}
+
+	clock.Advance(9 * time.Minute)
+	manager.ReapSessions()
+	p1.waitFor(t, "a second idle warning", closing)
+	clock.Advance(time.Minute)
+	manager.ReapSessions()
+
+	closed := p1.waitFor(t, "session_closed", func(m map[string]interface{}) bool { return m["action"] == "session_closed" })
+	if closed["reason"] == "" {
+		t.Error("session_closed should say why")
+	}
+	waitGone(t, manager, session.ID)
+}
+
+func TestReaperWarnsBeforeClosing(t *testing.T) {
+	// Nobody ever joins this one, it still has to go
+	manager, clock := newReaperManager(services.SessionLimits{IdleTimeout: 10 * time.Minute, Warning: time.Minute})
+	session := manager.CreateSession(context.Background(), "abandoned", "kings-cup", "p1", "p1", services.NewSessionSettings(true, "", 0))
+
+	// Swept long after the limit, the warning still comes first
+	clock.Advance(time.Hour)
+	manager.ReapSessions()
+	if _, ok := manager.GetSession(session.ID); !ok {
+		t.Fatal("closed without a warning")
+	}
+	manager.ReapSessions()
+	waitGone(t, manager, session.ID)
+}
+
+func TestReaperEnforcesMaxLifetime(t *testing.T) {
+	manager, clock := newReaperManager(services.SessionLimits{IdleTimeout: 10 * time.Minute, MaxLifetime: time.Hour, Warning: time.Minute})
+	session := manager.CreateSession(context.Background(), "marathon", "burn-book", "p1", "p1", services.NewSessionSettings(true, "", 0))
+	p1 := dialGame(t, manager, session.ID, "p1", false)
+
+	p1.send(t, `{"action":"start_game"}`)
+	p1.send(t, `{"action":"game_action","type":"submit_question","payload":"Who peaked in school?"}`)
+	p1.send(t, `{"action":"game_action","type":"start_voting"}`)
+	p1.waitFor(t, "voting", func(m map[string]interface{}) bool {
+		state, _ := m["gameState"].(map[string]interface{})
+		return state["phase"] == "voting"
+	})
+
+	// Busy the whole time, so only the lifetime limit applies
+	keepBusy := func(d time.Duration) {
+		clock.Advance(d)
+		p1.send(t, `{"action":"join_room"}`) // chat would hit the rate limit
+		p1.waitFor(t, "session_joined", func(m map[string]interface{}) bool { return m["action"] == "session_joined" })
+		manager.ReapSessions()
+	}
+	for i := 0; i < 11; i++ {
+		keepBusy(5 * time.Minute)
+	}
+	keepBusy(4*time.Minute + 30*time.Second)
+	warning := p1.waitFor(t, "the lifetime warning", func(m map[string]interface{}) bool { return m["action"] == "session_closing" })
+	if warning["secondsLeft"] != float64(30) {
+		t.Fatalf("got %v seconds left, want 30", warning["secondsLeft"])
+	}
+	keepBusy(30 * time.Second)
+	p1.waitFor(t, "session_closed", func(m map[string]interface{}) bool { return m["action"] == "session_closed" })
+	waitGone(t, manager, session.ID)
+
+	// The vote timer is stopped with the session
+	deadline := time.Now().Add(2 * time.Second)
+	for clock.pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers still running after the session closed", clock.pending())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// --- Bots ---
+
+// newBotTable seats n bots in a public session, the first one hosting
+func newBotTable(tb testing.TB, manager *services.DrinnkingGameManager, gameType string, n int) (*services.Session, []*bots.Bot) {
+	tb.Helper()
+
+	id := fmt.Sprintf("bots-%s-%d", gameType, n)
+	session := manager.CreateSession(context.Background(), id, gameType, id+"-host", "Host Bot", services.NewSessionSettings(true, "", 0))
+
+	host, err := bots.Join(session, id+"-host", "Host Bot", bots.Options{Seed: 1})
+	if err != nil {
+		tb.Fatalf("host bot couldn't join: %v", err)
+	}
+	rest, err := bots.Fill(session, n-1, bots.Options{Seed: 1})
+	if err != nil {
+		tb.Fatalf("bot couldn't join: %v", err)
+	}
+
+	// Nobody can start until every seat is taken
+	deadline := time.Now().Add(2 * time.Second)
+	for seated(manager, session.ID) < n {
+		if time.Now().After(deadline) {
+			tb.Fatalf("only %d of %d bots got a seat", seated(manager, session.ID), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return session, append([]*bots.Bot{host}, rest...)
+}
+
+func seated(manager *services.DrinnkingGameManager, sessionID string) int {
+	for _, game := range manager.GetPublicSessions(context.Background()) {
+		if game.SessionID == sessionID {
+			return game.Players
+		}
+	}
+	return 0
+}
+
+// playGames has the host start a game, or the next one, and waits until it's over
+func playGames(tb testing.TB, host *bots.Bot, games int) {
+	tb.Helper()
+	for i := int(host.Games()); i < games; i++ {
+		if i == 0 {
+			host.StartGame()
+		} else {
+			host.ResetGame()
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for host.Games() <= int64(i) {
+			if time.Now().After(deadline) {
+				tb.Fatalf("game %d never finished, the bots are stuck", i+1)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+}
+
+// runClock keeps a fake clock moving so phase timers and waits between phases come due
+func runClock(clock *fakeClock) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(2 * time.Millisecond):
+				clock.Advance(time.Second)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// TestBotsSoak runs bots through every game at once while the lobby list is read, run it with -race
+func TestBotsSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+
+	manager := services.NewDrinnkingGameManager()
+	clock := newFakeClock()
+	manager.Clock = clock
+	defer runClock(clock)()
+
+	listing := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-listing:
+				return
+			default:
+				manager.GetPublicSessions(context.Background())
+			}
+		}
+	}()
+	defer close(listing)
+
+	tables := map[string]int{"kings-cup": 4, "burn-book": 4, "mafia": 5}
+
+	var wg sync.WaitGroup
+	for gameType, n := range tables {
+		session, table := newBotTable(t, manager, gameType, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playGames(t, table[0], 3)
+		}()
+		defer session.Close("soak test over")
+	}
+	wg.Wait()
+}
+
+func TestBotsLeaveTheirSeat(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	session, table := newBotTable(t, manager, "kings-cup", 3)
+
+	table[2].Leave()
+	session.Close("test over")
+	for _, b := range table {
+		select {
+		case <-b.Done():
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s was never let go", b.Username)
+		}
+	}
+
+	if _, err := bots.Join(session, "late", "Late Bot", bots.Options{}); err == nil {
+		t.Fatal("a bot joined a closed session")
+	}
+}
+
+// BenchmarkBotSession plays one four-bot Kings Cup game per op and reports the frames the session delivered
+func BenchmarkBotSession(b *testing.B) {
+	manager := services.NewDrinnkingGameManager()
+	session, table := newBotTable(b, manager, "kings-cup", 4)
+	defer session.Close("benchmark over")
+
+	received := func() (total int64) {
+		for _, bot := range table {
+			total += bot.Received()
+		}
+		return total
+	}
+
+	before := received()
+	b.ResetTimer()
+	start := time.Now()
+	playGames(b, table[0], b.N)
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	msgs := float64(received() - before)
+	b.ReportMetric(msgs/float64(b.N), "msgs/game")
+	b.ReportMetric(msgs/elapsed.Seconds(), "msgs/s")
+}
+
+// --- Matchmaking ---
+
+type matchOutcome struct {
+	match *services.Match
+	err   error
+}
+
+func queue(manager *services.DrinnkingGameManager, ctx context.Context, gameType, userID string) chan matchOutcome {
+	out := make(chan matchOutcome, 1)
+	go func() {
+		match, err := manager.Matchmake(ctx, gameType, userID, userID)
+		out <- matchOutcome{match, err}
+	}()
+	return out
+}
+
+func matched(t *testing.T, out chan matchOutcome) *services.Match {
+	t.Helper()
+	select {
+	case o := <-out:
+		if o.err != nil {
+			t.Fatalf("matchmaking failed: %v", o.err)
+		}
+		return o.match
+	case <-time.After(2 * time.Second):
+		t.Fatal("never matched")
+		return nil
+	}
+}
+
+func stillQueued(t *testing.T, out chan matchOutcome) {
+	t.Helper()
+	select {
+	case o := <-out:
+		t.Fatalf("matched too early: %+v %v", o.match, o.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMatchmakingOpensASessionOnceEnoughWait(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	manager.SetMatchRules(map[string]services.MatchRules{"mafia": {MinPlayers: 3, MaxPlayers: 4}})
+	ctx := context.Background()
+
+	first := queue(manager, ctx, "mafia", "p1")
+	stillQueued(t, first)
+	second := queue(manager, ctx, "mafia", "p2")
+	stillQueued(t, second)
+
+	// The third player opens the game for everyone, the longest waiting hosts
+	m3 := matched(t, queue(manager, ctx, "mafia", "p3"))
+	m1, m2 := matched(t, first), matched(t, second)
+	if !m3.Created || m1.SessionID != m3.SessionID || m2.SessionID != m3.SessionID {
+		t.Fatalf("players were split up: %+v %+v %+v", m1, m2, m3)
+	}
+	session, ok := manager.GetSession(m3.SessionID)
+	if !ok {
+		t.Fatal("the session was never created")
+	}
+	if session.HostID != "p1" || session.Settings.MaxPlayers != 4 {
+		t.Fatalf("host %s with %d seats, want p1 with 4", session.HostID, session.Settings.MaxPlayers)
+	}
+
+	// One seat left, and it's held for the next player without anyone else queueing
+	if m4 := matched(t, queue(manager, ctx, "mafia", "p4")); m4.SessionID != m3.SessionID || m4.Created {
+		t.Fatalf("p4 got %+v, want the seat left in %s", m4, m3.SessionID)
+	}
+	stillQueued(t, queue(manager, ctx, "mafia", "p5"))
+}
+
+func TestMatchmakingFillsOpenLobbies(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	manager.SetMatchRules(map[string]services.MatchRules{"kings-cup": {MinPlayers: 2, MaxPlayers: 8}})
+	ctx := context.Background()
+
+	// Someone already waiting gets a public lobby as soon as it's opened
+	waiting := queue(manager, ctx, "kings-cup", "p1")
+	stillQueued(t, waiting)
+	manager.CreateSession(ctx, "private", "kings-cup", "h0", "h0", services.NewSessionSettings(false, "", 0))
+	manager.CreateSession(ctx, "password", "kings-cup", "h1", "h1", services.NewSessionSettings(true, "secret", 0))
+	stillQueued(t, waiting)
+	manager.CreateSession(ctx, "lobby", "kings-cup", "h2", "h2", services.NewSessionSettings(true, "", 2))
+	if m := matched(t, waiting); m.SessionID != "lobby" {
+		t.Fatalf("p1 went to %s, want the open lobby", m.SessionID)
+	}
+
+	// The host and p1's held seat fill it, so the next two open their own game
+	p2 := queue(manager, ctx, "kings-cup", "p2")
+	m3 := matched(t, queue(manager, ctx, "kings-cup", "p3"))
+	if m2 := matched(t, p2); m2.SessionID == "lobby" || m2.SessionID != m3.SessionID || !m3.Created {
+		t.Fatalf("p2 and p3 got %+v and %+v, want a new game together", m2, m3)
+	}
+}
+
+func TestMatchmakingGivesUp(t *testing.T) {
+	manager := services.NewDrinnkingGameManager()
+	manager.SetMatchRules(map[string]services.MatchRules{"burn-book": {MinPlayers: 2, MaxPlayers: 8}})
+
+	if _, err := manager.Matchmake(context.Background(), "beer-pong", "p1", "p1"); !errors.Is(err, services.ErrUnknownGameType) {
+		t.Fatalf("got %v for a game nobody can queue for", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := manager.Matchmake(ctx, "burn-book", "p1", "p1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the request to time out", err)
+	}
+
+	// p1 gave up, so p2 is on their own
+	first := queue(manager, context.Background(), "burn-book", "p2")
+	stillQueued(t, first)
+
+	// Queueing again from a second request replaces the first, rather than taking two seats
+	again := queue(manager, context.Background(), "burn-book", "p2")
+	if o := <-first; !errors.Is(o.err, services.ErrMatchReplaced) {
+		t.Fatalf("the first request got %+v %v", o.match, o.err)
+	}
+	stillQueued(t, again)
+
+	m3 := matched(t, queue(manager, context.Background(), "burn-book", "p3"))
+	if m2 := matched(t, again); !m3.Created || m2.SessionID != m3.SessionID {
+		t.Fatalf("p2 and p3 should have opened a game, got %+v and %+v", m2, m3)
+	}
+}
+
+// --- Drinks ---
+
+type drinkSink struct {
+	mu     sync.Mutex
+	err    error // returned once, then cleared
+	logged map[string]int
+	days   map[string]time.Time
+}
+
+func (d *drinkSink) LogGameDrinks(ctx context.Context, clerkID string, drinks int, date time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.err; err != nil {
+		d.err = nil
+		return err
+	}
+	d.logged[clerkID] += drinks
+	d.days[clerkID] = date
+	return nil
+}
+
+func (d *drinkSink) drinks(clerkID string) (int, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.logged[clerkID], d.days[clerkID]
+}
+
+func isTally(m gameMessage) bool { return m.Action == "drink_tally" }
+
+func TestDrinksAreCountedAndLogged(t *testing.T) {
+	m := newMafiaGame(t, 3, "Ana", "Bob", "Cem")
+	sink := &drinkSink{logged: make(map[string]int), days: make(map[string]time.Time)}
+	m.session.Manager.SetDrinkLogger(sink)
+	victim := m.withRole(services.ROLE_CIVILIAN)[0]
+	mafia := m.byRole[services.ROLE_MAFIA]
+
+	// Nobody owes anything yet, but drinking anyway still counts
+	if err := m.session.TakeDrinks(victim.Client, 0); err != nil {
+		t.Fatal(err)
+	}
+	tally := mafia.waitFor(t, "the tally", isTally).Tally
+	if tally[victim.UserID] != (services.DrinkTally{Taken: 1}) {
+		t.Fatalf("tally %+v", tally)
+	}
+	expectCode(t, m.session.TakeDrinks(victim.Client, 11), services.ErrCodeBadRequest)
+	expectCode(t, m.session.LogDrinks(victim.Client, "early", ""), services.ErrCodeWrongPhase)
+
+	m.night(services.ROLE_MAFIA, victim.UserID)
+	over := m.waitPhase(t, "GAME_OVER")
+	if over.Drinks[victim.UserID] != (services.DrinkTally{Owed: 2, Taken: 1}) {
+		t.Fatalf("dying should owe 2 drinks, tally %+v", over.Drinks)
+	}
+
+	// Drinking pays off what the game handed out first
+	if err := m.session.TakeDrinks(victim.Client, 3); err != nil {
+		t.Fatal(err)
+	}
+	tally = mafia.waitFor(t, "the new tally", isTally).Tally
+	if tally[victim.UserID] != (services.DrinkTally{Taken: 4}) {
+		t.Fatalf("tally %+v", tally)
+	}
+
+	// The date is the player's own, so only a day either side of the server's is believable
+	expectCode(t, m.session.LogDrinks(victim.Client, "1", "01/02/2025"), services.ErrCodeBadRequest)
+	expectCode(t, m.session.LogDrinks(victim.Client, "1", "2025-01-03"), services.ErrCodeBadRequest)
+
+	// A failed write can be tried again, a game that was logged can't be logged twice
+	sink.err = errors.New("db down")
+	expectCode(t, m.session.LogDrinks(victim.Client, "1", "2025-01-02"), services.ErrCodeInternal)
+	if err := m.session.LogDrinks(victim.Client, "2", "2025-01-02"); err != nil {
+		t.Fatal(err)
+	}
+	victim.waitFor(t, "the confirmation", func(msg gameMessage) bool { return msg.Action == "drinks_logged" })
+	if got, day := sink.drinks(victim.UserID); got != 4 || !day.Equal(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("logged %d drinks on %v, want 4 on 2025-01-02", got, day)
+	}
+	expectCode(t, m.session.LogDrinks(victim.Client, "3", ""), services.ErrCodeNotAllowed)
+
+	// The mafia never drank, so there's nothing to log
+	expectCode(t, m.session.LogDrinks(mafia.Client, "4", ""), services.ErrCodeBadRequest)
+}
@@ -0,0 +1,324 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	fcm "outDrinkMeAPI/internal/notification"
+	"outDrinkMeAPI/internal/types/notification"
+)
+
+// smtpSink is a local SMTP server that keeps whatever it's sent. It offers no STARTTLS and no AUTH.
+type smtpSink struct {
+	addr  *net.TCPAddr
+	mails chan sinkMail
+}
+
+type sinkMail struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveSMTPSink(t, ln)
+}
+
+// newTLSSMTPSink is an smtpSink that speaks TLS from the first byte, like SMTP servers on port 465.
+// roots trusts its self-signed certificate.
+func newTLSSMTPSink(t *testing.T) (sink *smtpSink, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveSMTPSink(t, ln), roots
+}
+
+func serveSMTPSink(t *testing.T, ln net.Listener) *smtpSink {
+	t.Cleanup(func() { ln.Close() })
+
+	sink := &smtpSink{addr: ln.Addr().(*net.TCPAddr), mails: make(chan sinkMail, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+	return sink
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+
+	var mail sinkMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 sink")
+		case "MAIL":
+			mail = sinkMail{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			if mail.data, err = tp.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mails <- mail
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpSink) wait(t *testing.T) sinkMail {
+	t.Helper()
+	select {
+	case m := <-s.mails:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email reached the sink")
+		return sinkMail{}
+	}
+}
+
+// parts reads a multipart/alternative email into its subject and Content-Type -> body
+func parts(t *testing.T, data []byte) (string, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", mediaType, err)
+	}
+
+	bodies := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		b, _ := io.ReadAll(p)
+		bodies[ct] = string(b)
+	}
+	return subject, bodies
+}
+
+func newSinkEmailService(t *testing.T, sink *smtpSink) *fcm.SMTPEmailService {
+	t.Helper()
+	email, err := fcm.NewSMTPEmailService(fcm.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: sink.addr.Port,
+		From: "OutDrinkMe <no-reply@outdrinkme.app>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+func TestEmailUsesTheTypesTemplates(t *testing.T) {
+	sink := newSMTPSink(t)
+	email := newSinkEmailService(t, sink)
+
+	link := "https://outdrinkme.app/mix/7"
+	err := email.SendNotificationEmail(context.Background(), notification.EmailRecipient{Email: "ana@example.com", Username: "Ana"}, &notification.Notification{
+		Type:      notification.TypeFriendPostedMix,
+		Title:     "Ivan posted to the Mix",
+		Body:      "Ivan <3 beer pong",
+		ActionURL: &link,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := sink.wait(t)
+	if m.from != "no-reply@outdrinkme.app" || len(m.to) != 1 || m.to[0] != "ana@example.com" {
+		t.Fatalf("envelope from %q to %v", m.from, m.to)
+	}
+
+	subject, bodies := parts(t, m.data)
+	if subject != "🍻 Ivan posted to the Mix" {
+		t.Errorf("subject %q", subject)
+	}
+	text := bodies["text/plain"]
+	if !strings.Contains(text, "Hey Ana,") || !strings.Contains(text, "Ivan <3 beer pong") || !strings.Contains(text, "leave a reaction") || !strings.Contains(text, "Open the Mix: "+link) {
+		t.Errorf("text part:\n%s", text)
+	}
+	html := bodies["text/html"]
+	if !strings.Contains(html, "Ivan &lt;3 beer pong") || !strings.Contains(html, `href="`+link+`"`) || !strings.Contains(html, "Open the Mix") {
+		t.Errorf("html part:\n%s", html)
+	}
+}
+
+func TestEveryNotificationTypeHasItsOwnEmail(t *testing.T) {
+	sink := newSMTPSink(t)
+	email := newSinkEmailService(t, sink)
+
+	types := []notification.NotificationType{
+		notification.TypeStreakMilestone,
+		notification.TypeFriendOvertookYou,
+		notification.TypeMentionedInPost,
+		notification.TypeDrunkThoughtReaction,
+		notification.TypeFriendPostedMix,
+		notification.TypeFriendPostedStory,
+		notification.TypeFriendPostedReaction,
+	}
+	seen := map[string]notification.NotificationType{}
+	for _, notifType := range types {
+		err := email.SendNotificationEmail(context.Background(), notification.EmailRecipient{Email: "ana@example.com", Username: "Ana"}, &notification.Notification{
+			Type:  notifType,
+			Title: "Title",
+			Body:  "Body",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, bodies := parts(t, sink.wait(t).data)
+		text := bodies["text/plain"]
+		if !strings.Contains(text, "Body") {
+			t.Errorf("%s text part:\n%s", notifType, text)
+		}
+		if other, ok := seen[text]; ok {
+			t.Errorf("%s uses the same email as %s", notifType, other)
+		}
+		seen[text] = notifType
+	}
+}
+
+func TestEmailOverImplicitTLS(t *testing.T) {
+	sink, roots := newTLSSMTPSink(t)
+	email, err := fcm.NewSMTPEmailService(fcm.SMTPConfig{
+		Host:        "127.0.0.1",
+		Port:        sink.addr.Port,
+		From:        "OutDrinkMe <no-reply@outdrinkme.app>",
+		ImplicitTLS: true,
+		TLSConfig:   &tls.Config{RootCAs: roots},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = email.SendNotificationEmail(context.Background(), notification.EmailRecipient{Email: "ana@example.com", Username: "Ana"}, &notification.Notification{
+		Type:  notification.TypeStreakMilestone,
+		Title: "7 days in a row",
+		Body:  "You're on fire",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := parts(t, sink.wait(t).data); subject != "🔥 7 days in a row" {
+		t.Errorf("subject %q", subject)
+	}
+
+	// Without the sink's certificate the handshake fails instead of falling back to plain text
+	untrusted, _ := fcm.NewSMTPEmailService(fcm.SMTPConfig{Host: "127.0.0.1", Port: sink.addr.Port, From: "no-reply@outdrinkme.app", ImplicitTLS: true})
+	err = untrusted.SendNotificationEmail(context.Background(), notification.EmailRecipient{Email: "ana@example.com"}, &notification.Notification{Title: "Hi"})
+	if err == nil {
+		t.Fatal("sent to a server with an unknown certificate")
+	}
+}
+
+func TestEmailFallsBackToTheDefaultTemplate(t *testing.T) {
+	sink := newSMTPSink(t)
+	email := newSinkEmailService(t, sink)
+
+	// App deep links don't open from a mail client, so they're left out
+	deepLink := "outdrinkme://games"
+	err := email.SendNotificationEmail(context.Background(), notification.EmailRecipient{Email: "bob@example.com", Username: "Bob"}, &notification.Notification{
+		Type:      "game_invite",
+		Title:     "Kings Cup tonight?",
+		Body:      "Cem invited you to a game",
+		ActionURL: &deepLink,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, bodies := parts(t, sink.wait(t).data)
+	if subject != "Kings Cup tonight?" {
+		t.Errorf("subject %q", subject)
+	}
+	if !strings.Contains(bodies["text/plain"], "Cem invited you to a game") || strings.Contains(bodies["text/plain"], deepLink) {
+		t.Errorf("text part:\n%s", bodies["text/plain"])
+	}
+	if strings.Contains(bodies["text/html"], "href=") {
+		t.Errorf("html part has a link:\n%s", bodies["text/html"])
+	}
+}
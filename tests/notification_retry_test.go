@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"outDrinkMeAPI/internal/types/notification"
+	"outDrinkMeAPI/services"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := services.RetryPolicy{
+		BaseDelay: 30 * time.Second,
+		MaxDelay:  5 * time.Minute,
+		MaxAttempts: map[notification.NotificationPriority]int{
+			notification.PriorityHigh: 6,
+		},
+	}
+	failedAt := time.Date(2026, time.March, 10, 14, 0, 0, 0, time.UTC)
+
+	// Doubles every time until it hits the cap
+	for failures, want := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+	} {
+		next, ok := policy.NextAttempt(notification.PriorityHigh, failures, failedAt)
+		if !ok || next.Sub(failedAt) != want {
+			t.Errorf("after %d failures: got %v %v, want a retry in %v", failures, ok, next.Sub(failedAt), want)
+		}
+	}
+
+	if _, ok := policy.NextAttempt(notification.PriorityHigh, 6, failedAt); ok {
+		t.Error("retried past the max attempts")
+	}
+	// Priorities without a setting only get the one attempt
+	if _, ok := policy.NextAttempt(notification.PriorityLow, 1, failedAt); ok {
+		t.Error("retried a priority with no attempts set")
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	policy := services.DefaultRetryPolicy
+	failedAt := time.Date(2026, time.March, 10, 14, 0, 0, 0, time.UTC)
+
+	for random, want := range map[float64]time.Duration{
+		0:    24 * time.Second, // -20%
+		0.5:  30 * time.Second,
+		0.99: 35*time.Second + 880*time.Millisecond, // just under +20%
+	} {
+		policy.Rand = func() float64 { return random }
+		next, ok := policy.NextAttempt(notification.PriorityUrgent, 1, failedAt)
+		if !ok || next.Sub(failedAt) != want {
+			t.Errorf("random %v: got a retry in %v, want %v", random, next.Sub(failedAt), want)
+		}
+	}
+
+	// With the real source, every wait stays in the band
+	policy.Rand = nil
+	for i := 0; i < 100; i++ {
+		next, _ := policy.NextAttempt(notification.PriorityUrgent, 3, failedAt)
+		if d := next.Sub(failedAt); d < 96*time.Second || d > 144*time.Second {
+			t.Fatalf("third retry in %v, outside 2m ±20%%", d)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"outDrinkMeAPI/internal/migrations"
 	"outDrinkMeAPI/internal/types/notification"
 	"outDrinkMeAPI/services"
 
@@ -31,6 +32,9 @@ func setupTestDB() *pgxpool.Pool {
     if err != nil {
         log.Fatal(err)
     }
+    if err := migrations.Apply(context.Background(), db); err != nil {
+        log.Fatal(err)
+    }
     return db
 }
 
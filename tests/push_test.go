@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	fcm "outDrinkMeAPI/internal/notification"
+	"outDrinkMeAPI/internal/types/notification"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// fakeSender keeps every message instead of calling Firebase, and fails tokens listed in fail
+type fakeSender struct {
+	mu   sync.Mutex
+	sent map[string]*messaging.Message
+	fail map[string]bool
+}
+
+func (f *fakeSender) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail[message.Token] {
+		return "", errors.New("registration token is not registered")
+	}
+	f.sent[message.Token] = message
+	return "projects/test/messages/1", nil
+}
+
+func TestPushUsesEachPlatformsConfig(t *testing.T) {
+	sender := &fakeSender{sent: make(map[string]*messaging.Message), fail: map[string]bool{"ios-stale": true}}
+	push := fcm.NewFCMServiceWithSender(sender)
+
+	badge := 4
+	report, err := push.SendPush(context.Background(), []notification.DeviceToken{
+		{Token: "android-1", Platform: "android"},
+		{Token: "legacy", Platform: ""},
+		{Token: "ios-1", Platform: "ios"},
+		{Token: "ios-stale", Platform: "ios"},
+		{Token: "web-1", Platform: "web"},
+		{Token: "fridge", Platform: "smart-fridge"},
+	}, notification.PushMessage{
+		Title:    "Ivan posted to the Mix",
+		Body:     "Tap to see it",
+		Data:     map[string]any{"post_id": 7},
+		Priority: notification.PriorityHigh,
+		Badge:    &badge,
+		ThreadID: string(notification.TypeFriendPostedMix),
+		Link:     "https://outdrinkme.app/mix/7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := notification.PushReport{
+		"android":      {Sent: 2},
+		"ios":          {Sent: 1, Failed: 1},
+		"web":          {Sent: 1},
+		"smart-fridge": {Failed: 1},
+	}
+	for platform, res := range want {
+		if got := report[platform]; got == nil || *got != *res {
+			t.Errorf("%s: got %+v, want %+v", platform, got, res)
+		}
+	}
+
+	if m := sender.sent["legacy"]; m == nil || m.Android == nil || m.Data["post_id"] != "7" {
+		t.Errorf("tokens without a platform should go out as Android, got %+v", m)
+	}
+
+	ios := sender.sent["ios-1"]
+	if ios == nil || ios.APNS == nil || ios.Android != nil {
+		t.Fatalf("iOS message %+v", ios)
+	}
+	aps := ios.APNS.Payload.Aps
+	if aps.Alert.Title != "Ivan posted to the Mix" || aps.Badge == nil || *aps.Badge != 4 || aps.Sound != "default" || aps.ThreadID != "friend_posted_mix" {
+		t.Errorf("aps %+v", aps)
+	}
+	if ios.APNS.Headers["apns-priority"] != "10" {
+		t.Errorf("high priority should be delivered right away, headers %v", ios.APNS.Headers)
+	}
+
+	web := sender.sent["web-1"]
+	if web == nil || web.Webpush == nil || web.Webpush.FCMOptions == nil || web.Webpush.FCMOptions.Link != "https://outdrinkme.app/mix/7" {
+		t.Fatalf("web message %+v", web)
+	}
+	if web.Webpush.Notification.Title != "Ivan posted to the Mix" || web.Webpush.Headers["Urgency"] != "high" {
+		t.Errorf("webpush %+v", web.Webpush)
+	}
+}
+
+func TestPushFailsOnlyWhenNothingWasDelivered(t *testing.T) {
+	sender := &fakeSender{sent: make(map[string]*messaging.Message), fail: map[string]bool{"ios-1": true}}
+	push := fcm.NewFCMServiceWithSender(sender)
+
+	report, err := push.SendPush(context.Background(), []notification.DeviceToken{{Token: "ios-1", Platform: "ios"}}, notification.PushMessage{Title: "hi"})
+	if err == nil {
+		t.Fatal("expected an error when every token failed")
+	}
+	if report["ios"] == nil || report["ios"].Failed != 1 {
+		t.Errorf("report %v", report)
+	}
+}
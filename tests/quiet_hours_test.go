@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"outDrinkMeAPI/internal/types/notification"
+)
+
+func quietHours(start, end, tz string) *notification.NotificationPreferences {
+	clock := func(hhmm string) *time.Time {
+		t, err := time.Parse("15:04", hhmm)
+		if err != nil {
+			panic(err)
+		}
+		return &t
+	}
+	return &notification.NotificationPreferences{
+		QuietHoursEnabled:  true,
+		QuietHoursStart:    clock(start),
+		QuietHoursEnd:      clock(end),
+		QuietHoursTimezone: tz,
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	sofia, err := time.LoadLocation("Europe/Sofia")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, time.March, day, hour, min, 0, 0, sofia)
+	}
+
+	overnight := quietHours("23:00", "08:00", "Europe/Sofia")
+	afternoon := quietHours("13:00", "15:30", "Europe/Sofia")
+
+	for _, tc := range []struct {
+		name  string
+		prefs *notification.NotificationPreferences
+		at    time.Time
+		quiet bool
+		until time.Time
+	}{
+		{"before an overnight window", overnight, at(10, 22, 59), false, time.Time{}},
+		{"late in an overnight window", overnight, at(10, 23, 30), true, at(11, 8, 0)},
+		{"early in an overnight window", overnight, at(11, 3, 0), true, at(11, 8, 0)},
+		{"the minute it ends", overnight, at(11, 8, 0), false, time.Time{}},
+		{"inside a daytime window", afternoon, at(10, 14, 0), true, at(10, 15, 30)},
+		{"after a daytime window", afternoon, at(10, 16, 0), false, time.Time{}},
+		// 21:30 UTC is 23:30 in Sofia
+		{"in the user's timezone", overnight, time.Date(2026, time.March, 10, 21, 30, 0, 0, time.UTC), true, at(11, 8, 0)},
+		// Clocks go forward at 03:00 on the 29th, the window still ends at 08:00 local time
+		{"across a DST change", overnight, at(28, 23, 30), true, at(29, 8, 0)},
+	} {
+		until, quiet := tc.prefs.QuietUntil(tc.at)
+		if quiet != tc.quiet || !until.Equal(tc.until) {
+			t.Errorf("%s: got %v %v, want %v %v", tc.name, quiet, until, tc.quiet, tc.until)
+		}
+	}
+
+	off := quietHours("23:00", "08:00", "Europe/Sofia")
+	off.QuietHoursEnabled = false
+	if _, quiet := off.QuietUntil(at(11, 3, 0)); quiet {
+		t.Error("quiet hours apply while turned off")
+	}
+
+	// Without a known timezone the window is read as UTC
+	utc := quietHours("23:00", "08:00", "Mars/Olympus_Mons")
+	until, quiet := utc.QuietUntil(time.Date(2026, time.March, 10, 23, 30, 0, 0, time.UTC))
+	if !quiet || !until.Equal(time.Date(2026, time.March, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v %v for an unknown timezone", quiet, until)
+	}
+}
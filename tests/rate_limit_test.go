@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"outDrinkMeAPI/internal/types/notification"
+)
+
+func TestRateLimitWindows(t *testing.T) {
+	prefs := &notification.NotificationPreferences{MaxNotificationsPerHour: 5, MaxNotificationsPerDay: 20}
+	now := time.Date(2026, time.March, 10, 14, 25, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name      string
+		hour, day int
+		limited   bool
+		reopensAt time.Time
+	}{
+		{"under both", 4, 10, false, time.Time{}},
+		{"hourly limit", 5, 10, true, time.Date(2026, time.March, 10, 15, 0, 0, 0, time.UTC)},
+		{"daily limit", 2, 20, true, time.Date(2026, time.March, 11, 0, 0, 0, 0, time.UTC)},
+		{"both, the day wins", 5, 20, true, time.Date(2026, time.March, 11, 0, 0, 0, 0, time.UTC)},
+	} {
+		reopens, limited := prefs.RateLimited(now, tc.hour, tc.day)
+		if limited != tc.limited || !reopens.Equal(tc.reopensAt) {
+			t.Errorf("%s: got %v %v, want %v %v", tc.name, limited, reopens, tc.limited, tc.reopensAt)
+		}
+	}
+
+	// The day is the user's own, not the UTC one
+	sofia, err := time.LoadLocation("Europe/Sofia")
+	if err != nil {
+		t.Skip("no tz database:", err)
+	}
+	local := &notification.NotificationPreferences{MaxNotificationsPerDay: 20, QuietHoursTimezone: "Europe/Sofia"}
+	lateNight := time.Date(2026, time.March, 10, 22, 30, 0, 0, time.UTC) // 00:30 on the 11th in Sofia
+	if reopens, _ := local.RateLimited(lateNight, 0, 20); !reopens.Equal(time.Date(2026, time.March, 12, 0, 0, 0, 0, sofia)) {
+		t.Errorf("daily limit in Sofia reopens at %v, want midnight on the 12th there", reopens)
+	}
+	// Clocks go forward on the 29th, so that day is 23 hours long
+	start, end := local.Day(time.Date(2026, time.March, 29, 12, 0, 0, 0, sofia))
+	if !start.Equal(time.Date(2026, time.March, 29, 0, 0, 0, 0, sofia)) || end.Sub(start) != 23*time.Hour {
+		t.Errorf("got the day %v to %v", start, end)
+	}
+
+	unlimited := &notification.NotificationPreferences{}
+	if _, limited := unlimited.RateLimited(now, 100, 1000); limited {
+		t.Error("a limit of 0 should mean no limit")
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	mix := notification.TypeFriendPostedMix
+
+	for _, tc := range []struct {
+		notifType notification.NotificationType
+		actors    []string
+		count     int
+		want      string
+	}{
+		{mix, []string{"Ivan", "Maria", "Ivan", "Petar", "Ana", "Georgi"}, 6, "Ivan and 4 others posted to the Mix"},
+		{mix, []string{"Ivan", "Maria"}, 2, "Ivan and Maria posted to the Mix"},
+		{mix, []string{"Ivan", "Ivan", "Ivan"}, 3, "Ivan posted to the Mix 3 times"},
+		{mix, nil, 3, "3 friends posted to the Mix"},
+		{notification.TypeFriendPostedReaction, []string{"Maria", "Ana", "Bob"}, 3, "Maria and 2 others reacted to your post"},
+		{notification.TypeStreakMilestone, nil, 2, "You have 2 new notifications"},
+	} {
+		if got := notification.DigestMessage(tc.notifType, tc.actors, tc.count); got != tc.want {
+			t.Errorf("%s %v: got %q, want %q", tc.notifType, tc.actors, got, tc.want)
+		}
+	}
+}
@@ -11,16 +11,19 @@ type Card struct {
 }
 
 func GenerateNewDeck() []Card {
+	return NewShuffledDeck(rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// NewShuffledDeck builds a 52 card deck shuffled with r, a seeded r always gives the same order
+func NewShuffledDeck(r *rand.Rand) []Card {
 	suits := []string{"H", "D", "C", "S"}
 	ranks := []string{"A", "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K"}
 	deck := make([]Card, 0, 52)
 	for _, s := range suits {
-		for _, r := range ranks {
-			deck = append(deck, Card{Suit: s, Rank: r})
+		for _, rank := range ranks {
+			deck = append(deck, Card{Suit: s, Rank: rank})
 		}
 	}
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
 	r.Shuffle(len(deck), func(i, j int) {
 		deck[i], deck[j] = deck[j], deck[i]
 	})
@@ -76,8 +79,29 @@ func GetRankName(r string) string {
 	}
 }
 
+// GetRankValue orders ranks for higher/lower comparisons, aces are high
+func GetRankValue(r string) int {
+	switch r {
+	case "J":
+		return 11
+	case "Q":
+		return 12
+	case "K":
+		return 13
+	case "A":
+		return 14
+	}
+	var v int
+	fmt.Sscanf(r, "%d", &v)
+	return v
+}
+
+func IsRed(s string) bool {
+	return s == "H" || s == "D"
+}
+
 func GetCardColor(s string) string {
-	if s == "H" || s == "D" {
+	if IsRed(s) {
 		return "#ef4444"
 	}
 	return "black"